@@ -0,0 +1,83 @@
+package rasant
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// assetFS returns the file system for one of the application's asset folders (views, mail,
+// migrations or public). Without ras.Assets it is the folder on disk. With ras.Assets it is
+// the folder inside it, so an embed.FS gives a single binary deploy; in debug mode, files on
+// disk take precedence, so templates can be edited without rebuilding.
+func (ras *Rasant) assetFS(dir string) fs.FS {
+	disk := os.DirFS(ras.RootPath + "/" + dir)
+	if ras.Assets == nil {
+		return disk
+	}
+
+	embedded, err := fs.Sub(ras.Assets, dir)
+	if err != nil {
+		return disk
+	}
+
+	if ras.Debug {
+		return overlayFS{disk, embedded}
+	}
+
+	return embedded
+}
+
+// overlayFS serves files from the first of its file systems that has them. Directories list
+// the entries of all of them.
+type overlayFS []fs.FS
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	var firstErr error
+	for _, fsys := range o {
+		f, err := fsys.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if firstErr == nil || !errors.Is(err, fs.ErrNotExist) {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	var firstErr error
+	found := false
+
+	for _, fsys := range o {
+		list, err := fs.ReadDir(fsys, name)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		found = true
+		for _, e := range list {
+			if !seen[e.Name()] {
+				seen[e.Name()] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if !found {
+		return nil, firstErr
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
@@ -0,0 +1,142 @@
+package rasant
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOverlayFS_Open(t *testing.T) {
+	disk := fstest.MapFS{
+		"home.jet": {Data: []byte("edited on disk")},
+	}
+	embedded := fstest.MapFS{
+		"home.jet": {Data: []byte("embedded")},
+		"about.jet": {Data: []byte("only embedded")},
+	}
+	o := overlayFS{disk, embedded}
+
+	tests := []struct {
+		name string
+		content string
+	}{
+		// files on disk win
+		{"home.jet", "edited on disk"},
+		// and the rest comes from the embedded files
+		{"about.jet", "only embedded"},
+	}
+
+	for _, tt := range tests {
+		b, err := fs.ReadFile(o, tt.name)
+		if err != nil || string(b) != tt.content {
+			t.Errorf("%s: expected %q, got %q %v", tt.name, tt.content, b, err)
+		}
+	}
+
+	if _, err := o.Open("missing.jet"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected a missing file not to exist, got", err)
+	}
+}
+
+func TestOverlayFS_ReadDir(t *testing.T) {
+	disk := fstest.MapFS{
+		"home.jet": {Data: []byte("disk")},
+		"mail/welcome.jet": {Data: []byte("disk")},
+	}
+	embedded := fstest.MapFS{
+		"home.jet": {Data: []byte("embedded")},
+		"about.jet": {Data: []byte("embedded")},
+		"mail/reset.jet": {Data: []byte("embedded")},
+		"public/app.css": {Data: []byte("embedded")},
+	}
+	o := overlayFS{disk, embedded}
+
+	tests := []struct {
+		dir string
+		names []string
+	}{
+		// entries of both layers, once each and sorted
+		{".", []string{"about.jet", "home.jet", "mail", "public"}},
+		{"mail", []string{"reset.jet", "welcome.jet"}},
+		// a folder only one layer has
+		{"public", []string{"app.css"}},
+	}
+
+	for _, tt := range tests {
+		entries, err := fs.ReadDir(o, tt.dir)
+		if err != nil {
+			t.Fatal(tt.dir, err)
+		}
+
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		if !reflect.DeepEqual(names, tt.names) {
+			t.Errorf("%s: expected %v, got %v", tt.dir, tt.names, names)
+		}
+	}
+
+	if _, err := fs.ReadDir(o, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected a missing folder not to exist, got", err)
+	}
+
+	// views are found with fs.Glob, which lists directories
+	matches, err := fs.Glob(o, "*.jet")
+	if err != nil || !reflect.DeepEqual(matches, []string{"about.jet", "home.jet"}) {
+		t.Errorf("expected both layers to be globbed, got %v %v", matches, err)
+	}
+}
+
+func TestAssetFS(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "views"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "views", "home.jet"), []byte("disk"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	assets := fstest.MapFS{
+		"views/home.jet": {Data: []byte("embedded")},
+		"views/about.jet": {Data: []byte("embedded about")},
+		"migrations/1_init.up.sql": {Data: []byte("embedded migration")},
+	}
+
+	tests := []struct {
+		name string
+		assets fs.FS
+		debug bool
+		file string
+		content string
+	}{
+		// without embedded assets, everything comes from disk
+		{"disk", nil, false, "views/home.jet", "disk"},
+		// with them, a production build only uses what was embedded
+		{"embedded", assets, false, "views/home.jet", "embedded"},
+		// in debug mode, disk comes first and the embedded files fill the gaps
+		{"debug disk", assets, true, "views/home.jet", "disk"},
+		{"debug fallback", assets, true, "views/about.jet", "embedded about"},
+		// even when the folder is not on disk at all
+		{"debug missing folder", assets, true, "migrations/1_init.up.sql", "embedded migration"},
+	}
+
+	for _, tt := range tests {
+		ras := &Rasant{RootPath: root, Assets: tt.assets, Debug: tt.debug}
+
+		dir, file := filepath.Split(tt.file)
+		b, err := fs.ReadFile(ras.assetFS(filepath.Clean(dir)), file)
+		if err != nil || string(b) != tt.content {
+			t.Errorf("%s: expected %q, got %q %v", tt.name, tt.content, b, err)
+		}
+	}
+
+	ras := &Rasant{RootPath: root, Assets: assets}
+	if _, err := fs.ReadFile(ras.assetFS("views"), "missing.jet"); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("expected a file in neither layer not to exist, got", err)
+	}
+}
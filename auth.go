@@ -0,0 +1,170 @@
+package rasant
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/justinas/nosurf"
+)
+
+// authAtKey is the session key holding the unix time at which the user last proved who they
+// are, by logging in or by confirming their password
+const authAtKey = "authAt"
+
+// intendedURLKey is the session key holding the page a user was sent away from by
+// RequireRecentAuth
+const intendedURLKey = "intendedURL"
+
+type requestContextKey struct{}
+
+// requestContext gives Login and Logout access to the response writer and the CSRF handler of
+// the request being served, so that they only need its context
+type requestContext struct {
+	w http.ResponseWriter
+	r *http.Request
+	csrf *nosurf.CSRFHandler
+}
+
+// withRequestContext returns middleware that stores the request, its response writer and the
+// CSRF handler in the request context
+func withRequestContext(csrf *nosurf.CSRFHandler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := &requestContext{w: w, csrf: csrf}
+		r = r.WithContext(context.WithValue(r.Context(), requestContextKey{}, rc))
+		rc.r = r
+		next.ServeHTTP(w, r)
+	})
+}
+
+func requestFromContext(ctx context.Context) (*requestContext, bool) {
+	rc, ok := ctx.Value(requestContextKey{}).(*requestContext)
+	return rc, ok
+}
+
+// Login logs userID in on the session in ctx. The session token is renewed, so a token planted
+// before login is useless afterwards, the CSRF token is rotated, the time of login is recorded
+// for RequireRecentAuth, and the session is added to ras.Sessions.
+func (ras *Rasant) Login(ctx context.Context, userID int) error {
+	if err := ras.Session.RenewToken(ctx); err != nil {
+		return err
+	}
+
+	ras.Session.Put(ctx, "userID", userID)
+	ras.Session.Put(ctx, authAtKey, time.Now().Unix())
+
+	rc, ok := requestFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	if rc.csrf != nil {
+		rc.csrf.RegenerateToken(rc.w, rc.r)
+	}
+
+	if ras.Sessions != nil {
+		if err := ras.Sessions.Track(ctx, rc.r, userID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Logout ends the session in ctx, removes it from ras.Sessions, deletes the remember me cookie
+// and rotates the CSRF token
+func (ras *Rasant) Logout(ctx context.Context) error {
+	if token := ras.Session.Token(ctx); token != "" && ras.Sessions != nil {
+		if err := ras.Sessions.RevokeSession(ras.Sessions.ID(token)); err != nil {
+			return err
+		}
+	}
+
+	if err := ras.Session.Destroy(ctx); err != nil {
+		return err
+	}
+
+	rc, ok := requestFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	http.SetCookie(rc.w, &http.Cookie{
+		Name: ras.rememberCookieName(),
+		Value: "",
+		Path: "/",
+		Expires: time.Unix(1, 0),
+		MaxAge: -1,
+		HttpOnly: true,
+		Domain: ras.Session.Cookie.Domain,
+		Secure: ras.Session.Cookie.Secure,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	if rc.csrf != nil {
+		rc.csrf.RegenerateToken(rc.w, rc.r)
+	}
+
+	return nil
+}
+
+// ConfirmAuth records that the logged in user has just proved who they are again, for example
+// by re-entering their password
+func (ras *Rasant) ConfirmAuth(ctx context.Context) {
+	ras.Session.Put(ctx, authAtKey, time.Now().Unix())
+}
+
+// AuthenticatedAt returns the time at which the user last logged in or confirmed their
+// password, or the zero time if they have not
+func (ras *Rasant) AuthenticatedAt(ctx context.Context) time.Time {
+	at := ras.Session.GetInt64(ctx, authAtKey)
+	if at == 0 {
+		return time.Time{}
+	}
+	return time.Unix(at, 0)
+}
+
+// IntendedURL returns, and forgets, the page the user was on when RequireRecentAuth asked them
+// to log in again, or fallback if there is none
+func (ras *Rasant) IntendedURL(ctx context.Context, fallback string) string {
+	if url := ras.Session.PopString(ctx, intendedURLKey); url != "" {
+		return url
+	}
+	return fallback
+}
+
+// RequireRecentAuth returns middleware for sensitive pages, such as changing a password, that
+// only lets the user through if they logged in or confirmed their password within d. Other
+// users are sent to REAUTH_URL (by default /users/login), which can send them back using
+// IntendedURL; requests that are not plain page views get a 401.
+func (ras *Rasant) RequireRecentAuth(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !ras.Session.Exists(r.Context(), "userID") {
+				ras.ErrorUnauthorized(w, r)
+				return
+			}
+
+			at := ras.AuthenticatedAt(r.Context())
+			if !at.IsZero() && time.Since(at) <= d {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method != http.MethodGet || !strings.Contains(r.Header.Get("Accept"), "text/html") {
+				ras.ErrorUnauthorized(w, r)
+				return
+			}
+
+			ras.Session.Put(r.Context(), intendedURLKey, r.URL.RequestURI())
+			http.Redirect(w, r, ras.config.reauthURL, http.StatusSeeOther)
+		})
+	}
+}
+
+// rememberCookieName is the name of the remember me cookie set by the auth scaffold
+func (ras *Rasant) rememberCookieName() string {
+	return fmt.Sprintf("_%s_remember", ras.AppName)
+}
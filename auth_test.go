@@ -0,0 +1,215 @@
+package rasant
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/shaynemeyer/rasant/session"
+)
+
+// browser keeps the cookies a handler sets, the way a browser would
+type browser struct {
+	handler http.Handler
+	cookies map[string]*http.Cookie
+}
+
+func (b *browser) do(method, target string, headers ...string) *http.Response {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	for _, cookie := range b.cookies {
+		r.AddCookie(cookie)
+	}
+
+	w := httptest.NewRecorder()
+	b.handler.ServeHTTP(w, r)
+
+	res := w.Result()
+	for _, cookie := range res.Cookies() {
+		if cookie.MaxAge < 0 || cookie.Value == "" {
+			delete(b.cookies, cookie.Name)
+			continue
+		}
+		b.cookies[cookie.Name] = cookie
+	}
+	return res
+}
+
+func (b *browser) body(method, target string, headers ...string) string {
+	res := b.do(method, target, headers...)
+	body, _ := io.ReadAll(res.Body)
+	return string(body)
+}
+
+// newAuthTest returns a Rasant with sessions, a session registry and CSRF protection, and a
+// browser for an application that logs user 1 in at /login and out at /logout, and shows who
+// is logged in at /user. routes adds more routes.
+func newAuthTest(t *testing.T, routes func(ras *Rasant, mux *http.ServeMux)) (*Rasant, *browser) {
+	t.Helper()
+
+	ras := &Rasant{
+		AppName: "myapp",
+		Session: scs.New(),
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	ras.config.reauthURL = "/users/login"
+	ras.Sessions = session.NewRegistry(ras.Session, []byte("secret"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/visit", func(w http.ResponseWriter, r *http.Request) {
+		ras.Session.Put(r.Context(), "visited", true)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if err := ras.Login(r.Context(), 1); err != nil {
+			t.Error(err)
+		}
+		http.Redirect(w, r, ras.IntendedURL(r.Context(), "/"), http.StatusSeeOther)
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		if err := ras.Logout(r.Context()); err != nil {
+			t.Error(err)
+		}
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strconv.Itoa(ras.Session.GetInt(r.Context(), "userID"))))
+	})
+	if routes != nil {
+		routes(ras, mux)
+	}
+
+	b := &browser{
+		handler: ras.Session.LoadAndSave(ras.NoSurf(mux)),
+		cookies: make(map[string]*http.Cookie),
+	}
+	return ras, b
+}
+
+func TestLogin_RenewsSession(t *testing.T) {
+	ras, b := newAuthTest(t, nil)
+
+	b.do("GET", "/visit")
+	before := b.cookies[ras.Session.Cookie.Name]
+	csrfBefore := b.cookies["csrf_token"]
+	if before == nil || csrfBefore == nil {
+		t.Fatalf("expected a session and a CSRF cookie, got %v", b.cookies)
+	}
+
+	b.do("GET", "/login")
+	after := b.cookies[ras.Session.Cookie.Name]
+	if after == nil || after.Value == before.Value {
+		t.Fatal("expected logging in to issue a new session token")
+	}
+	if b.cookies["csrf_token"] == nil || b.cookies["csrf_token"].Value == csrfBefore.Value {
+		t.Error("expected logging in to rotate the CSRF token")
+	}
+
+	if b.body("GET", "/user") != "1" {
+		t.Error("expected the new session to be logged in")
+	}
+
+	// a token planted before login is useless afterwards
+	attacker := &browser{handler: b.handler, cookies: map[string]*http.Cookie{before.Name: before}}
+	if body := attacker.body("GET", "/user"); body != "0" {
+		t.Errorf("expected the old session token not to be logged in, got user %s", body)
+	}
+
+	sessions, err := ras.Sessions.ListSessions(1)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != ras.Sessions.ID(after.Value) {
+		t.Errorf("expected the new session to be tracked, got %v %v", sessions, err)
+	}
+}
+
+func TestLogout_ClearsRememberMe(t *testing.T) {
+	ras, b := newAuthTest(t, nil)
+
+	b.do("GET", "/login")
+	b.cookies["_myapp_remember"] = &http.Cookie{Name: "_myapp_remember", Value: "1|hash"}
+
+	res := b.do("GET", "/logout")
+
+	var remember *http.Cookie
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "_myapp_remember" {
+			remember = cookie
+		}
+	}
+	if remember == nil || remember.Value != "" || remember.MaxAge >= 0 || !remember.Expires.Before(time.Now()) {
+		t.Fatalf("expected the remember me cookie to be deleted, got %v", remember)
+	}
+	if !remember.HttpOnly || remember.Path != "/" {
+		t.Errorf("expected the deleting cookie to match the one set at login, got %v", remember)
+	}
+	if _, ok := b.cookies["_myapp_remember"]; ok {
+		t.Error("expected the browser to drop the remember me cookie")
+	}
+
+	if b.body("GET", "/user") != "0" {
+		t.Error("expected the user to be logged out")
+	}
+	if sessions, _ := ras.Sessions.ListSessions(1); len(sessions) != 0 {
+		t.Errorf("expected the session to be removed from the registry, got %v", sessions)
+	}
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	_, b := newAuthTest(t, func(ras *Rasant, mux *http.ServeMux) {
+		mux.Handle("/account", ras.RequireRecentAuth(time.Hour)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("account"))
+		})))
+		mux.HandleFunc("/age", func(w http.ResponseWriter, r *http.Request) {
+			ras.Session.Put(r.Context(), authAtKey, time.Now().Add(-2*time.Hour).Unix())
+		})
+		mux.HandleFunc("/confirm", func(w http.ResponseWriter, r *http.Request) {
+			ras.ConfirmAuth(r.Context())
+		})
+	})
+
+	html := []string{"Accept", "text/html,application/xhtml+xml"}
+
+	if res := b.do("GET", "/account", html...); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 for a guest, got %d", res.StatusCode)
+	}
+
+	b.do("GET", "/login")
+	if body := b.body("GET", "/account", html...); body != "account" {
+		t.Errorf("expected a fresh login to be let through, got %q", body)
+	}
+
+	b.do("GET", "/age")
+
+	// only page views are sent to log in again
+	if res := b.do("GET", "/account", "Accept", "application/json"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a 401 for a JSON request, got %d", res.StatusCode)
+	}
+
+	res := b.do("GET", "/account?tab=security", html...)
+	if res.StatusCode != http.StatusSeeOther || res.Header.Get("Location") != "/users/login" {
+		t.Fatalf("expected a redirect to the login page, got %d %s", res.StatusCode, res.Header.Get("Location"))
+	}
+
+	// logging in again goes back to the page, once
+	res = b.do("GET", "/login")
+	if res.Header.Get("Location") != "/account?tab=security" {
+		t.Errorf("expected to be sent back to the intended page, got %s", res.Header.Get("Location"))
+	}
+	if body := b.body("GET", "/account", html...); body != "account" {
+		t.Errorf("expected logging in again to let the user through, got %q", body)
+	}
+	if res = b.do("GET", "/login"); res.Header.Get("Location") != "/" {
+		t.Errorf("expected the intended page to be forgotten, got %s", res.Header.Get("Location"))
+	}
+
+	// confirming the password works as well as logging in
+	b.do("GET", "/age")
+	b.do("GET", "/confirm")
+	if body := b.body("GET", "/account", html...); body != "account" {
+		t.Errorf("expected a confirmed password to let the user through, got %q", body)
+	}
+}
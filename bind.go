@@ -0,0 +1,369 @@
+package rasant
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBindMemory is how much of a multipart body Bind keeps in memory; larger files are
+// stored in temporary files
+const maxBindMemory = 32 << 20
+
+// Bind decodes the body of r into dst, a pointer to a struct, and validates it with its
+// validate tags (see ValidateStruct). The body is read according to its Content-Type:
+//
+//	application/json         with the json tags, as ReadJSON does
+//	application/xml          with the xml tags
+//	multipart/form-data      with the form tags; *multipart.FileHeader fields get the files
+//	anything else            the form, or for requests without a body the query string,
+//	                         with the form tags
+//
+// Form fields are found by their form tag, or else their json tag, or else their name, which
+// are the names ValidateStruct reports errors under; the fields of nested structs by their
+// path, such as address.city. Values that cannot be converted to a field's type are
+// reported in the returned Validation, like failed rules.
+// The error is for a body that cannot be read at all, or a dst that is not a struct pointer.
+func (ras *Rasant) Bind(r *http.Request, dst interface{}) (*Validation, error) {
+	value := reflect.ValueOf(dst)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bind: %T is not a pointer to a struct", dst)
+	}
+
+	v := ras.ValidatorFor(r, nil)
+
+	mediaType := ""
+	if r.Header.Get("Content-Type") != "" {
+		var err error
+		mediaType, _, err = mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			return nil, fmt.Errorf("bind: %w", err)
+		}
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if err := bindJSON(v, r, dst); err != nil {
+			return nil, err
+		}
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		if err := bindXML(v, r, dst); err != nil {
+			return nil, err
+		}
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(maxBindMemory); err != nil {
+			return nil, fmt.Errorf("bind: %w", err)
+		}
+		v.Data = r.Form
+		bindForm(v, value.Elem(), r.Form, r.MultipartForm.File, "")
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, fmt.Errorf("bind: %w", err)
+		}
+		v.Data = r.Form
+		bindForm(v, value.Elem(), r.Form, nil, "")
+	}
+
+	if err := v.ValidateStruct(dst); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func bindJSON(v *Validation, r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1048576))
+
+	err := dec.Decode(dst)
+
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		// the rest of the body was decoded; report the field like a failed rule
+		v.AddError(typeErr.Field, typeMessage(v, typeErr.Type))
+	case errors.Is(err, io.EOF):
+		return errors.New("bind: body must not be empty")
+	case err != nil:
+		return fmt.Errorf("bind: %w", err)
+	}
+
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		return errors.New("bind: body must only have a single json value")
+	}
+
+	return nil
+}
+
+func bindXML(v *Validation, r *http.Request, dst interface{}) error {
+	err := xml.NewDecoder(http.MaxBytesReader(nil, r.Body, 1048576)).Decode(dst)
+	if errors.Is(err, io.EOF) {
+		return errors.New("bind: body must not be empty")
+	}
+
+	// encoding/xml reports bad values as strconv errors, without saying which field
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		v.AddError("body", v.message("xml", "The body has a value of the wrong type: {value}", "value", numErr.Num))
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("bind: %w", err)
+	}
+	return nil
+}
+
+// bindForm sets the fields of the struct dst from values and files, reporting values that
+// cannot be converted in v
+func bindForm(v *Validation, dst reflect.Value, values url.Values, files map[string][]*multipart.FileHeader, prefix string) {
+	t := dst.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldValue := dst.Field(i)
+		if field.Tag.Get("form") == "-" {
+			continue
+		}
+
+		// the exported fields of an embedded struct are bound even when its type is not
+		// exported, as long as no nil pointer has to be set for it
+		if field.Anonymous && field.Tag.Get("form") == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			if fieldValue.Kind() != reflect.Ptr || fieldValue.CanSet() || !fieldValue.IsNil() {
+				bindForm(v, settable(fieldValue), values, files, prefix)
+			}
+			continue
+		}
+
+		if !fieldValue.CanSet() {
+			continue
+		}
+
+		name := prefix + fieldName(field)
+
+		if fileHeaders, ok := files[name]; ok {
+			bindFiles(fieldValue, fileHeaders)
+			continue
+		}
+
+		raw, ok := values[name]
+		if !ok {
+			// a nested struct is filled from name.<field> values
+			if isNestedForm(field.Type) && hasPrefix(values, files, name+".") {
+				bindForm(v, settable(fieldValue), values, files, name+".")
+			}
+			continue
+		}
+
+		if err := setFormValue(fieldValue, raw); err != nil {
+			v.AddError(name, typeMessage(v, field.Type))
+		}
+	}
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// settable follows value's pointers, allocating nil ones, so that it can be set
+func settable(value reflect.Value) reflect.Value {
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		value = value.Elem()
+	}
+	return value
+}
+
+// isNestedForm reports whether t is a struct that forms fill field by field, rather than a
+// value such as time.Time
+func isNestedForm(t reflect.Type) bool {
+	t = indirectType(t)
+	if t.Kind() != reflect.Struct || t == reflect.TypeOf(time.Time{}) || t == reflect.TypeOf(multipart.FileHeader{}) {
+		return false
+	}
+	return !reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+func hasPrefix(values url.Values, files map[string][]*multipart.FileHeader, prefix string) bool {
+	for key := range values {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	for key := range files {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var fileHeaderType = reflect.TypeOf(&multipart.FileHeader{})
+
+// bindFiles sets a *multipart.FileHeader or []*multipart.FileHeader field
+func bindFiles(value reflect.Value, files []*multipart.FileHeader) {
+	switch {
+	case value.Type() == fileHeaderType && len(files) > 0:
+		value.Set(reflect.ValueOf(files[0]))
+	case value.Kind() == reflect.Slice && value.Type().Elem() == fileHeaderType:
+		value.Set(reflect.ValueOf(files))
+	}
+}
+
+// setFormValue converts the form values raw to the type of value, and sets it
+func setFormValue(value reflect.Value, raw []string) error {
+	if value.Kind() == reflect.Slice && value.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(value.Type(), len(raw), len(raw))
+		for i, s := range raw {
+			if err := setString(slice.Index(i), s); err != nil {
+				return err
+			}
+		}
+		value.Set(slice)
+		return nil
+	}
+
+	if len(raw) == 0 {
+		return nil
+	}
+	return setString(value, raw[0])
+}
+
+// setString converts s to the type of value, and sets it
+func setString(value reflect.Value, s string) error {
+	if value.Kind() == reflect.Ptr {
+		if s == "" {
+			// an empty value leaves a pointer nil, so it can tell it was not given
+			return nil
+		}
+		return setString(settable(value), s)
+	}
+
+	if value.Type() == reflect.TypeOf(time.Time{}) {
+		return setTime(value, s)
+	}
+
+	if u, ok := value.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(s)
+	case reflect.Bool:
+		if s == "" || s == "on" {
+			// unchecked checkboxes send nothing, checked ones "on"
+			value.SetBool(s == "on")
+			return nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return nil
+		}
+		if value.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			value.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return nil
+		}
+		n, err := strconv.ParseUint(s, 10, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return nil
+		}
+		f, err := strconv.ParseFloat(s, value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("cannot bind a %s", value.Type())
+		}
+		value.SetBytes([]byte(s))
+	default:
+		return fmt.Errorf("cannot bind a %s", value.Type())
+	}
+
+	return nil
+}
+
+// timeLayouts are the layouts of the values of date and datetime-local inputs, and RFC 3339
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+func setTime(value reflect.Value, s string) error {
+	if s == "" {
+		return nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			value.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%q is not a time", s)
+}
+
+// typeMessage is the error message for a value that is not of type t
+func typeMessage(v *Validation, t reflect.Type) string {
+	t = indirectType(t)
+	if t.Kind() == reflect.Slice {
+		t = indirectType(t.Elem())
+	}
+
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return v.message("date", "This field must be a date")
+	case t == reflect.TypeOf(time.Duration(0)):
+		return v.message("duration", "This field must be a duration, such as 1h30m")
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.message("int", "This field must be an integer")
+	case reflect.Float32, reflect.Float64:
+		return v.message("float", "This field must be a floating point number")
+	case reflect.Bool:
+		return v.message("bool", "This field must be true or false")
+	}
+
+	return v.message("invalid", "This field is not valid")
+}
@@ -0,0 +1,239 @@
+package rasant
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type bindAddress struct {
+	Street string `form:"street"`
+	City string `form:"city" validate:"required"`
+}
+
+type bindAudit struct {
+	Source string `form:"source"`
+}
+
+type bindFormTest struct {
+	bindAudit
+	Name string `form:"name" validate:"required"`
+	// the form tag wins over the json tag, for values and for errors alike
+	Email string `form:"email_address" json:"email" validate:"required,email"`
+	Age int `json:"age"`
+	Score float64
+	Active bool `form:"active"`
+	Tags []string `form:"tags"`
+	IDs []int `form:"ids"`
+	Nickname *string `form:"nickname"`
+	Limit *int `form:"limit"`
+	Born time.Time `form:"born"`
+	Meeting time.Time `form:"meeting"`
+	Timeout time.Duration `form:"timeout"`
+	Address bindAddress `form:"address"`
+	Billing *bindAddress `form:"billing"`
+	Ignored string `form:"-"`
+}
+
+func postForm(values url.Values) *http.Request {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestBind_Form(t *testing.T) {
+	ras := &Rasant{}
+
+	values := url.Values{
+		"name": {"Ada"},
+		"email_address": {"ada@example.com"},
+		"age": {"36"},
+		"Score": {"9.5"},
+		"active": {"on"},
+		"tags": {"math", "engines"},
+		"ids": {"1", "2", "3"},
+		"nickname": {"countess"},
+		"limit": {""},
+		"born": {"1815-12-10"},
+		"meeting": {"1833-06-05T19:30"},
+		"timeout": {"1h30m"},
+		"address.city": {"London"},
+		"address.street": {"St James's Square"},
+		"source": {"signup"},
+		"Ignored": {"set"},
+	}
+
+	var dst bindFormTest
+	v, err := ras.Bind(postForm(values), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Valid() {
+		t.Fatalf("expected a valid form, got %v", v.Errors)
+	}
+
+	if dst.Name != "Ada" || dst.Email != "ada@example.com" || dst.Age != 36 || dst.Score != 9.5 || !dst.Active {
+		t.Errorf("wrong values: %+v", dst)
+	}
+	if strings.Join(dst.Tags, ",") != "math,engines" || len(dst.IDs) != 3 || dst.IDs[2] != 3 {
+		t.Errorf("wrong slices: %v %v", dst.Tags, dst.IDs)
+	}
+	if dst.Nickname == nil || *dst.Nickname != "countess" {
+		t.Errorf("expected the nickname pointer to be set, got %v", dst.Nickname)
+	}
+	if dst.Limit != nil {
+		t.Error("expected an empty value to leave a pointer nil")
+	}
+	if !dst.Born.Equal(time.Date(1815, 12, 10, 0, 0, 0, 0, time.UTC)) || dst.Meeting.Hour() != 19 || dst.Meeting.Minute() != 30 {
+		t.Errorf("wrong times: %v %v", dst.Born, dst.Meeting)
+	}
+	if dst.Timeout != 90*time.Minute {
+		t.Errorf("wrong duration: %v", dst.Timeout)
+	}
+	if dst.Address.City != "London" || dst.Address.Street != "St James's Square" {
+		t.Errorf("wrong nested struct: %+v", dst.Address)
+	}
+	if dst.Billing != nil {
+		t.Error("expected a nested struct pointer without values to stay nil")
+	}
+	if dst.Source != "signup" {
+		t.Error("expected the embedded struct's fields to be bound")
+	}
+	if dst.Ignored != "" {
+		t.Error(`expected form:"-" to be skipped`)
+	}
+}
+
+func TestBind_FormErrors(t *testing.T) {
+	ras := &Rasant{}
+
+	values := url.Values{
+		"email": {"ada@example.com"},
+		"age": {"old"},
+		"ids": {"1", "two"},
+		"limit": {"many"},
+		"born": {"yesterday"},
+		"timeout": {"soon"},
+		"active": {"maybe"},
+		"billing.street": {"Downing Street"},
+	}
+
+	var dst bindFormTest
+	v, err := ras.Bind(postForm(values), &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"name": "This field cannot be blank",
+		// the value was sent under the json name, which forms do not use
+		"email_address": "This field cannot be blank",
+		"age": "This field must be an integer",
+		"ids": "This field must be an integer",
+		"limit": "This field must be an integer",
+		"born": "This field must be a date",
+		"timeout": "This field must be a duration, such as 1h30m",
+		"active": "This field must be true or false",
+		// nested structs are validated by their path; a pointer to one is allocated when any
+		// of its values are sent
+		"address.city": "This field cannot be blank",
+		"billing.city": "This field cannot be blank",
+	}
+	for key, message := range want {
+		if v.Errors[key] != message {
+			t.Errorf("%s: expected %q, got %q", key, message, v.Errors[key])
+		}
+	}
+	if len(v.Errors) != len(want) {
+		t.Errorf("expected %d errors, got %v", len(want), v.Errors)
+	}
+}
+
+func TestBind_Query(t *testing.T) {
+	ras := &Rasant{}
+
+	var dst struct {
+		Page int `form:"page"`
+		Sort string `json:"sort"`
+	}
+	v, err := ras.Bind(httptest.NewRequest("GET", "/?page=2&sort=name", nil), &dst)
+	if err != nil || !v.Valid() {
+		t.Fatal(err, v.Errors)
+	}
+	if dst.Page != 2 || dst.Sort != "name" {
+		t.Errorf("wrong values: %+v", dst)
+	}
+}
+
+func TestBind_JSON(t *testing.T) {
+	ras := &Rasant{}
+
+	var dst struct {
+		Name string `json:"name" validate:"required"`
+		Age int `json:"age"`
+		Address bindAddress `json:"address"`
+		Tags []string `json:"tags"`
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"Ada","age":"old","address":{"City":"London"},"tags":["a","b"]}`))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	v, err := ras.Bind(r, &dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Errors["age"] != "This field must be an integer" || len(v.Errors) != 1 {
+		t.Errorf("expected only a type error for age, got %v", v.Errors)
+	}
+	if dst.Name != "Ada" || dst.Address.City != "London" || len(dst.Tags) != 2 {
+		t.Errorf("expected the rest of the body to be decoded, got %+v", dst)
+	}
+
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"Ada"}{"name":"Bob"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if _, err = ras.Bind(r, &dst); err == nil {
+		t.Error("expected a body with two values to fail")
+	}
+}
+
+func TestBind_Multipart(t *testing.T) {
+	ras := &Rasant{}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	_ = w.WriteField("name", "Ada")
+	part, _ := w.CreateFormFile("avatar", "ada.png")
+	part.Write(pngHeader)
+	w.Close()
+
+	r := httptest.NewRequest("POST", "/", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+
+	var dst struct {
+		Name string `form:"name"`
+		Avatar *multipart.FileHeader `form:"avatar" validate:"filetype=image/*"`
+	}
+	v, err := ras.Bind(r, &dst)
+	if err != nil || !v.Valid() {
+		t.Fatal(err, v.Errors)
+	}
+	if dst.Name != "Ada" || dst.Avatar == nil || dst.Avatar.Filename != "ada.png" {
+		t.Errorf("wrong values: %+v", dst)
+	}
+}
+
+func TestBind_NotAStructPointer(t *testing.T) {
+	ras := &Rasant{}
+
+	var s struct{ Name string }
+	for _, dst := range []interface{}{s, nil, new(string)} {
+		if _, err := ras.Bind(postForm(url.Values{}), dst); err == nil {
+			t.Errorf("expected %T to be refused", dst)
+		}
+	}
+}
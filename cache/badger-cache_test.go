@@ -1,6 +1,12 @@
 package cache
 
-import "testing"
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
 
 func TestBadgerCache_Has(t *testing.T) {
 	err := testBadgerCache.Forget("foo")
@@ -138,4 +144,190 @@ func TestBadgerCache_EmptyByMatch(t *testing.T) {
 	if !inCache {
 		t.Error("beta not found in cache, and it should be there")
 	}
-}
\ No newline at end of file
+}
+func TestBadgerCache_GetMany(t *testing.T) {
+	err := testBadgerCache.SetMany(map[string]interface{}{"one": "1", "two": 2})
+	if err != nil {
+		t.Error(err)
+	}
+
+	items, err := testBadgerCache.GetMany("one", "two", "missing")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if items["one"] != "1" || items["two"] != 2 {
+		t.Error("did not get correct values from cache:", items)
+	}
+
+	if _, ok := items["missing"]; ok {
+		t.Error("missing found in cache, and it shouldn't be there")
+	}
+}
+
+func TestBadgerCache_Increment(t *testing.T) {
+	_ = testBadgerCache.Forget("counter")
+
+	n, err := testBadgerCache.Increment("counter", 2, 60)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 2 {
+		t.Error("expected counter to be 2, but got", n)
+	}
+
+	n, err = testBadgerCache.Decrement("counter", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 1 {
+		t.Error("expected counter to be 1, but got", n)
+	}
+
+	ttl, err := testBadgerCache.TTL("counter")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ttl <= 0 {
+		t.Error("expected counter to keep its ttl, but got", ttl)
+	}
+
+	_ = testBadgerCache.Set("not-a-counter", "foo")
+	_, err = testBadgerCache.Increment("not-a-counter", 1)
+	if err != ErrNotInteger {
+		t.Error("expected ErrNotInteger, but got", err)
+	}
+}
+
+func TestBadgerCache_IncrementConcurrent(t *testing.T) {
+	_ = testBadgerCache.Forget("concurrent")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := testBadgerCache.Increment("concurrent", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	x, err := testBadgerCache.Get("concurrent")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if x != int64(20) {
+		t.Error("expected counter to be 20, but got", x)
+	}
+}
+
+func TestBadgerCache_Add(t *testing.T) {
+	_ = testBadgerCache.Forget("flag")
+
+	added, err := testBadgerCache.Add("flag", true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !added {
+		t.Error("flag was not added, and it should have been")
+	}
+
+	added, err = testBadgerCache.Add("flag", false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if added {
+		t.Error("flag was added twice")
+	}
+}
+
+func TestBadgerCache_TTL(t *testing.T) {
+	_ = testBadgerCache.Forget("forever")
+
+	_, err := testBadgerCache.TTL("forever")
+	if err != ErrNotFound {
+		t.Error("expected ErrNotFound, but got", err)
+	}
+
+	_ = testBadgerCache.Set("forever", "foo")
+	ttl, err := testBadgerCache.TTL("forever")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ttl != NoExpiration {
+		t.Error("expected NoExpiration, but got", ttl)
+	}
+}
+
+func TestBadgerCache_MigrateUnprefixed(t *testing.T) {
+	// entries the way earlier versions wrote them, next to something that is not a cache entry
+	err := testBadgerCache.Conn.Update(func(txn *badger.Txn) error {
+		old, err := newEntry("migrated", "old")
+		if err != nil {
+			return err
+		}
+		if err = txn.SetEntry(old.WithTTL(time.Hour)); err != nil {
+			return err
+		}
+
+		stale, err := newEntry("kept", "stale")
+		if err != nil {
+			return err
+		}
+		if err = txn.SetEntry(stale); err != nil {
+			return err
+		}
+
+		return txn.Set([]byte("not-a-cache-entry"), []byte("raw"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = testBadgerCache.Set("kept", "new")
+
+	n, err := testBadgerCache.MigrateUnprefixed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 entries to be migrated, got %d", n)
+	}
+
+	if x, _ := testBadgerCache.Get("migrated"); x != "old" {
+		t.Error("expected the old entry under its new key, got", x)
+	}
+	if ttl, _ := testBadgerCache.TTL("migrated"); ttl <= 0 || ttl > time.Hour {
+		t.Error("expected the old entry to keep its expiry, got", ttl)
+	}
+	if x, _ := testBadgerCache.Get("kept"); x != "new" {
+		t.Error("expected a newer value to win over an old one, got", x)
+	}
+
+	err = testBadgerCache.Conn.Update(func(txn *badger.Txn) error {
+		for _, key := range []string{"migrated", "kept"} {
+			if _, err := txn.Get([]byte(key)); err != badger.ErrKeyNotFound {
+				t.Errorf("expected the unprefixed key %s to be removed, got %v", key, err)
+			}
+		}
+		if _, err := txn.Get([]byte("not-a-cache-entry")); err != nil {
+			t.Error("expected other data to be left alone, got", err)
+		}
+		return txn.Delete([]byte("not-a-cache-entry"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err = testBadgerCache.MigrateUnprefixed(); n != 0 || err != nil {
+		t.Errorf("expected nothing left to migrate, got %d %v", n, err)
+	}
+}
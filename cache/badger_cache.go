@@ -1,16 +1,26 @@
 package cache
 
 import (
+	"bytes"
+	"fmt"
 	"time"
 
 	"github.com/dgraph-io/badger/v3"
 )
 
+// BadgerCache stores cache entries in a badger database. Keys are stored as Prefix:key, so
+// several caches (or anything else) can share the same database. Earlier versions stored
+// keys without the prefix; MigrateUnprefixed moves such entries to their new keys.
 type BadgerCache struct {
 	Conn *badger.DB
 	Prefix string
 }
 
+// key returns the prefixed key that str is stored under
+func (bc *BadgerCache) key(str string) string {
+	return fmt.Sprintf("%s:%s", bc.Prefix, str)
+}
+
 func (bc *BadgerCache) Has(str string) (bool, error) {
 	_, err := bc.Get(str)
 	if err != nil {
@@ -21,10 +31,11 @@ func (bc *BadgerCache) Has(str string) (bool, error) {
 }
 
 func (bc *BadgerCache) Get(str string) (interface{}, error) {
+	key := bc.key(str)
 	var fromCache []byte
 
 	err := bc.Conn.View(func(txn *badger.Txn) error {
-    item, err := txn.Get([]byte(str))	
+    item, err := txn.Get([]byte(key))	
 		if err != nil {
       return err
     }
@@ -50,39 +61,55 @@ func (bc *BadgerCache) Get(str string) (interface{}, error) {
     return nil, err
   }
 
-	item := decoded[str]
+	item := decoded[key]
 	return item, nil
 }
 
 func (bc *BadgerCache) Set(str string, value interface{}, expires ...int) error {
-  entry := Entry{}
+	return bc.Conn.Update(func(txn *badger.Txn) error {
+		return bc.setEntry(txn, bc.key(str), value, expiresToTTL(expires))
+	})
+}
+
+// setEntry encodes value and writes it under the (already prefixed) key inside txn, with an
+// optional ttl
+func (bc *BadgerCache) setEntry(txn *badger.Txn, key string, value interface{}, ttl time.Duration) error {
+	e, err := newEntry(key, value)
+	if err != nil {
+		return err
+	}
+
+	if ttl > 0 {
+		e = e.WithTTL(ttl)
+	}
 
-	entry[str] = value
+	return txn.SetEntry(e)
+}
+
+// newEntry encodes value into a badger entry for the (already prefixed) key
+func newEntry(key string, value interface{}) (*badger.Entry, error) {
+	entry := Entry{}
+	entry[key] = value
 	encoded, err := encode(entry)
 	if err != nil {
-    return err
-  }
+		return nil, err
+	}
 
+	return badger.NewEntry([]byte(key), encoded), nil
+}
+
+// expiresToTTL converts the optional expiry in seconds used throughout the Cache interface
+// to a duration; zero means no expiry
+func expiresToTTL(expires []int) time.Duration {
 	if len(expires) > 0 {
-		err = bc.Conn.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry([]byte(str), encoded).WithTTL(time.Second * time.Duration(expires[0]))
-			err = txn.SetEntry(e)
-			return err
-		})
-	} else {
-		err = bc.Conn.Update(func(txn *badger.Txn) error {
-			e := badger.NewEntry([]byte(str), encoded)
-			err = txn.SetEntry(e)
-			return err
-		})
+		return time.Second * time.Duration(expires[0])
 	}
- 
-	return nil
+	return 0
 }
 
 func (bc *BadgerCache) Forget(str string) error {
 	err := bc.Conn.Update(func(txn *badger.Txn) error {
-		err := txn.Delete([]byte(str))
+		err := txn.Delete([]byte(bc.key(str)))
 		return err
 	})
 
@@ -90,11 +117,86 @@ func (bc *BadgerCache) Forget(str string) error {
 }
 
 func (bc *BadgerCache) EmptyByMatch(str string) error {
-	return bc.emptyByMatch(str)
+	return bc.emptyByMatch(bc.key(str))
 }
 
+// Empty removes every key under this cache's prefix, leaving the rest of the database alone
 func (bc *BadgerCache) Empty() error {
-	return bc.emptyByMatch("")
+	return bc.emptyByMatch(bc.key(""))
+}
+
+// MigrateUnprefixed moves entries written before keys were prefixed, when a key was stored as
+// is, to Prefix:key, keeping their expiry, and returns how many it moved. Entries are
+// recognised by their encoding, so anything else in the database is left alone, but a key
+// another cache wrote under its own prefix looks the same as an old one: call it once, on
+// upgrade, before other caches share the database. A key that is already set under the new
+// name keeps its newer value.
+func (bc *BadgerCache) MigrateUnprefixed() (int, error) {
+	type oldEntry struct {
+		key string
+		value interface{}
+		expiresAt uint64
+	}
+
+	var old []oldEntry
+	prefix := []byte(bc.key(""))
+
+	err := bc.Conn.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			if bytes.HasPrefix(item.Key(), prefix) {
+				continue
+			}
+
+			key := string(item.KeyCopy(nil))
+			err := item.Value(func(val []byte) error {
+				decoded, err := decode(string(val))
+				if err != nil {
+					return nil
+				}
+				if value, ok := decoded[key]; ok && len(decoded) == 1 {
+					old = append(old, oldEntry{key, value, item.ExpiresAt()})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, o := range old {
+		err := bc.update(func(txn *badger.Txn) error {
+			key := bc.key(o.key)
+			_, err := txn.Get([]byte(key))
+			if err == badger.ErrKeyNotFound {
+				e, err := newEntry(key, o.value)
+				if err != nil {
+					return err
+				}
+				e.ExpiresAt = o.expiresAt
+				if err = txn.SetEntry(e); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			}
+
+			return txn.Delete([]byte(o.key))
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(old), nil
 }
 
 func (bc *BadgerCache) emptyByMatch(str string) error {
@@ -146,4 +248,181 @@ func (bc *BadgerCache) emptyByMatch(str string) error {
 	})
 
 	return err
-}
\ No newline at end of file
+}
+
+// GetMany returns the values for all of the given keys that are in the cache, read in a
+// single transaction. Keys that are not found are left out of the returned map.
+func (bc *BadgerCache) GetMany(strs ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{}, len(strs))
+
+	err := bc.Conn.View(func(txn *badger.Txn) error {
+		for _, str := range strs {
+			key := bc.key(str)
+			item, err := txn.Get([]byte(key))
+			if err == badger.ErrKeyNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			value, err := bc.itemValue(item, key)
+			if err != nil {
+				return err
+			}
+			items[str] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SetMany stores all of the given values in a single transaction
+func (bc *BadgerCache) SetMany(values map[string]interface{}, expires ...int) error {
+	ttl := expiresToTTL(expires)
+
+	return bc.Conn.Update(func(txn *badger.Txn) error {
+		for str, value := range values {
+			if err := bc.setEntry(txn, bc.key(str), value, ttl); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Increment atomically adds by to the counter stored at str, creating it at zero if needed.
+// The optional expiry (in seconds) is only applied when the counter is created; an existing
+// counter keeps the expiry it has.
+func (bc *BadgerCache) Increment(str string, by int64, expires ...int) (int64, error) {
+	key := bc.key(str)
+	var result int64
+
+	err := bc.update(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(key))
+		if err == badger.ErrKeyNotFound {
+			result = by
+			return bc.setEntry(txn, key, result, expiresToTTL(expires))
+		}
+		if err != nil {
+			return err
+		}
+
+		value, err := bc.itemValue(item, key)
+		if err != nil {
+			return err
+		}
+
+		current, err := toInt64(value)
+		if err != nil {
+			return err
+		}
+
+		result = current + by
+		e, err := newEntry(key, result)
+		if err != nil {
+			return err
+		}
+
+		// an existing counter keeps its expiry, to the second
+		e.ExpiresAt = item.ExpiresAt()
+		return txn.SetEntry(e)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return result, nil
+}
+
+// Decrement atomically subtracts by from the counter stored at str
+func (bc *BadgerCache) Decrement(str string, by int64, expires ...int) (int64, error) {
+	return bc.Increment(str, -by, expires...)
+}
+
+// Add stores value only if str is not already in the cache, and reports whether it did so
+func (bc *BadgerCache) Add(str string, value interface{}, expires ...int) (bool, error) {
+	key := bc.key(str)
+	var added bool
+
+	err := bc.update(func(txn *badger.Txn) error {
+		added = false
+
+		_, err := txn.Get([]byte(key))
+		if err == nil {
+			return nil
+		}
+		if err != badger.ErrKeyNotFound {
+			return err
+		}
+
+		added = true
+		return bc.setEntry(txn, key, value, expiresToTTL(expires))
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return added, nil
+}
+
+// TTL returns how long str has left to live. Keys without an expiry return NoExpiration,
+// and missing keys return ErrNotFound.
+func (bc *BadgerCache) TTL(str string) (time.Duration, error) {
+	var ttl time.Duration
+
+	err := bc.Conn.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(bc.key(str)))
+		if err == badger.ErrKeyNotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		expiresAt := item.ExpiresAt()
+		if expiresAt == 0 {
+			ttl = NoExpiration
+			return nil
+		}
+
+		ttl = time.Until(time.Unix(int64(expiresAt), 0))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return ttl, nil
+}
+
+// itemValue decodes the value stored in a badger item under the (already prefixed) key
+func (bc *BadgerCache) itemValue(item *badger.Item, key string) (interface{}, error) {
+	var value interface{}
+
+	err := item.Value(func(val []byte) error {
+		decoded, err := decode(string(val))
+		if err != nil {
+			return err
+		}
+		value = decoded[key]
+		return nil
+	})
+
+	return value, err
+}
+
+// update runs fn in a read-write transaction, retrying when badger reports a conflict with
+// another transaction so that read-modify-write operations stay atomic
+func (bc *BadgerCache) update(fn func(txn *badger.Txn) error) error {
+	for {
+		err := bc.Conn.Update(fn)
+		if err != badger.ErrConflict {
+			return err
+		}
+	}
+}
@@ -2,12 +2,26 @@ package cache
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 )
 
+// NoExpiration is returned by TTL for keys that never expire
+const NoExpiration time.Duration = -1
+
+// ErrNotFound is returned when an operation needs a key that is not in the cache
+var ErrNotFound = errors.New("cache: key not found")
+
+// ErrNotInteger is returned when Increment or Decrement is used on a key that does not hold an integer
+var ErrNotInteger = errors.New("cache: value is not an integer")
+
 type Cache interface{
 	Has(string) (bool, error)
 	Get(string) (interface{}, error)
@@ -15,8 +29,16 @@ type Cache interface{
 	Forget(string) error
 	EmptyByMatch(string) error
 	Empty() error
+	GetMany(...string) (map[string]interface{}, error)
+	SetMany(map[string]interface{}, ...int) error
+	Increment(string, int64, ...int) (int64, error)
+	Decrement(string, int64, ...int) (int64, error)
+	Add(string, interface{}, ...int) (bool, error)
+	TTL(string) (time.Duration, error)
 }
 
+// RedisCache stores values in redis. Its methods use context.Background(); WithContext gives
+// the same cache as a ContextCache whose calls are cancelled with their context.
 type RedisCache struct {
 	Conn *redis.Pool
 	Prefix string
@@ -25,11 +47,18 @@ type RedisCache struct {
 type Entry map[string]interface{}
 
 func (c *RedisCache) Has(str string) (bool, error) {
+	return c.has(context.Background(), str)
+}
+
+func (c *RedisCache) has(ctx context.Context, str string) (bool, error) {
 	key := fmt.Sprintf("%s:%s", c.Prefix, str)
-	conn := c.Conn.Get()
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
 	defer conn.Close()
 
-	ok, err := redis.Bool(conn.Do("EXISTS", key))
+	ok, err := redis.Bool(redis.DoContext(conn, ctx, "EXISTS", key))
 	if err != nil {
 		return false, err
 	}
@@ -61,28 +90,49 @@ func decode(str string) (Entry, error) {
 }
 
 func (c *RedisCache) Get(str string) (interface{}, error) {
+	return c.get(context.Background(), str)
+}
+
+func (c *RedisCache) get(ctx context.Context, str string) (interface{}, error) {
 	key := fmt.Sprintf("%s:%s", c.Prefix, str)
-	conn := c.Conn.Get()
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer conn.Close()
 
-	cacheEntry, err := redis.Bytes(conn.Do("GET", key))
+	cacheEntry, err := redis.Bytes(redis.DoContext(conn, ctx, "GET", key))
 	if err != nil {
     return nil, err
   }
 
+	return decodeValue(key, cacheEntry)
+}
+
+// decodeValue decodes a stored entry. Counters written by Increment are stored as plain
+// integers so that redis can update them atomically, so those are returned as int64.
+func decodeValue(key string, cacheEntry []byte) (interface{}, error) {
 	decoded, err := decode(string(cacheEntry))
 	if err != nil {
-    return nil, err
-  }
-
-	item := decoded[key]
+		if n, perr := strconv.ParseInt(string(cacheEntry), 10, 64); perr == nil {
+			return n, nil
+		}
+		return nil, err
+	}
 
-	return item, nil
+	return decoded[key], nil
 }
 
 func (c *RedisCache) Set(str string, value interface{}, expires ...int) error {
+	return c.set(context.Background(), str, value, expires...)
+}
+
+func (c *RedisCache) set(ctx context.Context, str string, value interface{}, expires ...int) error {
 	key := fmt.Sprintf("%s:%s", c.Prefix, str)
-	conn := c.Conn.Get()
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
 
 	entry := Entry{}
@@ -93,12 +143,12 @@ func (c *RedisCache) Set(str string, value interface{}, expires ...int) error {
   }
 
 	if len(expires) > 0 {
-		_, err := conn.Do("SETEX", key, expires[0], string(encoded))
+		_, err := redis.DoContext(conn, ctx, "SETEX", key, expires[0], string(encoded))
 		if err != nil {
       return err
     }
 	} else {
-		_, err := conn.Do("SET", key, string(encoded))
+		_, err := redis.DoContext(conn, ctx, "SET", key, string(encoded))
     if err != nil {
       return err
     }
@@ -107,11 +157,18 @@ func (c *RedisCache) Set(str string, value interface{}, expires ...int) error {
 }
 
 func (c *RedisCache) Forget(str string) error {
+	return c.forget(context.Background(), str)
+}
+
+func (c *RedisCache) forget(ctx context.Context, str string) error {
 	key := fmt.Sprintf("%s:%s", c.Prefix, str)
-	conn := c.Conn.Get()
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
 
-	_, err := conn.Do("DEL", key)
+	_, err = redis.DoContext(conn, ctx, "DEL", key)
 	if err != nil {
 		return err
   }
@@ -120,17 +177,24 @@ func (c *RedisCache) Forget(str string) error {
 }
 
 func (c *RedisCache) EmptyByMatch(str string) error {
+	return c.emptyByMatch(context.Background(), str)
+}
+
+func (c *RedisCache) emptyByMatch(ctx context.Context, str string) error {
 	key := fmt.Sprintf("%s:%s", c.Prefix, str)
-	conn := c.Conn.Get()
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
 
-	keys, err := c.getKeys(key)
+	keys, err := c.getKeys(ctx, key)
 	if err != nil {
 		return err
 	}
 
 	for _, x := range keys {
-		_, err := conn.Do("DEL", x)
+		_, err := redis.DoContext(conn, ctx, "DEL", x)
 		if err != nil {
 				return err
 			}
@@ -140,17 +204,24 @@ func (c *RedisCache) EmptyByMatch(str string) error {
 }
 
 func (c *RedisCache) Empty() error {
+	return c.empty(context.Background())
+}
+
+func (c *RedisCache) empty(ctx context.Context) error {
 	key := fmt.Sprintf("%s:", c.Prefix)
-	conn := c.Conn.Get()
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return err
+	}
 	defer conn.Close()
 
-	keys, err := c.getKeys(key)
+	keys, err := c.getKeys(ctx, key)
 	if err != nil {
 		return err
 	}
 
 	for _, x := range keys {
-		_, err = conn.Do("DEL", x)
+		_, err = redis.DoContext(conn, ctx, "DEL", x)
 		if err != nil {
 			return err
 		}
@@ -159,15 +230,18 @@ func (c *RedisCache) Empty() error {
 	return nil
 }
 
-func (c *RedisCache) getKeys(pattern string) ([]string, error) {
-	conn := c.Conn.Get()
-	defer conn.Close()
-
+func (c *RedisCache) getKeys(ctx context.Context, pattern string) ([]string, error) {
 	iter := 0
 	keys := []string{}
 
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return keys, err
+	}
+	defer conn.Close()
+
 	for {
-		arr, err := redis.Values(conn.Do("SCAN", iter, "MATCH", fmt.Sprintf("%s*", pattern)))
+		arr, err := redis.Values(redis.DoContext(conn, ctx, "SCAN", iter, "MATCH", fmt.Sprintf("%s*", pattern)))
 		if err != nil {
 			return keys, err
 		}
@@ -183,3 +257,288 @@ func (c *RedisCache) getKeys(pattern string) ([]string, error) {
 
 	return keys, nil
 }
+
+// GetMany returns the values for all of the given keys that are in the cache, fetched with a
+// single MGET. Keys that are not found are left out of the returned map.
+func (c *RedisCache) GetMany(strs ...string) (map[string]interface{}, error) {
+	return c.getMany(context.Background(), strs...)
+}
+
+func (c *RedisCache) getMany(ctx context.Context, strs ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{}, len(strs))
+	if len(strs) == 0 {
+		return items, nil
+	}
+
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := make([]interface{}, len(strs))
+	for i, str := range strs {
+		args[i] = fmt.Sprintf("%s:%s", c.Prefix, str)
+	}
+
+	values, err := redis.ByteSlices(redis.DoContext(conn, ctx, "MGET", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+
+		item, err := decodeValue(args[i].(string), value)
+		if err != nil {
+			return nil, err
+		}
+		items[strs[i]] = item
+	}
+
+	return items, nil
+}
+
+// SetMany stores all of the given values, pipelining the writes over a single connection
+func (c *RedisCache) SetMany(values map[string]interface{}, expires ...int) error {
+	return c.setMany(context.Background(), values, expires...)
+}
+
+func (c *RedisCache) setMany(ctx context.Context, values map[string]interface{}, expires ...int) error {
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for str, value := range values {
+		key := fmt.Sprintf("%s:%s", c.Prefix, str)
+
+		entry := Entry{}
+		entry[key] = value
+		encoded, err := encode(entry)
+		if err != nil {
+			return err
+		}
+
+		if len(expires) > 0 {
+			err = conn.Send("SETEX", key, expires[0], string(encoded))
+		} else {
+			err = conn.Send("SET", key, string(encoded))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Do("") flushes the pipeline and returns every reply, with errors among them
+	replies, err := redis.Values(redis.DoContext(conn, ctx, ""))
+	if err != nil {
+		return err
+	}
+
+	for _, reply := range replies {
+		if err, ok := reply.(redis.Error); ok {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// incrementScript adds to a counter and, when it creates the counter, applies the ttl in the
+// same atomic step
+var incrementScript = redis.NewScript(1, `
+local created = redis.call('EXISTS', KEYS[1]) == 0
+local v = redis.call('INCRBY', KEYS[1], ARGV[1])
+if created and tonumber(ARGV[2]) > 0 then
+	redis.call('EXPIRE', KEYS[1], ARGV[2])
+end
+return v
+`)
+
+// counterScript turns a value written by Set into a plain counter, keeping its ttl, unless it
+// was changed since it was read
+var counterScript = redis.NewScript(1, `
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+local ttl = redis.call('PTTL', KEYS[1])
+redis.call('SET', KEYS[1], ARGV[2])
+if ttl > 0 then
+	redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return 1
+`)
+
+// Increment atomically adds by to the counter stored at str, creating it at zero if needed.
+// The optional expiry (in seconds) is only applied when the counter is created. A number
+// stored with Set can be incremented too.
+func (c *RedisCache) Increment(str string, by int64, expires ...int) (int64, error) {
+	return c.increment(context.Background(), str, by, expires...)
+}
+
+func (c *RedisCache) increment(ctx context.Context, str string, by int64, expires ...int) (int64, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, str)
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	ttl := 0
+	if len(expires) > 0 {
+		ttl = expires[0]
+	}
+
+	for {
+		n, err := redis.Int64(incrementScript.DoContext(ctx, conn, key, by, ttl))
+		if err == nil {
+			return n, nil
+		}
+		if _, ok := err.(redis.Error); !ok || !strings.Contains(err.Error(), "not an integer") {
+			return 0, err
+		}
+
+		// counters are plain integers so that redis can add to them, but Set encodes values
+		if err := c.toCounter(ctx, conn, key); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// toCounter rewrites the value Set stored at key as a plain integer, so that Increment can
+// add to it. Values that are not integers give ErrNotInteger.
+func (c *RedisCache) toCounter(ctx context.Context, conn redis.Conn, key string) error {
+	for {
+		cacheEntry, err := redis.Bytes(redis.DoContext(conn, ctx, "GET", key))
+		if err == redis.ErrNil {
+			// gone since INCRBY failed; it will be created as a counter
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		decoded, err := decode(string(cacheEntry))
+		if err != nil {
+			return ErrNotInteger
+		}
+
+		n, err := toInt64(decoded[key])
+		if err != nil {
+			return err
+		}
+
+		swapped, err := redis.Bool(counterScript.DoContext(ctx, conn, key, cacheEntry, strconv.FormatInt(n, 10)))
+		if err != nil || swapped {
+			return err
+		}
+	}
+}
+
+// Decrement atomically subtracts by from the counter stored at str
+func (c *RedisCache) Decrement(str string, by int64, expires ...int) (int64, error) {
+	return c.Increment(str, -by, expires...)
+}
+
+// Add stores value only if str is not already in the cache, and reports whether it did so
+func (c *RedisCache) Add(str string, value interface{}, expires ...int) (bool, error) {
+	return c.add(context.Background(), str, value, expires...)
+}
+
+func (c *RedisCache) add(ctx context.Context, str string, value interface{}, expires ...int) (bool, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, str)
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	entry := Entry{}
+	entry[key] = value
+	encoded, err := encode(entry)
+	if err != nil {
+		return false, err
+	}
+
+	args := []interface{}{key, string(encoded), "NX"}
+	if len(expires) > 0 {
+		args = append(args, "EX", expires[0])
+	}
+
+	_, err = redis.String(redis.DoContext(conn, ctx, "SET", args...))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// TTL returns how long str has left to live. Keys without an expiry return NoExpiration,
+// and missing keys return ErrNotFound.
+func (c *RedisCache) TTL(str string) (time.Duration, error) {
+	return c.ttl(context.Background(), str)
+}
+
+func (c *RedisCache) ttl(ctx context.Context, str string) (time.Duration, error) {
+	key := fmt.Sprintf("%s:%s", c.Prefix, str)
+	conn, err := c.Conn.GetContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	ms, err := redis.Int64(redis.DoContext(conn, ctx, "PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+
+	switch ms {
+	case -2:
+		return 0, ErrNotFound
+	case -1:
+		return NoExpiration, nil
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// toInt64 converts a cached value to an int64 for use as a counter
+func toInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+		return n, nil
+	}
+
+	return 0, ErrNotInteger
+}
@@ -1,6 +1,9 @@
 package cache
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestRedisCache_Has( t *testing.T) {
 	err := testRedisCache.Forget("foo")
@@ -153,4 +156,165 @@ func TestEncodeDecode(t *testing.T) {
 		t.Error(err)
 	}
 
-}
\ No newline at end of file
+}
+func TestRedisCache_GetMany(t *testing.T) {
+	err := testRedisCache.SetMany(map[string]interface{}{"one": "1", "two": 2})
+	if err != nil {
+		t.Error(err)
+	}
+
+	items, err := testRedisCache.GetMany("one", "two", "missing")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if items["one"] != "1" || items["two"] != 2 {
+		t.Error("did not get correct values from cache:", items)
+	}
+
+	if _, ok := items["missing"]; ok {
+		t.Error("missing found in cache, and it should not be there")
+	}
+}
+
+func TestRedisCache_Increment(t *testing.T) {
+	_ = testRedisCache.Forget("counter")
+
+	n, err := testRedisCache.Increment("counter", 2, 60)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 2 {
+		t.Error("expected counter to be 2, but got", n)
+	}
+
+	n, err = testRedisCache.Decrement("counter", 1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 1 {
+		t.Error("expected counter to be 1, but got", n)
+	}
+
+	x, err := testRedisCache.Get("counter")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if x != int64(1) {
+		t.Error("did not get counter value from cache")
+	}
+
+	ttl, err := testRedisCache.TTL("counter")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ttl <= 0 {
+		t.Error("expected counter to have a ttl, but got", ttl)
+	}
+
+	_ = testRedisCache.Set("not-a-counter", "foo")
+	_, err = testRedisCache.Increment("not-a-counter", 1)
+	if err != ErrNotInteger {
+		t.Error("expected ErrNotInteger, but got", err)
+	}
+}
+
+// TestCache_Counters checks that every backend counts alike, including numbers stored with Set
+func TestCache_Counters(t *testing.T) {
+	for name, c := range map[string]Cache{"redis": &testRedisCache, "badger": &testBadgerCache} {
+		_ = c.Set("set-number", 5)
+		n, err := c.Increment("set-number", 2)
+		if err != nil || n != 7 {
+			t.Errorf("%s: expected a number stored with Set to be incremented to 7, got %d %v", name, n, err)
+		}
+
+		x, err := c.Get("set-number")
+		if err != nil || x != int64(7) {
+			t.Errorf("%s: expected Get to return int64(7), got %#v %v", name, x, err)
+		}
+
+		_ = c.Set("set-string", "5")
+		if n, err = c.Decrement("set-string", 1); err != nil || n != 4 {
+			t.Errorf("%s: expected a numeric string to be decremented to 4, got %d %v", name, n, err)
+		}
+
+		for _, value := range []interface{}{1.5, "foo", true} {
+			_ = c.Set("not-a-counter", value)
+			if _, err = c.Increment("not-a-counter", 1); err != ErrNotInteger {
+				t.Errorf("%s: expected ErrNotInteger for %#v, got %v", name, value, err)
+			}
+		}
+
+		// a counter keeps the expiry it was stored with
+		_ = c.Set("expiring", 1, 60)
+		if _, err = c.Increment("expiring", 1, 3600); err != nil {
+			t.Error(name, err)
+		}
+		if ttl, err := c.TTL("expiring"); err != nil || ttl <= 0 || ttl > 60*time.Second {
+			t.Errorf("%s: expected the counter to keep its expiry of 60s, got %v %v", name, ttl, err)
+		}
+
+		_ = c.Set("forever", 1)
+		_, _ = c.Increment("forever", 1, 60)
+		if ttl, err := c.TTL("forever"); err != nil || ttl != NoExpiration {
+			t.Errorf("%s: expected the counter to keep not expiring, got %v %v", name, ttl, err)
+		}
+
+		// a new counter gets the given expiry
+		_ = c.Forget("fresh")
+		_, _ = c.Increment("fresh", 1, 60)
+		if ttl, err := c.TTL("fresh"); err != nil || ttl <= 0 || ttl > 60*time.Second {
+			t.Errorf("%s: expected a new counter to expire in 60s, got %v %v", name, ttl, err)
+		}
+	}
+}
+
+func TestRedisCache_Add(t *testing.T) {
+	_ = testRedisCache.Forget("flag")
+
+	added, err := testRedisCache.Add("flag", true)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !added {
+		t.Error("flag was not added, and it should have been")
+	}
+
+	added, err = testRedisCache.Add("flag", false)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if added {
+		t.Error("flag was added twice")
+	}
+
+	x, _ := testRedisCache.Get("flag")
+	if x != true {
+		t.Error("flag was overwritten by Add")
+	}
+}
+
+func TestRedisCache_TTL(t *testing.T) {
+	_ = testRedisCache.Forget("forever")
+
+	_, err := testRedisCache.TTL("forever")
+	if err != ErrNotFound {
+		t.Error("expected ErrNotFound, but got", err)
+	}
+
+	_ = testRedisCache.Set("forever", "foo")
+	ttl, err := testRedisCache.TTL("forever")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ttl != NoExpiration {
+		t.Error("expected NoExpiration, but got", ttl)
+	}
+}
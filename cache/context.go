@@ -0,0 +1,445 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+	"github.com/gomodule/redigo/redis"
+)
+
+// ErrCircuitOpen is returned without contacting the backend while the circuit breaker is open
+var ErrCircuitOpen = errors.New("cache: circuit breaker is open")
+
+// ContextCache is the context-aware variant of Cache. Every call honours the deadline and
+// cancellation of the context it is given.
+type ContextCache interface {
+	Has(context.Context, string) (bool, error)
+	Get(context.Context, string) (interface{}, error)
+	Set(context.Context, string, interface{}, ...int) error
+	Forget(context.Context, string) error
+	EmptyByMatch(context.Context, string) error
+	Empty(context.Context) error
+	GetMany(context.Context, ...string) (map[string]interface{}, error)
+	SetMany(context.Context, map[string]interface{}, ...int) error
+	Increment(context.Context, string, int64, ...int) (int64, error)
+	Decrement(context.Context, string, int64, ...int) (int64, error)
+	Add(context.Context, string, interface{}, ...int) (bool, error)
+	TTL(context.Context, string) (time.Duration, error)
+}
+
+// ContextProvider is implemented by caches whose backend calls can be cancelled through a
+// context. TimeoutCache uses it, so that a call that times out stops and gives back its
+// connection rather than running on.
+type ContextProvider interface {
+	WithContext() ContextCache
+}
+
+// CircuitBreaker stops calls to a failing backend. After Threshold consecutive failures it
+// opens and rejects calls with ErrCircuitOpen for Cooldown; after that a single trial call is
+// let through, which closes the breaker again if it succeeds.
+type CircuitBreaker struct {
+	Threshold int
+	Cooldown time.Duration
+
+	mu sync.Mutex
+	failures int
+	openUntil time.Time
+	trial bool
+}
+
+// Allow reports whether a call may go ahead
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.Threshold <= 0 || cb.failures < cb.Threshold {
+		return true
+	}
+
+	if time.Now().Before(cb.openUntil) || cb.trial {
+		return false
+	}
+
+	// half open: let one call through to probe the backend
+	cb.trial = true
+	return true
+}
+
+// Success records a successful call and closes the breaker
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures = 0
+	cb.trial = false
+}
+
+// Abandon records a call that its caller gave up on. It says nothing about the backend, so
+// it counts as neither a success nor a failure, but it ends a trial so that a later call can
+// probe the backend instead.
+func (cb *CircuitBreaker) Abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.trial = false
+}
+
+// Failure records a failed call, opening the breaker once Threshold is reached
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.trial = false
+	if cb.Threshold > 0 && cb.failures >= cb.Threshold {
+		cb.openUntil = time.Now().Add(cb.Cooldown)
+	}
+}
+
+// Open reports whether the breaker is currently rejecting calls
+func (cb *CircuitBreaker) Open() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return cb.Threshold > 0 && cb.failures >= cb.Threshold && time.Now().Before(cb.openUntil)
+}
+
+// TimeoutCache implements ContextCache on top of any Cache. Calls whose context has no
+// deadline are given Timeout. When Cache is a ContextProvider, such as RedisCache, the
+// context is passed on and cancels the backend call itself; for other caches, callers stop
+// waiting as soon as the context is done, but the backend call runs on. An optional Breaker
+// makes calls fail fast while the backend is down.
+type TimeoutCache struct {
+	Cache Cache
+	Timeout time.Duration
+	Breaker *CircuitBreaker
+}
+
+// NewTimeoutCache returns a TimeoutCache wrapping c
+func NewTimeoutCache(c Cache, timeout time.Duration, breaker *CircuitBreaker) *TimeoutCache {
+	return &TimeoutCache{
+		Cache: c,
+		Timeout: timeout,
+		Breaker: breaker,
+	}
+}
+
+type result[T any] struct {
+	value T
+	err error
+}
+
+// backend returns Cache as a ContextCache, passing contexts on when it can take them
+func (tc *TimeoutCache) backend() ContextCache {
+	if p, ok := tc.Cache.(ContextProvider); ok {
+		return p.WithContext()
+	}
+	return &uncancellableCache{cache: tc.Cache}
+}
+
+// call runs fn against the backend, subject to the context, the default timeout and the
+// circuit breaker
+func call[T any](tc *TimeoutCache, ctx context.Context, fn func(ContextCache, context.Context) (T, error)) (T, error) {
+	var zero T
+
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+
+	if tc.Breaker != nil && !tc.Breaker.Allow() {
+		return zero, ErrCircuitOpen
+	}
+
+	if _, ok := ctx.Deadline(); !ok && tc.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tc.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan result[T], 1)
+	go func() {
+		value, err := fn(tc.backend(), ctx)
+		done <- result[T]{value, err}
+	}()
+
+	var res result[T]
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		res = result[T]{zero, ctx.Err()}
+	}
+
+	if tc.Breaker != nil {
+		switch {
+		case res.err == nil || isMiss(res.err):
+			tc.Breaker.Success()
+		case errors.Is(res.err, context.Canceled):
+			// the caller gave up, which says nothing about the backend
+			tc.Breaker.Abandon()
+		default:
+			tc.Breaker.Failure()
+		}
+	}
+
+	return res.value, res.err
+}
+
+// isMiss reports whether err means the backend answered, but the key was missing or unusable
+func isMiss(err error) bool {
+	return errors.Is(err, redis.ErrNil) ||
+		errors.Is(err, badger.ErrKeyNotFound) ||
+		errors.Is(err, ErrNotFound) ||
+		errors.Is(err, ErrNotInteger)
+}
+
+func (tc *TimeoutCache) Has(ctx context.Context, str string) (bool, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (bool, error) {
+		return cc.Has(ctx, str)
+	})
+}
+
+func (tc *TimeoutCache) Get(ctx context.Context, str string) (interface{}, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (interface{}, error) {
+		return cc.Get(ctx, str)
+	})
+}
+
+func (tc *TimeoutCache) Set(ctx context.Context, str string, value interface{}, expires ...int) error {
+	_, err := call(tc, ctx, func(cc ContextCache, ctx context.Context) (struct{}, error) {
+		return struct{}{}, cc.Set(ctx, str, value, expires...)
+	})
+	return err
+}
+
+func (tc *TimeoutCache) Forget(ctx context.Context, str string) error {
+	_, err := call(tc, ctx, func(cc ContextCache, ctx context.Context) (struct{}, error) {
+		return struct{}{}, cc.Forget(ctx, str)
+	})
+	return err
+}
+
+func (tc *TimeoutCache) EmptyByMatch(ctx context.Context, str string) error {
+	_, err := call(tc, ctx, func(cc ContextCache, ctx context.Context) (struct{}, error) {
+		return struct{}{}, cc.EmptyByMatch(ctx, str)
+	})
+	return err
+}
+
+func (tc *TimeoutCache) Empty(ctx context.Context) error {
+	_, err := call(tc, ctx, func(cc ContextCache, ctx context.Context) (struct{}, error) {
+		return struct{}{}, cc.Empty(ctx)
+	})
+	return err
+}
+
+func (tc *TimeoutCache) GetMany(ctx context.Context, strs ...string) (map[string]interface{}, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (map[string]interface{}, error) {
+		return cc.GetMany(ctx, strs...)
+	})
+}
+
+func (tc *TimeoutCache) SetMany(ctx context.Context, values map[string]interface{}, expires ...int) error {
+	_, err := call(tc, ctx, func(cc ContextCache, ctx context.Context) (struct{}, error) {
+		return struct{}{}, cc.SetMany(ctx, values, expires...)
+	})
+	return err
+}
+
+func (tc *TimeoutCache) Increment(ctx context.Context, str string, by int64, expires ...int) (int64, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (int64, error) {
+		return cc.Increment(ctx, str, by, expires...)
+	})
+}
+
+func (tc *TimeoutCache) Decrement(ctx context.Context, str string, by int64, expires ...int) (int64, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (int64, error) {
+		return cc.Decrement(ctx, str, by, expires...)
+	})
+}
+
+func (tc *TimeoutCache) Add(ctx context.Context, str string, value interface{}, expires ...int) (bool, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (bool, error) {
+		return cc.Add(ctx, str, value, expires...)
+	})
+}
+
+func (tc *TimeoutCache) TTL(ctx context.Context, str string) (time.Duration, error) {
+	return call(tc, ctx, func(cc ContextCache, ctx context.Context) (time.Duration, error) {
+		return cc.TTL(ctx, str)
+	})
+}
+
+// Background adapts a ContextCache to the Cache interface, so existing code keeps working.
+// Each call uses context.Background(), so a TimeoutCache still applies its default timeout
+// and circuit breaker.
+func Background(cc ContextCache) Cache {
+	return &backgroundCache{cache: cc}
+}
+
+type backgroundCache struct {
+	cache ContextCache
+}
+
+func (b *backgroundCache) Has(str string) (bool, error) {
+	return b.cache.Has(context.Background(), str)
+}
+
+func (b *backgroundCache) Get(str string) (interface{}, error) {
+	return b.cache.Get(context.Background(), str)
+}
+
+func (b *backgroundCache) Set(str string, value interface{}, expires ...int) error {
+	return b.cache.Set(context.Background(), str, value, expires...)
+}
+
+func (b *backgroundCache) Forget(str string) error {
+	return b.cache.Forget(context.Background(), str)
+}
+
+func (b *backgroundCache) EmptyByMatch(str string) error {
+	return b.cache.EmptyByMatch(context.Background(), str)
+}
+
+func (b *backgroundCache) Empty() error {
+	return b.cache.Empty(context.Background())
+}
+
+func (b *backgroundCache) GetMany(strs ...string) (map[string]interface{}, error) {
+	return b.cache.GetMany(context.Background(), strs...)
+}
+
+func (b *backgroundCache) SetMany(values map[string]interface{}, expires ...int) error {
+	return b.cache.SetMany(context.Background(), values, expires...)
+}
+
+func (b *backgroundCache) Increment(str string, by int64, expires ...int) (int64, error) {
+	return b.cache.Increment(context.Background(), str, by, expires...)
+}
+
+func (b *backgroundCache) Decrement(str string, by int64, expires ...int) (int64, error) {
+	return b.cache.Decrement(context.Background(), str, by, expires...)
+}
+
+func (b *backgroundCache) Add(str string, value interface{}, expires ...int) (bool, error) {
+	return b.cache.Add(context.Background(), str, value, expires...)
+}
+
+func (b *backgroundCache) TTL(str string) (time.Duration, error) {
+	return b.cache.TTL(context.Background(), str)
+}
+
+// uncancellableCache adapts a Cache that knows nothing of contexts to ContextCache. The
+// contexts are ignored; TimeoutCache stops waiting for such calls on its own.
+type uncancellableCache struct {
+	cache Cache
+}
+
+func (u *uncancellableCache) Has(_ context.Context, str string) (bool, error) {
+	return u.cache.Has(str)
+}
+
+func (u *uncancellableCache) Get(_ context.Context, str string) (interface{}, error) {
+	return u.cache.Get(str)
+}
+
+func (u *uncancellableCache) Set(_ context.Context, str string, value interface{}, expires ...int) error {
+	return u.cache.Set(str, value, expires...)
+}
+
+func (u *uncancellableCache) Forget(_ context.Context, str string) error {
+	return u.cache.Forget(str)
+}
+
+func (u *uncancellableCache) EmptyByMatch(_ context.Context, str string) error {
+	return u.cache.EmptyByMatch(str)
+}
+
+func (u *uncancellableCache) Empty(_ context.Context) error {
+	return u.cache.Empty()
+}
+
+func (u *uncancellableCache) GetMany(_ context.Context, strs ...string) (map[string]interface{}, error) {
+	return u.cache.GetMany(strs...)
+}
+
+func (u *uncancellableCache) SetMany(_ context.Context, values map[string]interface{}, expires ...int) error {
+	return u.cache.SetMany(values, expires...)
+}
+
+func (u *uncancellableCache) Increment(_ context.Context, str string, by int64, expires ...int) (int64, error) {
+	return u.cache.Increment(str, by, expires...)
+}
+
+func (u *uncancellableCache) Decrement(_ context.Context, str string, by int64, expires ...int) (int64, error) {
+	return u.cache.Decrement(str, by, expires...)
+}
+
+func (u *uncancellableCache) Add(_ context.Context, str string, value interface{}, expires ...int) (bool, error) {
+	return u.cache.Add(str, value, expires...)
+}
+
+func (u *uncancellableCache) TTL(_ context.Context, str string) (time.Duration, error) {
+	return u.cache.TTL(str)
+}
+
+// WithContext returns c as a ContextCache. Its calls take connections with Pool.GetContext
+// and run commands with redis.DoContext, so a cancelled context stops the call and frees
+// the connection.
+func (c *RedisCache) WithContext() ContextCache {
+	return &redisContextCache{cache: c}
+}
+
+type redisContextCache struct {
+	cache *RedisCache
+}
+
+func (r *redisContextCache) Has(ctx context.Context, str string) (bool, error) {
+	return r.cache.has(ctx, str)
+}
+
+func (r *redisContextCache) Get(ctx context.Context, str string) (interface{}, error) {
+	return r.cache.get(ctx, str)
+}
+
+func (r *redisContextCache) Set(ctx context.Context, str string, value interface{}, expires ...int) error {
+	return r.cache.set(ctx, str, value, expires...)
+}
+
+func (r *redisContextCache) Forget(ctx context.Context, str string) error {
+	return r.cache.forget(ctx, str)
+}
+
+func (r *redisContextCache) EmptyByMatch(ctx context.Context, str string) error {
+	return r.cache.emptyByMatch(ctx, str)
+}
+
+func (r *redisContextCache) Empty(ctx context.Context) error {
+	return r.cache.empty(ctx)
+}
+
+func (r *redisContextCache) GetMany(ctx context.Context, strs ...string) (map[string]interface{}, error) {
+	return r.cache.getMany(ctx, strs...)
+}
+
+func (r *redisContextCache) SetMany(ctx context.Context, values map[string]interface{}, expires ...int) error {
+	return r.cache.setMany(ctx, values, expires...)
+}
+
+func (r *redisContextCache) Increment(ctx context.Context, str string, by int64, expires ...int) (int64, error) {
+	return r.cache.increment(ctx, str, by, expires...)
+}
+
+func (r *redisContextCache) Decrement(ctx context.Context, str string, by int64, expires ...int) (int64, error) {
+	return r.cache.increment(ctx, str, -by, expires...)
+}
+
+func (r *redisContextCache) Add(ctx context.Context, str string, value interface{}, expires ...int) (bool, error) {
+	return r.cache.add(ctx, str, value, expires...)
+}
+
+func (r *redisContextCache) TTL(ctx context.Context, str string) (time.Duration, error) {
+	return r.cache.ttl(ctx, str)
+}
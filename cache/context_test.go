@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// slowCache is a Cache whose Get blocks for delay and then fails with err
+type slowCache struct {
+	Cache
+	delay time.Duration
+	err error
+}
+
+func (s *slowCache) Get(str string) (interface{}, error) {
+	time.Sleep(s.delay)
+	return nil, s.err
+}
+
+func TestTimeoutCache_Get(t *testing.T) {
+	_ = testBadgerCache.Set("foo", "bar")
+
+	tc := NewTimeoutCache(&testBadgerCache, time.Second, nil)
+	x, err := tc.Get(context.Background(), "foo")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if x != "bar" {
+		t.Error("did not get correct value from cache")
+	}
+}
+
+func TestTimeoutCache_Timeout(t *testing.T) {
+	tc := NewTimeoutCache(&slowCache{delay: time.Second}, 20*time.Millisecond, nil)
+
+	start := time.Now()
+	_, err := tc.Get(context.Background(), "foo")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, but got", err)
+	}
+
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("call was not abandoned when the timeout passed")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	tc.Timeout = time.Minute
+	_, err = tc.Get(ctx, "foo")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected the caller's deadline to be used, but got", err)
+	}
+}
+
+func TestTimeoutCache_CircuitBreaker(t *testing.T) {
+	backend := &slowCache{err: errors.New("connection refused")}
+	breaker := &CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}
+	tc := NewTimeoutCache(backend, time.Second, breaker)
+
+	for i := 0; i < 2; i++ {
+		_, _ = tc.Get(context.Background(), "foo")
+	}
+
+	if !breaker.Open() {
+		t.Error("breaker did not open after reaching the threshold")
+	}
+
+	_, err := tc.Get(context.Background(), "foo")
+	if err != ErrCircuitOpen {
+		t.Error("expected ErrCircuitOpen, but got", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	backend.err = ErrNotFound
+
+	_, err = tc.Get(context.Background(), "foo")
+	if err != ErrNotFound {
+		t.Error("expected the trial call to reach the backend, but got", err)
+	}
+
+	if breaker.Open() {
+		t.Error("a cache miss should close the breaker")
+	}
+}
+
+func TestTimeoutCache_CancelledTrial(t *testing.T) {
+	backend := &slowCache{err: errors.New("connection refused")}
+	breaker := &CircuitBreaker{Threshold: 1, Cooldown: 10 * time.Millisecond}
+	tc := NewTimeoutCache(backend, time.Second, breaker)
+
+	_, _ = tc.Get(context.Background(), "foo")
+	time.Sleep(20 * time.Millisecond)
+
+	// the caller gives up on the trial call
+	backend.delay = time.Second
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, err := tc.Get(ctx, "foo")
+	if !errors.Is(err, context.Canceled) {
+		t.Error("expected context.Canceled, but got", err)
+	}
+
+	// which must not leave the breaker waiting for a trial that never ends
+	backend.delay = 0
+	backend.err = ErrNotFound
+	_, err = tc.Get(context.Background(), "foo")
+	if err != ErrNotFound {
+		t.Error("expected a new trial call to reach the backend, but got", err)
+	}
+}
+
+func TestTimeoutCache_CancelsRedis(t *testing.T) {
+	// a server that accepts connections and never answers
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	pool := &redis.Pool{
+		MaxActive: 1,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", l.Addr().String())
+		},
+	}
+	defer pool.Close()
+
+	tc := NewTimeoutCache(&RedisCache{Conn: pool, Prefix: "test"}, 20*time.Millisecond, nil)
+
+	// redigo turns the deadline into a read timeout, or the context's error if that comes first
+	start := time.Now()
+	if _, err = tc.Get(context.Background(), "foo"); err == nil {
+		t.Error("expected the call to time out")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("call was not abandoned when the timeout passed")
+	}
+
+	// the command was cancelled, so its connection went back to the pool
+	deadline := time.Now().Add(time.Second)
+	for pool.ActiveCount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := pool.ActiveCount(); n != 0 {
+		t.Errorf("expected no active connections, got %d", n)
+	}
+}
+
+func TestBackground(t *testing.T) {
+	c := Background(NewTimeoutCache(&testRedisCache, time.Second, &CircuitBreaker{Threshold: 5, Cooldown: time.Second}))
+
+	err := c.Set("alpha", "beta")
+	if err != nil {
+		t.Error(err)
+	}
+
+	x, err := c.Get("alpha")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if x != "beta" {
+		t.Error("did not get correct value from cache")
+	}
+
+	_ = c.Forget("alpha")
+}
@@ -0,0 +1,109 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Namespace returns a cache scoped to name within c. Keys written through the returned cache
+// are stored as name:key inside c, and calling Empty on it only removes keys in that
+// namespace. Namespaces can be nested, e.g. Namespace(Namespace(c, "users"), "sessions").
+func Namespace(c Cache, name string) Cache {
+	switch x := c.(type) {
+	case *RedisCache:
+		return &RedisCache{
+			Conn: x.Conn,
+			Prefix: fmt.Sprintf("%s:%s", x.Prefix, name),
+		}
+	case *BadgerCache:
+		return &BadgerCache{
+			Conn: x.Conn,
+			Prefix: fmt.Sprintf("%s:%s", x.Prefix, name),
+		}
+	default:
+		return &namespacedCache{
+			cache: c,
+			name: name,
+		}
+	}
+}
+
+// namespacedCache scopes any Cache implementation by prefixing its keys
+type namespacedCache struct {
+	cache Cache
+	name string
+}
+
+func (n *namespacedCache) key(str string) string {
+	return fmt.Sprintf("%s:%s", n.name, str)
+}
+
+func (n *namespacedCache) Has(str string) (bool, error) {
+	return n.cache.Has(n.key(str))
+}
+
+func (n *namespacedCache) Get(str string) (interface{}, error) {
+	return n.cache.Get(n.key(str))
+}
+
+func (n *namespacedCache) Set(str string, value interface{}, expires ...int) error {
+	return n.cache.Set(n.key(str), value, expires...)
+}
+
+func (n *namespacedCache) Forget(str string) error {
+	return n.cache.Forget(n.key(str))
+}
+
+func (n *namespacedCache) EmptyByMatch(str string) error {
+	return n.cache.EmptyByMatch(n.key(str))
+}
+
+func (n *namespacedCache) Empty() error {
+	return n.cache.EmptyByMatch(n.key(""))
+}
+
+func (n *namespacedCache) GetMany(strs ...string) (map[string]interface{}, error) {
+	keys := make([]string, len(strs))
+	for i, str := range strs {
+		keys[i] = n.key(str)
+	}
+
+	found, err := n.cache.GetMany(keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make(map[string]interface{}, len(found))
+	for i, key := range keys {
+		if value, ok := found[key]; ok {
+			items[strs[i]] = value
+		}
+	}
+
+	return items, nil
+}
+
+func (n *namespacedCache) SetMany(values map[string]interface{}, expires ...int) error {
+	scoped := make(map[string]interface{}, len(values))
+	for str, value := range values {
+		scoped[n.key(str)] = value
+	}
+
+	return n.cache.SetMany(scoped, expires...)
+}
+
+func (n *namespacedCache) Increment(str string, by int64, expires ...int) (int64, error) {
+	return n.cache.Increment(n.key(str), by, expires...)
+}
+
+func (n *namespacedCache) Decrement(str string, by int64, expires ...int) (int64, error) {
+	return n.cache.Decrement(n.key(str), by, expires...)
+}
+
+func (n *namespacedCache) Add(str string, value interface{}, expires ...int) (bool, error) {
+	return n.cache.Add(n.key(str), value, expires...)
+}
+
+func (n *namespacedCache) TTL(str string) (time.Duration, error) {
+	return n.cache.TTL(n.key(str))
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestBadgerCache_EmptyKeepsOtherKeys(t *testing.T) {
+	err := testBadgerCache.Conn.Update(func(txn *badger.Txn) error {
+		return txn.Set([]byte("not-a-cache-key"), []byte("foo"))
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	_ = testBadgerCache.Set("alpha", "beta")
+
+	err = testBadgerCache.Empty()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = testBadgerCache.Conn.View(func(txn *badger.Txn) error {
+		_, err := txn.Get([]byte("not-a-cache-key"))
+		return err
+	})
+	if err != nil {
+		t.Error("Empty removed a key outside of the cache prefix:", err)
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	caches := map[string]Cache{
+		"redis": &testRedisCache,
+		"badger": &testBadgerCache,
+		"generic": &namespacedCache{cache: &testBadgerCache, name: "generic"},
+	}
+
+	for name, c := range caches {
+		users := Namespace(c, "users")
+
+		err := c.Set("alpha", "parent")
+		if err != nil {
+			t.Error(name, err)
+		}
+
+		err = users.Set("alpha", "child")
+		if err != nil {
+			t.Error(name, err)
+		}
+
+		x, _ := c.Get("alpha")
+		if x != "parent" {
+			t.Error(name, "namespaced Set overwrote the parent key")
+		}
+
+		x, _ = users.Get("alpha")
+		if x != "child" {
+			t.Error(name, "did not get correct value from namespace")
+		}
+
+		items, err := users.GetMany("alpha")
+		if err != nil {
+			t.Error(name, err)
+		}
+
+		if items["alpha"] != "child" {
+			t.Error(name, "GetMany did not map namespaced keys back:", items)
+		}
+
+		err = users.Empty()
+		if err != nil {
+			t.Error(name, err)
+		}
+
+		inCache, _ := users.Has("alpha")
+		if inCache {
+			t.Error(name, "alpha found in namespace after Empty, and it shouldn't be there")
+		}
+
+		inCache, _ = c.Has("alpha")
+		if !inCache {
+			t.Error(name, "emptying the namespace removed the parent key")
+		}
+
+		_ = c.Forget("alpha")
+	}
+}
@@ -0,0 +1,663 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// clusterSlots is the number of hash slots in a redis cluster
+const clusterSlots = 16384
+
+// maxRedirects is how many MOVED/ASK redirections a command may follow
+const maxRedirects = 5
+
+// redisCluster routes commands to the nodes of a redis cluster, keeping a map from hash slot
+// to node address that is refreshed with CLUSTER SLOTS whenever the cluster redirects us
+type redisCluster struct {
+	seeds []string
+	dialOptions []redis.DialOption
+	maxIdle int
+	idleTimeout time.Duration
+
+	mu sync.RWMutex
+	slots [clusterSlots]string
+	masters []string
+	pools map[string]*redis.Pool
+}
+
+func newRedisCluster(seeds []string, opts RedisOptions) *redisCluster {
+	return &redisCluster{
+		seeds: seeds,
+		dialOptions: opts.dialOptions(),
+		maxIdle: opts.MaxIdle,
+		idleTimeout: opts.IdleTimeout,
+		pools: make(map[string]*redis.Pool),
+	}
+}
+
+// refresh reloads the slot map from the first node that answers CLUSTER SLOTS
+func (c *redisCluster) refresh() error {
+	c.mu.RLock()
+	candidates := append(append([]string{}, c.masters...), c.seeds...)
+	c.mu.RUnlock()
+
+	var lastErr error
+	for _, addr := range candidates {
+		conn := c.pool(addr).Get()
+		reply, err := redis.Values(conn.Do("CLUSTER", "SLOTS"))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		host, _, _ := net.SplitHostPort(addr)
+
+		var slots [clusterSlots]string
+		var masters []string
+		seen := make(map[string]bool)
+
+		for _, r := range reply {
+			entry, err := redis.Values(r, nil)
+			if err != nil || len(entry) < 3 {
+				continue
+			}
+
+			start, _ := redis.Int(entry[0], nil)
+			end, _ := redis.Int(entry[1], nil)
+			node, err := redis.Values(entry[2], nil)
+			if err != nil || len(node) < 2 {
+				continue
+			}
+
+			nodeHost, _ := redis.String(node[0], nil)
+			nodePort, _ := redis.Int(node[1], nil)
+			if nodeHost == "" {
+				// an empty host means the node we asked
+				nodeHost = host
+			}
+
+			master := net.JoinHostPort(nodeHost, strconv.Itoa(nodePort))
+			for slot := start; slot <= end && slot < clusterSlots; slot++ {
+				slots[slot] = master
+			}
+
+			if !seen[master] {
+				seen[master] = true
+				masters = append(masters, master)
+			}
+		}
+
+		if len(masters) == 0 {
+			lastErr = errors.New("cache: CLUSTER SLOTS returned no nodes")
+			continue
+		}
+
+		c.mu.Lock()
+		c.slots = slots
+		c.masters = masters
+		c.mu.Unlock()
+
+		return nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("cache: no redis cluster nodes configured")
+	}
+
+	return lastErr
+}
+
+// pool returns the connection pool for the node at addr, creating it if needed
+func (c *redisCluster) pool(addr string) *redis.Pool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if p, ok := c.pools[addr]; ok {
+		return p
+	}
+
+	p := &redis.Pool{
+		MaxIdle: c.maxIdle,
+		IdleTimeout: c.idleTimeout,
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", addr, c.dialOptions...)
+		},
+	}
+	c.pools[addr] = p
+
+	return p
+}
+
+// addrForSlot returns the node serving slot, loading the slot map on first use
+func (c *redisCluster) addrForSlot(slot int) (string, error) {
+	c.mu.RLock()
+	addr := ""
+	if slot >= 0 {
+		addr = c.slots[slot]
+	} else if len(c.masters) > 0 {
+		addr = c.masters[0]
+	}
+	c.mu.RUnlock()
+
+	if addr != "" {
+		return addr, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return "", err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if slot >= 0 {
+		addr = c.slots[slot]
+	} else if len(c.masters) > 0 {
+		addr = c.masters[0]
+	}
+
+	if addr == "" {
+		return "", fmt.Errorf("cache: no redis cluster node serves slot %d", slot)
+	}
+
+	return addr, nil
+}
+
+// nodes returns the address of every master in the cluster
+func (c *redisCluster) nodes() ([]string, error) {
+	c.mu.RLock()
+	masters := append([]string{}, c.masters...)
+	c.mu.RUnlock()
+
+	if len(masters) > 0 {
+		return masters, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]string{}, c.masters...), nil
+}
+
+// command is a single queued redis command
+type command struct {
+	name string
+	args []interface{}
+}
+
+// clusterReply is the outcome of one command
+type clusterReply struct {
+	value interface{}
+	err error
+}
+
+// exec runs a batch of commands, keeping MULTI ... EXEC blocks together on one node and
+// routing every other command by its key
+func (c *redisCluster) exec(ctx context.Context, cmds []command) []clusterReply {
+	var replies []clusterReply
+
+	for i := 0; i < len(cmds); i++ {
+		if strings.EqualFold(cmds[i].name, "MULTI") {
+			end := i
+			for end < len(cmds)-1 && !strings.EqualFold(cmds[end].name, "EXEC") && !strings.EqualFold(cmds[end].name, "DISCARD") {
+				end++
+			}
+			replies = append(replies, c.execOnSlot(ctx, cmds[i:end+1])...)
+			i = end
+			continue
+		}
+
+		replies = append(replies, c.execOne(ctx, cmds[i]))
+	}
+
+	return replies
+}
+
+// execOne runs a single command, fanning it out to every node when it is not tied to a key
+func (c *redisCluster) execOne(ctx context.Context, cmd command) clusterReply {
+	switch strings.ToUpper(cmd.name) {
+	case "KEYS":
+		return c.fanOutKeys(ctx, cmd)
+	case "SCAN":
+		return c.scanAll(ctx, cmd)
+	case "FLUSHALL", "FLUSHDB":
+		return c.fanOutAll(ctx, cmd)
+	case "MGET":
+		return c.mget(ctx, cmd)
+	case "DEL", "UNLINK", "EXISTS":
+		if len(cmd.args) > 1 {
+			return c.sumPerKey(ctx, cmd)
+		}
+	}
+
+	return c.execOnSlot(ctx, []command{cmd})[0]
+}
+
+// execOnSlot runs cmds on the node serving the first key among them, following MOVED and ASK
+// redirections
+func (c *redisCluster) execOnSlot(ctx context.Context, cmds []command) []clusterReply {
+	slot := -1
+	for _, cmd := range cmds {
+		if key, ok := commandKey(cmd); ok {
+			slot = keySlot(key)
+			break
+		}
+	}
+
+	addr, err := c.addrForSlot(slot)
+	if err != nil {
+		return failAll(cmds, err)
+	}
+
+	asking := false
+	for attempt := 0; ; attempt++ {
+		replies, err := c.execOn(ctx, addr, cmds, asking)
+		if err != nil {
+			// the node may have gone away; reload the slot map once and try again, unless the
+			// caller gave up
+			if attempt == 0 && ctx.Err() == nil && c.refresh() == nil {
+				if addr, err = c.addrForSlot(slot); err == nil {
+					continue
+				}
+			}
+			return failAll(cmds, err)
+		}
+
+		redirect, movedSlot, target, ok := findRedirect(replies)
+		if !ok || attempt >= maxRedirects {
+			return replies
+		}
+
+		if redirect == "MOVED" {
+			// the slot has a new owner for good; reload the map, and trust the redirect for
+			// this slot even if the node we asked has not caught up yet
+			_ = c.refresh()
+			c.mu.Lock()
+			c.slots[movedSlot] = target
+			c.mu.Unlock()
+			asking = false
+		} else {
+			asking = true
+		}
+		addr = target
+	}
+}
+
+// execOn pipelines cmds to the node at addr, giving up when ctx is done
+func (c *redisCluster) execOn(ctx context.Context, addr string, cmds []command, asking bool) ([]clusterReply, error) {
+	conn, err := c.pool(addr).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if asking {
+		if err := conn.Send("ASKING"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd.name, cmd.args...); err != nil {
+			return nil, err
+		}
+	}
+
+	values, err := redis.Values(redis.DoContext(conn, ctx, ""))
+	if err != nil {
+		return nil, err
+	}
+
+	if asking {
+		values = values[1:]
+	}
+
+	replies := make([]clusterReply, len(values))
+	for i, v := range values {
+		if e, ok := v.(redis.Error); ok {
+			replies[i] = clusterReply{err: e}
+		} else {
+			replies[i] = clusterReply{value: v}
+		}
+	}
+
+	return replies, nil
+}
+
+// fanOutAll runs cmd on every master, returning the first error
+func (c *redisCluster) fanOutAll(ctx context.Context, cmd command) clusterReply {
+	nodes, err := c.nodes()
+	if err != nil {
+		return clusterReply{err: err}
+	}
+
+	var last clusterReply
+	for _, addr := range nodes {
+		replies, err := c.execOn(ctx, addr, []command{cmd}, false)
+		if err != nil {
+			return clusterReply{err: err}
+		}
+		if replies[0].err != nil {
+			return replies[0]
+		}
+		last = replies[0]
+	}
+
+	return last
+}
+
+// fanOutKeys runs KEYS on every master and merges the results
+func (c *redisCluster) fanOutKeys(ctx context.Context, cmd command) clusterReply {
+	nodes, err := c.nodes()
+	if err != nil {
+		return clusterReply{err: err}
+	}
+
+	var keys []interface{}
+	for _, addr := range nodes {
+		replies, err := c.execOn(ctx, addr, []command{cmd}, false)
+		if err != nil {
+			return clusterReply{err: err}
+		}
+		if replies[0].err != nil {
+			return replies[0]
+		}
+
+		values, _ := redis.Values(replies[0].value, nil)
+		keys = append(keys, values...)
+	}
+
+	return clusterReply{value: keys}
+}
+
+// scanAll answers a SCAN by iterating every master to completion, and returns the whole
+// result with a zero cursor so callers stop after one round
+func (c *redisCluster) scanAll(ctx context.Context, cmd command) clusterReply {
+	nodes, err := c.nodes()
+	if err != nil {
+		return clusterReply{err: err}
+	}
+
+	var keys []interface{}
+	for _, addr := range nodes {
+		cursor := 0
+		for {
+			args := append([]interface{}{cursor}, cmd.args[1:]...)
+			replies, err := c.execOn(ctx, addr, []command{{name: "SCAN", args: args}}, false)
+			if err != nil {
+				return clusterReply{err: err}
+			}
+			if replies[0].err != nil {
+				return replies[0]
+			}
+
+			values, err := redis.Values(replies[0].value, nil)
+			if err != nil || len(values) != 2 {
+				return clusterReply{err: errors.New("cache: unexpected SCAN reply")}
+			}
+
+			cursor, _ = redis.Int(values[0], nil)
+			found, _ := redis.Values(values[1], nil)
+			keys = append(keys, found...)
+
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+
+	return clusterReply{value: []interface{}{[]byte("0"), keys}}
+}
+
+// mget splits an MGET into one GET per key, since the keys may live on different nodes
+func (c *redisCluster) mget(ctx context.Context, cmd command) clusterReply {
+	values := make([]interface{}, len(cmd.args))
+	for i, key := range cmd.args {
+		reply := c.execOnSlot(ctx, []command{{name: "GET", args: []interface{}{key}}})[0]
+		if reply.err != nil {
+			return reply
+		}
+		values[i] = reply.value
+	}
+
+	return clusterReply{value: values}
+}
+
+// sumPerKey splits a multi-key DEL, UNLINK or EXISTS into one command per key and adds up
+// the integer replies
+func (c *redisCluster) sumPerKey(ctx context.Context, cmd command) clusterReply {
+	var total int64
+	for _, key := range cmd.args {
+		reply := c.execOnSlot(ctx, []command{{name: cmd.name, args: []interface{}{key}}})[0]
+		if reply.err != nil {
+			return reply
+		}
+		n, _ := redis.Int64(reply.value, nil)
+		total += n
+	}
+
+	return clusterReply{value: total}
+}
+
+// findRedirect looks for a MOVED or ASK error among replies, returning the kind of redirect,
+// the slot and the address of the node to ask instead
+func findRedirect(replies []clusterReply) (string, int, string, bool) {
+	for _, r := range replies {
+		if r.err == nil {
+			continue
+		}
+
+		parts := strings.Fields(r.err.Error())
+		if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+			continue
+		}
+
+		slot, err := strconv.Atoi(parts[1])
+		if err != nil || slot < 0 || slot >= clusterSlots {
+			continue
+		}
+
+		return parts[0], slot, parts[2], true
+	}
+
+	return "", 0, "", false
+}
+
+func failAll(cmds []command, err error) []clusterReply {
+	replies := make([]clusterReply, len(cmds))
+	for i := range replies {
+		replies[i] = clusterReply{err: err}
+	}
+	return replies
+}
+
+// commandKey returns the key that decides which slot cmd belongs to, if it has one
+func commandKey(cmd command) (string, bool) {
+	switch strings.ToUpper(cmd.name) {
+	case "PING", "MULTI", "EXEC", "DISCARD", "WATCH", "UNWATCH", "INFO", "ROLE", "CLUSTER",
+		"SCRIPT", "SCAN", "KEYS", "FLUSHALL", "FLUSHDB", "DBSIZE", "ASKING", "SELECT", "AUTH":
+		return "", false
+	case "EVAL", "EVALSHA":
+		if len(cmd.args) < 3 {
+			return "", false
+		}
+		if n, _ := redis.Int(cmd.args[1], nil); n < 1 {
+			return "", false
+		}
+		return argString(cmd.args[2]), true
+	}
+
+	if len(cmd.args) == 0 {
+		return "", false
+	}
+
+	return argString(cmd.args[0]), true
+}
+
+func argString(arg interface{}) string {
+	switch v := arg.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// keySlot returns the cluster hash slot for key, honouring {hash tags}
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by redis cluster
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// clusterConn is a redis.Conn that sends each command to the cluster node that owns its key.
+// Pipelined commands are queued by Send and run on Flush, so it can be handed out by a
+// redis.Pool and used by anything that expects a plain connection. It implements
+// redis.ConnWithContext too, so that redis.DoContext stops waiting on the nodes when the
+// context is done.
+type clusterConn struct {
+	cluster *redisCluster
+	pending []command
+	replies []clusterReply
+	closed bool
+}
+
+func (cc *clusterConn) Close() error {
+	cc.closed = true
+	cc.pending = nil
+	cc.replies = nil
+	return nil
+}
+
+func (cc *clusterConn) Err() error {
+	if cc.closed {
+		return errors.New("cache: redis cluster connection closed")
+	}
+	return nil
+}
+
+func (cc *clusterConn) Send(name string, args ...interface{}) error {
+	if err := cc.Err(); err != nil {
+		return err
+	}
+	cc.pending = append(cc.pending, command{name: name, args: args})
+	return nil
+}
+
+func (cc *clusterConn) Flush() error {
+	return cc.flush(context.Background())
+}
+
+func (cc *clusterConn) flush(ctx context.Context) error {
+	if err := cc.Err(); err != nil {
+		return err
+	}
+	if len(cc.pending) > 0 {
+		cc.replies = append(cc.replies, cc.cluster.exec(ctx, cc.pending)...)
+		cc.pending = nil
+	}
+	return nil
+}
+
+func (cc *clusterConn) Receive() (interface{}, error) {
+	return cc.ReceiveContext(context.Background())
+}
+
+func (cc *clusterConn) ReceiveContext(ctx context.Context) (interface{}, error) {
+	if len(cc.replies) == 0 {
+		if err := cc.flush(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cc.replies) == 0 {
+		return nil, errors.New("cache: no pending redis replies")
+	}
+
+	r := cc.replies[0]
+	cc.replies = cc.replies[1:]
+
+	return r.value, r.err
+}
+
+// Do follows redigo's semantics: it flushes anything queued by Send, and returns the reply to
+// name along with the first error among all of the replies. Do("") returns every pending
+// reply.
+func (cc *clusterConn) Do(name string, args ...interface{}) (interface{}, error) {
+	return cc.DoContext(context.Background(), name, args...)
+}
+
+func (cc *clusterConn) DoContext(ctx context.Context, name string, args ...interface{}) (interface{}, error) {
+	if name != "" {
+		if err := cc.Send(name, args...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cc.flush(ctx); err != nil {
+		return nil, err
+	}
+
+	replies := cc.replies
+	cc.replies = nil
+
+	if name == "" {
+		values := make([]interface{}, len(replies))
+		for i, r := range replies {
+			if r.err != nil {
+				values[i] = r.err
+			} else {
+				values[i] = r.value
+			}
+		}
+		return values, nil
+	}
+
+	if len(replies) == 0 {
+		return nil, errors.New("cache: no redis reply")
+	}
+
+	var firstErr error
+	for _, r := range replies {
+		if r.err != nil && firstErr == nil {
+			firstErr = r.err
+		}
+	}
+
+	return replies[len(replies)-1].value, firstErr
+}
@@ -0,0 +1,208 @@
+package cache
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// RedisOptions describes how to reach redis. Set Addr for a single server, SentinelAddrs and
+// SentinelMaster to find the current master through redis sentinel, or ClusterAddrs to route
+// commands across a redis cluster.
+type RedisOptions struct {
+	Addr string
+	Password string
+	DB int
+	TLS bool
+	TLSSkipVerify bool
+	SentinelAddrs []string
+	SentinelMaster string
+	SentinelPassword string
+	ClusterAddrs []string
+	MaxIdle int
+	MaxActive int
+	IdleTimeout time.Duration
+	ConnectTimeout time.Duration
+}
+
+// NewRedisPool returns a connection pool for the redis deployment described by opts. The
+// pool hands out ordinary redigo connections in every mode, so it can be shared by RedisCache
+// and the redis session store.
+func NewRedisPool(opts RedisOptions) *redis.Pool {
+	if opts.MaxIdle == 0 {
+		opts.MaxIdle = 50
+	}
+
+	if opts.MaxActive == 0 {
+		opts.MaxActive = 10000
+	}
+
+	if opts.IdleTimeout == 0 {
+		opts.IdleTimeout = 240 * time.Second
+	}
+
+	pool := &redis.Pool{
+		MaxIdle: opts.MaxIdle,
+		MaxActive: opts.MaxActive,
+		IdleTimeout: opts.IdleTimeout,
+		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
+			_, err := conn.Do("PING")
+			return err
+		},
+	}
+
+	switch {
+	case len(opts.ClusterAddrs) > 0:
+		cluster := newRedisCluster(opts.ClusterAddrs, opts)
+		pool.Dial = func() (redis.Conn, error) {
+			return &clusterConn{cluster: cluster}, nil
+		}
+	case len(opts.SentinelAddrs) > 0:
+		s := &redisSentinel{
+			addrs: opts.SentinelAddrs,
+			master: opts.SentinelMaster,
+			dialOptions: opts.sentinelDialOptions(),
+		}
+		pool.Dial = func() (redis.Conn, error) {
+			addr, err := s.masterAddr()
+			if err != nil {
+				return nil, err
+			}
+			return redis.Dial("tcp", addr, opts.dialOptions()...)
+		}
+		// after a failover the old master is demoted, so drop connections that still point at it
+		pool.TestOnBorrow = func(conn redis.Conn, t time.Time) error {
+			return testRole(conn, "master")
+		}
+	default:
+		pool.Dial = func() (redis.Conn, error) {
+			return redis.Dial("tcp", opts.Addr, opts.dialOptions()...)
+		}
+	}
+
+	return pool
+}
+
+// dialOptions returns the options used to connect to redis servers
+func (opts RedisOptions) dialOptions() []redis.DialOption {
+	dialOptions := []redis.DialOption{
+		redis.DialPassword(opts.Password),
+	}
+
+	// redis cluster only has database 0
+	if opts.DB > 0 && len(opts.ClusterAddrs) == 0 {
+		dialOptions = append(dialOptions, redis.DialDatabase(opts.DB))
+	}
+
+	return append(dialOptions, opts.commonDialOptions()...)
+}
+
+// sentinelDialOptions returns the options used to connect to sentinels
+func (opts RedisOptions) sentinelDialOptions() []redis.DialOption {
+	dialOptions := []redis.DialOption{
+		redis.DialPassword(opts.SentinelPassword),
+	}
+
+	return append(dialOptions, opts.commonDialOptions()...)
+}
+
+func (opts RedisOptions) commonDialOptions() []redis.DialOption {
+	var dialOptions []redis.DialOption
+
+	if opts.ConnectTimeout > 0 {
+		dialOptions = append(dialOptions, redis.DialConnectTimeout(opts.ConnectTimeout))
+	}
+
+	if opts.TLS {
+		dialOptions = append(dialOptions,
+			redis.DialUseTLS(true),
+			redis.DialTLSSkipVerify(opts.TLSSkipVerify),
+			redis.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}),
+		)
+	}
+
+	return dialOptions
+}
+
+// redisSentinel asks a set of sentinels for the address of the current master
+type redisSentinel struct {
+	addrs []string
+	master string
+	dialOptions []redis.DialOption
+
+	mu sync.Mutex
+}
+
+// masterAddr returns the address of the current master, according to the first sentinel that
+// answers. That sentinel is moved to the front of the list, so it is asked first next time.
+func (s *redisSentinel) masterAddr() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lastErr error
+	for i, addr := range s.addrs {
+		conn, err := redis.Dial("tcp", addr, s.dialOptions...)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.master))
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if len(reply) != 2 {
+			lastErr = fmt.Errorf("cache: sentinel %s does not know master %s", addr, s.master)
+			continue
+		}
+
+		if i > 0 {
+			s.addrs[0], s.addrs[i] = s.addrs[i], s.addrs[0]
+		}
+
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+
+	if lastErr == nil {
+		lastErr = errors.New("cache: no redis sentinels configured")
+	}
+
+	return "", lastErr
+}
+
+// testRole checks that conn is connected to a server in the expected role. Servers that do
+// not know the ROLE command are accepted as long as they answer.
+func testRole(conn redis.Conn, expected string) error {
+	reply, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		var redisErr redis.Error
+		if errors.As(err, &redisErr) && strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+			_, err = conn.Do("PING")
+		}
+		return err
+	}
+
+	if len(reply) == 0 {
+		return errors.New("cache: empty ROLE reply")
+	}
+
+	role, err := redis.String(reply[0], nil)
+	if err != nil {
+		return err
+	}
+
+	if role != expected {
+		return fmt.Errorf("cache: redis server is a %s, not a %s", role, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+)
+
+func TestNewRedisPool_Sentinel(t *testing.T) {
+	master := miniredis.RunT(t)
+
+	sentinel := miniredis.RunT(t)
+	err := sentinel.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		if len(args) == 2 && strings.EqualFold(args[0], "get-master-addr-by-name") && args[1] == "mymaster" {
+			c.WriteLen(2)
+			c.WriteBulk(master.Host())
+			c.WriteBulk(master.Port())
+			return
+		}
+		c.WriteNull()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := NewRedisPool(RedisOptions{
+		SentinelAddrs: []string{"127.0.0.1:1", sentinel.Addr()},
+		SentinelMaster: "mymaster",
+	})
+	defer pool.Close()
+
+	c := RedisCache{Conn: pool, Prefix: "sentinel"}
+	err = c.Set("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !master.Exists("sentinel:foo") {
+		t.Error("value was not written to the master reported by sentinel")
+	}
+}
+
+func TestNewRedisPool_SentinelUnknownMaster(t *testing.T) {
+	sentinel := miniredis.RunT(t)
+	_ = sentinel.Server().Register("SENTINEL", func(c *server.Peer, cmd string, args []string) {
+		c.WriteNull()
+	})
+
+	pool := NewRedisPool(RedisOptions{
+		SentinelAddrs: []string{sentinel.Addr()},
+		SentinelMaster: "unknown",
+	})
+	defer pool.Close()
+
+	c := RedisCache{Conn: pool, Prefix: "sentinel"}
+	if err := c.Set("foo", "bar"); err == nil {
+		t.Error("expected an error when sentinel does not know the master")
+	}
+}
+
+// startCluster runs two miniredis servers that split the hash slots between them and answer
+// MOVED for keys they do not own, like the nodes of a redis cluster
+func startCluster(t *testing.T) (*miniredis.Miniredis, *miniredis.Miniredis) {
+	a := miniredis.RunT(t)
+	b := miniredis.RunT(t)
+
+	nodes := []*miniredis.Miniredis{a, b}
+	for i, node := range nodes {
+		first, last := i*clusterSlots/2, (i+1)*clusterSlots/2-1
+
+		node.Server().SetPreHook(func(c *server.Peer, cmd string, args ...string) bool {
+			cmd = strings.ToUpper(cmd)
+			if cmd == "CLUSTER" && len(args) > 0 && strings.EqualFold(args[0], "SLOTS") {
+				c.WriteLen(len(nodes))
+				for j, n := range nodes {
+					port, _ := strconv.Atoi(n.Port())
+					c.WriteLen(3)
+					c.WriteInt(j * clusterSlots / 2)
+					c.WriteInt((j+1)*clusterSlots/2 - 1)
+					c.WriteLen(2)
+					c.WriteBulk(n.Host())
+					c.WriteInt(port)
+				}
+				return true
+			}
+
+			key, ok := commandKey(command{name: cmd, args: stringArgs(args)})
+			if !ok {
+				return false
+			}
+
+			if slot := keySlot(key); slot < first || slot > last {
+				c.WriteError(fmt.Sprintf("MOVED %d %s", slot, nodes[1-i].Addr()))
+				return true
+			}
+
+			return false
+		})
+	}
+
+	return a, b
+}
+
+func stringArgs(args []string) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	return values
+}
+
+func TestNewRedisPool_Cluster(t *testing.T) {
+	a, b := startCluster(t)
+
+	pool := NewRedisPool(RedisOptions{
+		ClusterAddrs: []string{a.Addr()},
+	})
+	defer pool.Close()
+
+	c := RedisCache{Conn: pool, Prefix: "cluster"}
+
+	values := make(map[string]interface{})
+	for i := 0; i < 20; i++ {
+		values[fmt.Sprintf("key%d", i)] = i
+	}
+
+	err := c.SetMany(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(a.Keys()) == 0 || len(b.Keys()) == 0 {
+		t.Error("keys were not spread over both nodes")
+	}
+
+	items, err := c.GetMany("key1", "key2", "key3", "missing")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 3 || items["key2"] != 2 {
+		t.Error("did not get correct values from the cluster:", items)
+	}
+
+	n, err := c.Increment("counter", 5, 60)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 5 {
+		t.Error("expected counter to be 5, but got", n)
+	}
+
+	err = c.EmptyByMatch("key")
+	if err != nil {
+		t.Error(err)
+	}
+
+	inCache, _ := c.Has("key7")
+	if inCache {
+		t.Error("key7 found in cache, and it should not be there")
+	}
+
+	inCache, _ = c.Has("counter")
+	if !inCache {
+		t.Error("counter not found in cache, and it should be there")
+	}
+}
+
+func TestNewRedisPool_ClusterTransaction(t *testing.T) {
+	a, b := startCluster(t)
+
+	pool := NewRedisPool(RedisOptions{
+		ClusterAddrs: []string{b.Addr()},
+	})
+	defer pool.Close()
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	// the same sequence the redis session store uses to save a session
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("scs:session:%d", i)
+		_ = conn.Send("MULTI")
+		_ = conn.Send("SET", key, "data")
+		_ = conn.Send("PEXPIREAT", key, 9999999999999)
+		if _, err := conn.Do("EXEC"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(a.Keys())+len(b.Keys()) != 10 {
+		t.Error("expected 10 sessions in the cluster, but found", len(a.Keys())+len(b.Keys()))
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	// known values from the redis cluster specification
+	if slot := keySlot("123456789"); slot != 12739 {
+		t.Error("expected slot 12739, but got", slot)
+	}
+
+	if keySlot("{user1000}.following") != keySlot("{user1000}.followers") {
+		t.Error("keys with the same hash tag should share a slot")
+	}
+}
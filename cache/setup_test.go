@@ -53,6 +53,7 @@ func TestMain(m *testing.M) {
 
 	db, _ := badger.Open(badger.DefaultOptions("./testdata/tmp/badger"))
 	testBadgerCache.Conn = db
+	testBadgerCache.Prefix = "test-rasant"
 	
 	os.Exit(m.Run())
 }
\ No newline at end of file
@@ -1,6 +1,10 @@
 package filesystems
 
-import "time"
+import (
+	"context"
+	"io"
+	"time"
+)
 
 // FS is the interface for files systems
 type FS interface {
@@ -10,6 +14,23 @@ type FS interface {
 	Delete(itemsToDelete []string) bool
 }
 
+// Creator is implemented by file systems that can store a file read from a stream, so that
+// it need not be written to local disk first
+type Creator interface {
+	Create(ctx context.Context, key string, r io.Reader, opts CreateOptions) error
+}
+
+// CreateOptions describe a file being created from a stream
+type CreateOptions struct {
+	// ContentType is the MIME type of the file
+	ContentType string
+	// Size is the size of the file in bytes, or -1 when it is not known in advance
+	Size int64
+	// MaxSize is the most bytes a file of unknown Size can hold, or 0 when there is no
+	// limit. File systems that upload in parts use it to size their parts.
+	MaxSize int64
+}
+
 // Listing describes one file on a remote file system
 type Listing struct {
 	Etag string
@@ -0,0 +1,103 @@
+package filesystems
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Legacy returns an FS that implements the old, local file based methods with s, so that
+// code written for FS keeps working with a Storage
+func Legacy(s Storage) FS {
+	return legacy{s}
+}
+
+type legacy struct {
+	s Storage
+}
+
+// Put uploads the local file fileName into folder, keeping its base name
+func (l legacy) Put(fileName, folder string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	size := int64(-1)
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	key := path.Join(folder, filepath.Base(fileName))
+	return l.s.Create(context.Background(), key, f, CreateOptions{Size: size})
+}
+
+// Get downloads items into the local folder destination, keeping their base names
+func (l legacy) Get(destination string, items ...string) error {
+	for _, item := range items {
+		if err := l.get(destination, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l legacy) get(destination, item string) error {
+	r, err := l.s.Open(context.Background(), item)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(filepath.Join(destination, path.Base(item)))
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List lists the files under prefix, leaving out hidden files. As it always has, Size is in
+// megabytes.
+func (l legacy) List(prefix string) ([]Listing, error) {
+	var listing []Listing
+
+	files, err := l.s.List(context.Background(), prefix)
+	if err != nil {
+		return listing, err
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Key, ".") {
+			continue
+		}
+
+		listing = append(listing, Listing{
+			Etag: file.Etag,
+			LastModified: file.LastModified,
+			Key: file.Key,
+			Size: float64(file.Size) / 1024 / 1024,
+			IsDir: file.IsDir,
+		})
+	}
+
+	return listing, nil
+}
+
+// Delete deletes items, reporting failure as false
+func (l legacy) Delete(itemsToDelete []string) bool {
+	if err := l.s.Delete(context.Background(), itemsToDelete...); err != nil {
+		log.Println(err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,151 @@
+package filesystems
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// memStorage keeps files in memory
+type memStorage map[string][]byte
+
+func (m memStorage) Create(ctx context.Context, key string, r io.Reader, opts CreateOptions) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m[key] = b
+	return nil
+}
+
+func (m memStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := m[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m memStorage) Stat(ctx context.Context, key string) (FileInfo, error) {
+	b, ok := m[key]
+	if !ok {
+		return FileInfo{}, fmt.Errorf("%s: %w", key, ErrNotExist)
+	}
+	return FileInfo{Key: key, Size: int64(len(b))}, nil
+}
+
+func (m memStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := m[key]
+	return ok, nil
+}
+
+func (m memStorage) Copy(ctx context.Context, src, dst string) error {
+	return CopyStream(ctx, m, src, dst)
+}
+
+func (m memStorage) Move(ctx context.Context, src, dst string) error {
+	return MoveByCopy(ctx, m, src, dst)
+}
+
+func (m memStorage) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if key == "locked" {
+			return errors.New("locked")
+		}
+		delete(m, key)
+	}
+	return nil
+}
+
+func (m memStorage) List(ctx context.Context, prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	for key, b := range m {
+		if strings.HasPrefix(key, prefix) {
+			files = append(files, FileInfo{Key: key, Size: int64(len(b))})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Key < files[j].Key })
+	return files, nil
+}
+
+func TestLegacy(t *testing.T) {
+	m := memStorage{}
+	fs := Legacy(m)
+	dir := t.TempDir()
+
+	local := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(local, bytes.Repeat([]byte("x"), 1024*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Put(local, "reports"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := m["reports/report.txt"]; !ok {
+		t.Error("file was not stored under folder/name:", m)
+	}
+
+	m[".hidden"] = []byte("hidden")
+	listing, err := fs.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(listing) != 1 || listing[0].Key != "reports/report.txt" || listing[0].Size != 1 {
+		t.Error("wrong listing:", listing)
+	}
+
+	download := filepath.Join(dir, "download")
+	if err = os.Mkdir(download, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = fs.Get(download, "reports/report.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if info, err := os.Stat(filepath.Join(download, "report.txt")); err != nil || info.Size() != 1024*1024 {
+		t.Error("file was not downloaded:", err)
+	}
+
+	if err = fs.Get(download, "missing.txt"); !errors.Is(err, ErrNotExist) {
+		t.Error("expected ErrNotExist, got", err)
+	}
+
+	if !fs.Delete([]string{"reports/report.txt"}) {
+		t.Error("delete failed")
+	}
+
+	if fs.Delete([]string{"locked"}) {
+		t.Error("a failed delete should report false")
+	}
+}
+
+func TestCopyAndMove(t *testing.T) {
+	ctx := context.Background()
+	m := memStorage{"a": []byte("content")}
+
+	if err := m.Copy(ctx, "a", "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Move(ctx, "b", "c"); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(m["a"]) != "content" || string(m["c"]) != "content" || m["b"] != nil {
+		t.Error("wrong files after copy and move:", m)
+	}
+
+	if err := m.Copy(ctx, "missing", "d"); !errors.Is(err, ErrNotExist) {
+		t.Error("expected ErrNotExist, got", err)
+	}
+}
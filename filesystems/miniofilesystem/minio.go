@@ -2,8 +2,11 @@ package miniofilesystem
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"path"
 	"strings"
 
@@ -12,6 +15,8 @@ import (
 	"github.com/shaynemeyer/rasant/filesystems"
 )
 
+// Minio stores files in a bucket of a minio server. Its methods implement filesystems.FS;
+// Storage gives access to the same bucket as a filesystems.Storage.
 type Minio struct {
 	Endpoint string
 	Key string
@@ -19,8 +24,19 @@ type Minio struct {
 	UseSSL bool
 	Region string
 	Bucket string
+	// PartSize is the size of the parts of multipart uploads, in bytes; at least 5MB, and
+	// 16MB when 0. Each upload holds one part in memory at a time.
+	PartSize uint64
 }
 
+const (
+	// defaultPartSize is the part size of multipart uploads when PartSize is 0
+	defaultPartSize = 16 << 20
+	// minPartSize and maxParts are the limits S3 puts on multipart uploads
+	minPartSize = 5 << 20
+	maxParts = 10000
+)
+
 func (m *Minio) getCredentials() *minio.Client {
 	client, err := minio.New(m.Endpoint, &minio.Options{
 		Creds: credentials.NewStaticV4(m.Key, m.Secret, ""),
@@ -122,4 +138,176 @@ func (m *Minio) Get(destination string, items ...string) error {
 	}
 	
 	return nil
-}
\ No newline at end of file
+}
+
+// Storage returns the bucket as a filesystems.Storage. It has a value receiver, so that the
+// Minio values kept in Rasant.FileSystems provide it too.
+func (m Minio) Storage() filesystems.Storage {
+	return storage{m: &m}
+}
+
+// storage implements filesystems.Storage for a Minio
+type storage struct {
+	m *Minio
+}
+
+// Create stores the content of r as key. When opts.Size is not known, the object is uploaded
+// in parts, so it is never held in memory as a whole.
+func (s storage) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	client := s.m.getCredentials()
+	_, err := client.PutObject(ctx, s.m.Bucket, key, r, opts.Size, minio.PutObjectOptions{
+		ContentType: opts.ContentType,
+		PartSize: s.m.partSize(opts),
+	})
+	return err
+}
+
+// partSize returns the part size for uploading a file described by opts. Left to itself,
+// minio-go buffers parts of over 500MB for files of unknown size, so the part size is always
+// set, and only grows when the file could not otherwise fit in the most parts allowed.
+func (m *Minio) partSize(opts filesystems.CreateOptions) uint64 {
+	size := m.PartSize
+	if size == 0 {
+		size = defaultPartSize
+	}
+
+	limit := opts.Size
+	if limit < 0 {
+		limit = opts.MaxSize
+	}
+
+	switch {
+	case limit <= 0:
+		return size
+	case uint64(limit) < size && opts.Size < 0:
+		// a small file of unknown size needs no more than a part of its largest size
+		size = uint64(limit)
+	case uint64(limit) > size*maxParts:
+		size = (uint64(limit) + maxParts - 1) / maxParts
+	}
+
+	if size < minPartSize {
+		size = minPartSize
+	}
+	return size
+}
+
+func (s storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	client := s.m.getCredentials()
+	object, err := client.GetObject(ctx, s.m.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, notExist(key, err)
+	}
+
+	// GetObject does not contact the server; Stat does, and reports missing objects
+	if _, err = object.Stat(); err != nil {
+		object.Close()
+		return nil, notExist(key, err)
+	}
+
+	return object, nil
+}
+
+func (s storage) Stat(ctx context.Context, key string) (filesystems.FileInfo, error) {
+	client := s.m.getCredentials()
+	info, err := client.StatObject(ctx, s.m.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return filesystems.FileInfo{}, notExist(key, err)
+	}
+
+	return fileInfo(info), nil
+}
+
+func (s storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Stat(ctx, key)
+	if errors.Is(err, filesystems.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Copy copies src to dst on the server
+func (s storage) Copy(ctx context.Context, src, dst string) error {
+	client := s.m.getCredentials()
+	_, err := client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.m.Bucket, Object: dst},
+		minio.CopySrcOptions{Bucket: s.m.Bucket, Object: src},
+	)
+	return notExist(src, err)
+}
+
+func (s storage) Move(ctx context.Context, src, dst string) error {
+	return filesystems.MoveByCopy(ctx, s, src, dst)
+}
+
+// Delete deletes keys in batches
+func (s storage) Delete(ctx context.Context, keys ...string) error {
+	client := s.m.getCredentials()
+
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for _, key := range keys {
+			select {
+			case objects <- minio.ObjectInfo{Key: key}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	for result := range client.RemoveObjects(ctx, s.m.Bucket, objects, minio.RemoveObjectsOptions{GovernanceBypass: true}) {
+		if result.Err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("delete %s: %w", result.ObjectName, result.Err)
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+func (s storage) List(ctx context.Context, prefix string) ([]filesystems.FileInfo, error) {
+	var files []filesystems.FileInfo
+
+	client := s.m.getCredentials()
+
+	objectCh := client.ListObjects(ctx, s.m.Bucket, minio.ListObjectsOptions{
+		Prefix: prefix,
+		Recursive: true,
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			return files, object.Err
+		}
+		files = append(files, fileInfo(object))
+	}
+
+	return files, nil
+}
+
+func fileInfo(object minio.ObjectInfo) filesystems.FileInfo {
+	return filesystems.FileInfo{
+		Key: object.Key,
+		Size: object.Size,
+		LastModified: object.LastModified,
+		Etag: object.ETag,
+		ContentType: object.ContentType,
+	}
+}
+
+// notExist wraps err in filesystems.ErrNotExist when it reports a missing object
+func notExist(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", key, filesystems.ErrNotExist)
+	}
+	return err
+}
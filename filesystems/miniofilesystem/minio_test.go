@@ -0,0 +1,39 @@
+package miniofilesystem
+
+import (
+	"testing"
+
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+func TestMinio_partSize(t *testing.T) {
+	const mb = 1 << 20
+
+	tests := []struct {
+		partSize uint64
+		size int64
+		maxSize int64
+		want uint64
+	}{
+		// unknown size, no limit: the default, never minio-go's 500MB parts
+		{0, -1, 0, 16 * mb},
+		{64 * mb, -1, 0, 64 * mb},
+		// unknown size within a small limit: no larger than the file can be, but at least 5MB
+		{0, -1, 10 * mb, 10 * mb},
+		{0, -1, 1 * mb, 5 * mb},
+		// files that would need more than 10000 parts get larger parts
+		{0, -1, 500000 * mb, 50 * mb},
+		{0, 200000 * mb, 0, 20 * mb},
+		// known sizes keep the part size, small ones are sent in one request anyway
+		{0, 1 * mb, 0, 16 * mb},
+		{8 * mb, 100 * mb, 0, 8 * mb},
+	}
+
+	for _, tt := range tests {
+		m := Minio{PartSize: tt.partSize}
+		got := m.partSize(filesystems.CreateOptions{Size: tt.size, MaxSize: tt.maxSize})
+		if got != tt.want {
+			t.Errorf("part size %d, size %d, max size %d: got %d, want %d", tt.partSize, tt.size, tt.maxSize, got, tt.want)
+		}
+	}
+}
@@ -1,28 +1,308 @@
 package s3filesystem
 
-import "github.com/shaynemeyer/rasant/filesystems"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
 
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+const (
+	// awsEndpoint is used when Endpoint is empty
+	awsEndpoint = "s3.amazonaws.com"
+	// defaultPartSize is the part size of multipart uploads when PartSize is 0
+	defaultPartSize = 16 << 20
+	// minPartSize and maxParts are the limits S3 puts on multipart uploads
+	minPartSize = 5 << 20
+	maxParts = 10000
+)
+
+// S3 stores files in an Amazon S3 bucket, or in a bucket of any S3 compatible service when
+// Endpoint is set. Its methods implement filesystems.FS; Storage gives access to the same
+// bucket as a filesystems.Storage.
 type S3 struct {
 	Key string
 	Secret string
 	Region string
+	// Endpoint is the address of an S3 compatible service, such as
+	// https://nyc3.digitaloceanspaces.com or http://localhost:9000. Buckets are addressed by
+	// path on custom endpoints. Amazon S3 is used when it is empty.
 	Endpoint string
 	Bucket string
+	// PartSize is the size of the parts of multipart uploads, in bytes; at least 5MB, and
+	// 16MB when 0. Files larger than a part, and files of unknown size, are uploaded in parts,
+	// and each upload holds one part in memory at a time.
+	PartSize uint64
+}
+
+func (s *S3) client() (*minio.Client, error) {
+	endpoint, secure, err := s.endpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	lookup := minio.BucketLookupAuto
+	if s.Endpoint != "" {
+		lookup = minio.BucketLookupPath
+	}
+
+	return minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(s.Key, s.Secret, ""),
+		Secure: secure,
+		Region: s.Region,
+		BucketLookup: lookup,
+	})
 }
 
+// endpoint splits Endpoint into the host minio-go wants and whether to use TLS
+func (s *S3) endpoint() (string, bool, error) {
+	if s.Endpoint == "" {
+		return awsEndpoint, true, nil
+	}
+
+	if !strings.Contains(s.Endpoint, "://") {
+		return strings.TrimSuffix(s.Endpoint, "/"), true, nil
+	}
+
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("s3: endpoint: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	default:
+		return "", false, fmt.Errorf("s3: endpoint %s must be http or https", s.Endpoint)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", false, fmt.Errorf("s3: endpoint %s must be a host, without a path", s.Endpoint)
+	}
+
+	return u.Host, u.Scheme == "https", nil
+}
+
+// Put uploads the local file fileName into folder
 func (s *S3) Put(fileName, folder string) error {
-	return nil
+	return filesystems.Legacy(s.Storage()).Put(fileName, folder)
+}
+
+// Get downloads items into the local folder destination
+func (s *S3) Get(destination string, items ...string) error {
+	return filesystems.Legacy(s.Storage()).Get(destination, items...)
 }
 
+// List lists the files under prefix, leaving out hidden files; Size is in megabytes
 func (s *S3) List(prefix string) ([]filesystems.Listing, error) {
-  var listing []filesystems.Listing
-	return listing, nil
+	return filesystems.Legacy(s.Storage()).List(prefix)
 }
 
+// Delete deletes itemsToDelete in batches, reporting failure as false
 func (s *S3) Delete(itemsToDelete []string) bool {
-	return true
+	return filesystems.Legacy(s.Storage()).Delete(itemsToDelete)
 }
 
-func (s *S3) Get(destination string, items ...string) error {
-  return nil
-}
\ No newline at end of file
+// Storage returns the bucket as a filesystems.Storage. It has a value receiver, so that the
+// S3 values kept in Rasant.FileSystems provide it too.
+func (s S3) Storage() filesystems.Storage {
+	return storage{s: &s}
+}
+
+// storage implements filesystems.Storage for an S3
+type storage struct {
+	s *S3
+}
+
+// Create stores the content of r as key. Large files, and files whose opts.Size is not known,
+// are uploaded in parts, so they are never held in memory as a whole.
+func (st storage) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	client, err := st.s.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObject(ctx, st.s.Bucket, key, r, opts.Size, minio.PutObjectOptions{
+		ContentType: opts.ContentType,
+		PartSize: st.s.partSize(opts),
+	})
+	return err
+}
+
+// partSize returns the part size for uploading a file described by opts. Left to itself,
+// minio-go buffers parts of over 500MB for files of unknown size, so the part size is always
+// set, and only grows when the file could not otherwise fit in the most parts allowed.
+func (s *S3) partSize(opts filesystems.CreateOptions) uint64 {
+	size := s.PartSize
+	if size == 0 {
+		size = defaultPartSize
+	}
+
+	limit := opts.Size
+	if limit < 0 {
+		limit = opts.MaxSize
+	}
+
+	switch {
+	case limit <= 0:
+		return size
+	case uint64(limit) < size && opts.Size < 0:
+		// a small file of unknown size needs no more than a part of its largest size
+		size = uint64(limit)
+	case uint64(limit) > size*maxParts:
+		size = (uint64(limit) + maxParts - 1) / maxParts
+	}
+
+	if size < minPartSize {
+		size = minPartSize
+	}
+	return size
+}
+
+func (st storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	client, err := st.s.client()
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(ctx, st.s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, notExist(key, err)
+	}
+
+	// GetObject does not contact the server; Stat does, and reports missing objects
+	if _, err = object.Stat(); err != nil {
+		object.Close()
+		return nil, notExist(key, err)
+	}
+
+	return object, nil
+}
+
+func (st storage) Stat(ctx context.Context, key string) (filesystems.FileInfo, error) {
+	client, err := st.s.client()
+	if err != nil {
+		return filesystems.FileInfo{}, err
+	}
+
+	info, err := client.StatObject(ctx, st.s.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return filesystems.FileInfo{}, notExist(key, err)
+	}
+
+	return fileInfo(info), nil
+}
+
+func (st storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := st.Stat(ctx, key)
+	if errors.Is(err, filesystems.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Copy copies src to dst on the server
+func (st storage) Copy(ctx context.Context, src, dst string) error {
+	client, err := st.s.client()
+	if err != nil {
+		return err
+	}
+
+	_, err = client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: st.s.Bucket, Object: dst},
+		minio.CopySrcOptions{Bucket: st.s.Bucket, Object: src},
+	)
+	return notExist(src, err)
+}
+
+func (st storage) Move(ctx context.Context, src, dst string) error {
+	return filesystems.MoveByCopy(ctx, st, src, dst)
+}
+
+// Delete deletes keys in batches of up to 1000, the most S3 deletes in one request
+func (st storage) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	client, err := st.s.client()
+	if err != nil {
+		return err
+	}
+
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for _, key := range keys {
+			select {
+			case objects <- minio.ObjectInfo{Key: key}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	for result := range client.RemoveObjects(ctx, st.s.Bucket, objects, minio.RemoveObjectsOptions{}) {
+		if result.Err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("delete %s: %w", result.ObjectName, result.Err)
+		}
+	}
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+// List lists every object under prefix, following the pages of the listing to the end
+func (st storage) List(ctx context.Context, prefix string) ([]filesystems.FileInfo, error) {
+	var files []filesystems.FileInfo
+
+	client, err := st.s.client()
+	if err != nil {
+		return files, err
+	}
+
+	objectCh := client.ListObjects(ctx, st.s.Bucket, minio.ListObjectsOptions{
+		Prefix: prefix,
+		Recursive: true,
+	})
+
+	for object := range objectCh {
+		if object.Err != nil {
+			return files, object.Err
+		}
+		files = append(files, fileInfo(object))
+	}
+
+	return files, nil
+}
+
+func fileInfo(object minio.ObjectInfo) filesystems.FileInfo {
+	return filesystems.FileInfo{
+		Key: object.Key,
+		Size: object.Size,
+		LastModified: object.LastModified,
+		Etag: object.ETag,
+		ContentType: object.ContentType,
+	}
+}
+
+// notExist wraps err in filesystems.ErrNotExist when it reports a missing object
+func notExist(key string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", key, filesystems.ErrNotExist)
+	}
+	return err
+}
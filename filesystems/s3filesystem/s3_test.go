@@ -0,0 +1,535 @@
+package s3filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+var (
+	_ filesystems.FS = (*S3)(nil)
+	_ filesystems.StorageProvider = S3{}
+)
+
+// listPageSize is the number of keys per page of fakeS3's listings, kept small so that
+// listing follows continuation tokens
+const listPageSize = 2
+
+type fakeObject struct {
+	data []byte
+	contentType string
+	modified time.Time
+}
+
+func (o fakeObject) etag() string {
+	sum := md5.Sum(o.data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// fakeS3 is the part of the S3 API that the driver uses, for one bucket, in memory
+type fakeS3 struct {
+	bucket string
+
+	mu sync.Mutex
+	objects map[string]fakeObject
+	uploads map[string]map[int][]byte
+	nextUpload int
+
+	// counts of the requests of interest
+	parts, listPages, batchDeletes int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket: bucket,
+		objects: make(map[string]fakeObject),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		f.list(w, query)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", object.etag())
+		w.Header().Set("Content-Type", object.contentType)
+		http.ServeContent(w, r, key, object.modified, bytes.NewReader(object.data))
+	case r.Method == http.MethodPost && query.Has("delete"):
+		f.deleteObjects(w, r)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextUpload++
+		id := strconv.Itoa(f.nextUpload)
+		f.uploads[id] = make(map[int][]byte)
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket string
+			Key string
+			UploadId string
+		}{Bucket: bucket, Key: key, UploadId: id})
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.complete(w, r, key, query.Get("uploadId"))
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		n, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[n] = readBody(r)
+		f.parts++
+		w.Header().Set("ETag", fakeObject{data: parts[n]}.etag())
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		_, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		object, ok := f.objects[sourceKey]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		object.modified = time.Now()
+		f.objects[key] = object
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CopyObjectResult"`
+			ETag string
+			LastModified time.Time
+		}{ETag: object.etag(), LastModified: object.modified})
+	case r.Method == http.MethodPut:
+		object := fakeObject{data: readBody(r), contentType: r.Header.Get("Content-Type"), modified: time.Now()}
+		f.objects[key] = object
+		w.Header().Set("ETag", object.etag())
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	f.listPages++
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	type content struct {
+		Key string
+		LastModified time.Time
+		ETag string
+		Size int64
+	}
+	result := struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		Name string
+		Prefix string
+		IsTruncated bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents []content
+	}{Name: f.bucket, Prefix: query.Get("prefix")}
+
+	if len(keys) > listPageSize {
+		keys = keys[:listPageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+
+	for _, key := range keys {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, content{key, object.modified, object.etag(), int64(len(object.data))})
+	}
+
+	writeXML(w, result)
+}
+
+func (f *fakeS3) deleteObjects(w http.ResponseWriter, r *http.Request) {
+	f.batchDeletes++
+
+	var request struct {
+		Object []struct{ Key string }
+	}
+	if err := xml.Unmarshal(readBody(r), &request); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	type deleted struct{ Key string }
+	result := struct {
+		XMLName xml.Name `xml:"DeleteResult"`
+		Deleted []deleted
+	}{}
+
+	for _, object := range request.Object {
+		delete(f.objects, object.Key)
+		result.Deleted = append(result.Deleted, deleted{object.Key})
+	}
+
+	writeXML(w, result)
+}
+
+func (f *fakeS3) complete(w http.ResponseWriter, r *http.Request, key, id string) {
+	parts, ok := f.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	var request struct {
+		Part []struct{ PartNumber int }
+	}
+	if err := xml.Unmarshal(readBody(r), &request); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var data []byte
+	for _, part := range request.Part {
+		data = append(data, parts[part.PartNumber]...)
+	}
+	delete(f.uploads, id)
+
+	object := fakeObject{data: data, modified: time.Now()}
+	f.objects[key] = object
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket string
+		Key string
+		ETag string
+	}{Bucket: f.bucket, Key: key, ETag: object.etag()})
+}
+
+// readBody reads the body of r, decoding the aws-chunked bodies of streaming signatures
+func readBody(r *http.Request) []byte {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		b, _ := io.ReadAll(r.Body)
+		return b
+	}
+
+	var data []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		// each chunk is <hex size>;chunk-signature=<signature>\r\n<data>\r\n
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return data
+		}
+		hexSize, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(hexSize, 16, 64)
+		if err != nil || size == 0 {
+			return data
+		}
+
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(br, chunk); err != nil {
+			return data
+		}
+		data = append(data, chunk...)
+		_, _ = br.Discard(2)
+	}
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code string
+		Message string
+	}{Code: code, Message: code})
+}
+
+func newTestS3(t *testing.T) (*S3, *fakeS3) {
+	t.Helper()
+
+	fake := newFakeS3("files")
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return &S3{
+		Key: "key",
+		Secret: "secret",
+		Region: "us-east-1",
+		Endpoint: server.URL,
+		Bucket: "files",
+	}, fake
+}
+
+func TestS3_CreateAndOpen(t *testing.T) {
+	s, _ := newTestS3(t)
+	ctx := context.Background()
+
+	err := s.Storage().Create(ctx, "docs/hello.txt", strings.NewReader("hello"), filesystems.CreateOptions{ContentType: "text/plain", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Storage().Open(ctx, "docs/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Errorf("wrong content: %q", b)
+	}
+
+	info, err := s.Storage().Stat(ctx, "docs/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.ContentType != "text/plain" || info.Etag == "" {
+		t.Errorf("wrong info: %+v", info)
+	}
+
+	if _, err = s.Storage().Open(ctx, "docs/missing.txt"); !errors.Is(err, filesystems.ErrNotExist) {
+		t.Errorf("expected ErrNotExist opening a missing file, got %v", err)
+	}
+
+	ok, err := s.Storage().Exists(ctx, "docs/missing.txt")
+	if ok || err != nil {
+		t.Errorf("expected a missing file not to exist, got %v, %v", ok, err)
+	}
+}
+
+func TestS3_CreateMultipart(t *testing.T) {
+	s, fake := newTestS3(t)
+	s.PartSize = 5 << 20
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), (11<<20)/16)
+
+	// a size that is not known is uploaded in parts, like a large one
+	err := s.Storage().Create(ctx, "big.bin", io.MultiReader(bytes.NewReader(data)), filesystems.CreateOptions{Size: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.parts != 3 {
+		t.Errorf("expected 3 parts, got %d", fake.parts)
+	}
+	if !bytes.Equal(fake.objects["big.bin"].data, data) {
+		t.Error("the parts were not put together")
+	}
+
+	// without a part size, parts of 16MB are used
+	s.PartSize = 0
+	fake.parts = 0
+	data = bytes.Repeat([]byte("0123456789abcdef"), (20<<20)/16)
+
+	err = s.Storage().Create(ctx, "bigger.bin", io.MultiReader(bytes.NewReader(data)), filesystems.CreateOptions{Size: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.parts != 2 {
+		t.Errorf("expected 2 parts, got %d", fake.parts)
+	}
+}
+
+func TestS3_partSize(t *testing.T) {
+	const mb = 1 << 20
+
+	tests := []struct {
+		partSize uint64
+		size int64
+		maxSize int64
+		want uint64
+	}{
+		// unknown size, no limit: the default, never minio-go's 500MB parts
+		{0, -1, 0, 16 * mb},
+		{64 * mb, -1, 0, 64 * mb},
+		// unknown size within a small limit: no larger than the file can be, but at least 5MB
+		{0, -1, 10 * mb, 10 * mb},
+		{0, -1, 1 * mb, 5 * mb},
+		// files that would need more than 10000 parts get larger parts
+		{0, -1, 500000 * mb, 50 * mb},
+		{0, 200000 * mb, 0, 20 * mb},
+		// known sizes keep the part size, small ones are sent in one request anyway
+		{0, 1 * mb, 0, 16 * mb},
+		{8 * mb, 100 * mb, 0, 8 * mb},
+	}
+
+	for _, tt := range tests {
+		s := S3{PartSize: tt.partSize}
+		got := s.partSize(filesystems.CreateOptions{Size: tt.size, MaxSize: tt.maxSize})
+		if got != tt.want {
+			t.Errorf("part size %d, size %d, max size %d: got %d, want %d", tt.partSize, tt.size, tt.maxSize, got, tt.want)
+		}
+	}
+}
+
+func TestS3_List(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1.txt", "a/2.txt", "a/b/3.txt", "a/b/4.txt", "a/5.txt", "c/6.txt"} {
+		fake.objects[key] = fakeObject{data: []byte(key), modified: time.Now()}
+	}
+
+	files, err := s.Storage().List(ctx, "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for _, file := range files {
+		keys = append(keys, file.Key)
+		if file.Size != int64(len(file.Key)) {
+			t.Errorf("wrong size for %s: %d", file.Key, file.Size)
+		}
+	}
+
+	if strings.Join(keys, " ") != "a/1.txt a/2.txt a/5.txt a/b/3.txt a/b/4.txt" {
+		t.Errorf("wrong keys: %v", keys)
+	}
+	if fake.listPages != 3 {
+		t.Errorf("expected 3 pages, got %d", fake.listPages)
+	}
+}
+
+func TestS3_Delete(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	keys := make([]string, 1001)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("old/%04d.txt", i)
+		fake.objects[keys[i]] = fakeObject{data: []byte("x"), modified: time.Now()}
+	}
+	fake.objects["keep.txt"] = fakeObject{data: []byte("x"), modified: time.Now()}
+
+	if err := s.Storage().Delete(ctx, append(keys, "old/missing.txt")...); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fake.objects) != 1 {
+		t.Errorf("expected only keep.txt to be left, got %d objects", len(fake.objects))
+	}
+	if fake.batchDeletes != 2 {
+		t.Errorf("expected 2 batches, got %d", fake.batchDeletes)
+	}
+}
+
+func TestS3_CopyAndMove(t *testing.T) {
+	s, fake := newTestS3(t)
+	ctx := context.Background()
+
+	fake.objects["a.txt"] = fakeObject{data: []byte("a"), modified: time.Now()}
+
+	if err := s.Storage().Copy(ctx, "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Storage().Move(ctx, "a.txt", "dir/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fake.objects["a.txt"]; ok {
+		t.Error("a.txt was not moved")
+	}
+	if string(fake.objects["b.txt"].data) != "a" || string(fake.objects["dir/c.txt"].data) != "a" {
+		t.Error("a.txt was not copied")
+	}
+
+	if err := s.Storage().Copy(ctx, "missing.txt", "d.txt"); !errors.Is(err, filesystems.ErrNotExist) {
+		t.Errorf("expected ErrNotExist copying a missing file, got %v", err)
+	}
+}
+
+func TestS3_PutAndGet(t *testing.T) {
+	s, _ := newTestS3(t)
+	dir := t.TempDir()
+
+	fileName := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(fileName, []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(fileName, "reports"); err != nil {
+		t.Fatal(err)
+	}
+
+	downloads := filepath.Join(dir, "downloads")
+	if err := os.Mkdir(downloads, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(downloads, "reports/report.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(downloads, "report.txt"))
+	if err != nil || string(b) != "report" {
+		t.Errorf("wrong download: %q, %v", b, err)
+	}
+}
+
+func TestS3_endpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		host string
+		secure bool
+		err bool
+	}{
+		{"", awsEndpoint, true, false},
+		{"http://localhost:9000", "localhost:9000", false, false},
+		{"https://nyc3.digitaloceanspaces.com/", "nyc3.digitaloceanspaces.com", true, false},
+		{"storage.example.com", "storage.example.com", true, false},
+		{"ftp://storage.example.com", "", false, true},
+		{"https://storage.example.com/bucket", "", false, true},
+	}
+
+	for _, tt := range tests {
+		s := &S3{Endpoint: tt.endpoint}
+		host, secure, err := s.endpoint()
+		if (err != nil) != tt.err || host != tt.host || secure != tt.secure {
+			t.Errorf("%q: got %q, %v, %v", tt.endpoint, host, secure, err)
+		}
+	}
+}
@@ -1,27 +1,430 @@
 package sftpfilesystem
 
-import "github.com/shaynemeyer/rasant/filesystems"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/pkg/sftp"
+	"github.com/shaynemeyer/rasant/filesystems"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialTimeout bounds connecting and logging in, when the context has no deadline
+const dialTimeout = 30 * time.Second
+
+// SFTP stores files on a server over SFTP. Keys are paths on the server; relative ones start
+// in the user's login folder. Its methods implement filesystems.FS; Storage gives access to the
+// same files as a filesystems.Storage.
+//
+// The server's host key must be in KnownHosts. Connections are kept open and shared by
+// every SFTP with the same settings.
 type SFTP struct {
 	Host string
 	User string
+	// Pass is the password, also used to answer keyboard-interactive logins
 	Pass string
+	// Port is 22 when empty
 	Port string
+	// KeyFile is the path of a private key to log in with, in addition to or instead of Pass
+	KeyFile string
+	// KeyPassphrase decrypts KeyFile, when it is encrypted
+	KeyPassphrase string
+	// KnownHosts is the path of the known_hosts file that holds the server's host key;
+	// ~/.ssh/known_hosts when empty
+	KnownHosts string
+}
+
+type connection struct {
+	ssh *ssh.Client
+	sftp *sftp.Client
+}
+
+// connections holds the open connections by settings. SFTP values are copied freely, so the
+// connections cannot live in them.
+var connections = struct {
+	sync.Mutex
+	m map[SFTP]*connection
+}{m: make(map[SFTP]*connection)}
+
+// client returns the open connection for s, connecting when there is none
+func (s *SFTP) client(ctx context.Context) (*sftp.Client, error) {
+	connections.Lock()
+	defer connections.Unlock()
+
+	if c, ok := connections.m[*s]; ok {
+		return c.sftp, nil
+	}
+
+	c, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	connections.m[*s] = c
+
+	// forget the connection when it drops, so the next call connects again
+	go func(key SFTP) {
+		_ = c.sftp.Wait()
+		connections.Lock()
+		if connections.m[key] == c {
+			delete(connections.m, key)
+		}
+		connections.Unlock()
+		c.ssh.Close()
+	}(*s)
+
+	return c.sftp, nil
 }
 
+func (s *SFTP) connect(ctx context.Context) (*connection, error) {
+	config, err := s.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	port := s.Port
+	if port == "" {
+		port = "22"
+	}
+	address := net.JoinHostPort(s.Host, port)
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+
+	// the handshake does not take a context, so it is bounded by a deadline instead
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dialTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, address, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, fmt.Errorf("sftp: %w", err)
+	}
+
+	return &connection{ssh: sshClient, sftp: sftpClient}, nil
+}
+
+func (s *SFTP) clientConfig() (*ssh.ClientConfig, error) {
+	knownHostsFile := s.KnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("sftp: known hosts: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: known hosts: %w", err)
+	}
+
+	var auth []ssh.AuthMethod
+
+	if s.KeyFile != "" {
+		signer, err := s.signer()
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+
+	if s.Pass != "" {
+		auth = append(auth, ssh.Password(s.Pass), ssh.KeyboardInteractive(
+			func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				answers := make([]string, len(questions))
+				for i := range answers {
+					answers[i] = s.Pass
+				}
+				return answers, nil
+			},
+		))
+	}
+
+	if len(auth) == 0 {
+		return nil, errors.New("sftp: a password or a key file is required")
+	}
+
+	return &ssh.ClientConfig{
+		User: s.User,
+		Auth: auth,
+		HostKeyCallback: hostKeyCallback,
+	}, nil
+}
+
+func (s *SFTP) signer() (ssh.Signer, error) {
+	key, err := os.ReadFile(s.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("sftp: key file: %w", err)
+	}
+
+	var signer ssh.Signer
+	if s.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(s.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sftp: key file: %w", err)
+	}
+
+	return signer, nil
+}
+
+// Close closes the connection of s, if it has one
+func (s *SFTP) Close() error {
+	connections.Lock()
+	c, ok := connections.m[*s]
+	delete(connections.m, *s)
+	connections.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	c.sftp.Close()
+	return c.ssh.Close()
+}
+
+// Put uploads the local file fileName into folder, creating the folder if needed
 func (s *SFTP) Put(fileName, folder string) error {
-	return nil
+	return filesystems.Legacy(s.Storage()).Put(fileName, folder)
+}
+
+// Get downloads items into the local folder destination
+func (s *SFTP) Get(destination string, items ...string) error {
+	return filesystems.Legacy(s.Storage()).Get(destination, items...)
 }
 
+// List lists the files under prefix, leaving out hidden files; Size is in megabytes
 func (s *SFTP) List(prefix string) ([]filesystems.Listing, error) {
-  var listing []filesystems.Listing
-	return listing, nil
+	return filesystems.Legacy(s.Storage()).List(prefix)
 }
 
+// Delete deletes itemsToDelete, reporting failure as false
 func (s *SFTP) Delete(itemsToDelete []string) bool {
-	return true
+	return filesystems.Legacy(s.Storage()).Delete(itemsToDelete)
 }
 
-func (s *SFTP) Get(destination string, items ...string) error {
-  return nil
-}
\ No newline at end of file
+// Storage returns the server's files as a filesystems.Storage. It has a value receiver, so
+// that the SFTP values kept in Rasant.FileSystems provide it too.
+func (s SFTP) Storage() filesystems.Storage {
+	return storage{s: &s}
+}
+
+// storage implements filesystems.Storage for an SFTP
+type storage struct {
+	s *SFTP
+}
+
+// Create stores the content of r as key, creating its folders if needed. A file that cannot
+// be written completely is removed.
+func (st storage) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	client, err := st.s.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dir := path.Dir(key); dir != "." && dir != "/" {
+		if err = client.MkdirAll(dir); err != nil {
+			return err
+		}
+	}
+
+	f, err := client.OpenFile(key, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.ReadFrom(r); err != nil {
+		f.Close()
+		_ = client.Remove(key)
+		return err
+	}
+
+	return f.Close()
+}
+
+func (st storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	client, err := st.s.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := client.Open(key)
+	if err != nil {
+		return nil, notExist(key, err)
+	}
+
+	return f, nil
+}
+
+func (st storage) Stat(ctx context.Context, key string) (filesystems.FileInfo, error) {
+	client, err := st.s.client(ctx)
+	if err != nil {
+		return filesystems.FileInfo{}, err
+	}
+
+	info, err := client.Stat(key)
+	if err != nil {
+		return filesystems.FileInfo{}, notExist(key, err)
+	}
+
+	return fileInfo(key, info), nil
+}
+
+func (st storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := st.Stat(ctx, key)
+	if errors.Is(err, filesystems.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Copy copies src to dst through this machine, as SFTP cannot copy on the server
+func (st storage) Copy(ctx context.Context, src, dst string) error {
+	return filesystems.CopyStream(ctx, st, src, dst)
+}
+
+// Move renames src to dst on the server
+func (st storage) Move(ctx context.Context, src, dst string) error {
+	client, err := st.s.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	if dir := path.Dir(dst); dir != "." && dir != "/" {
+		if err = client.MkdirAll(dir); err != nil {
+			return err
+		}
+	}
+
+	// a plain SFTP rename fails when dst exists; the OpenSSH extension replaces it
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return notExist(src, client.PosixRename(src, dst))
+	}
+
+	if err = client.Remove(dst); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return notExist(src, client.Rename(src, dst))
+}
+
+// Delete deletes keys, carrying on past errors and returning the first
+func (st storage) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	client, err := st.s.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		err := client.Remove(key)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) && firstErr == nil {
+			firstErr = fmt.Errorf("delete %s: %w", key, err)
+		}
+	}
+
+	return firstErr
+}
+
+// List walks the folders under prefix, describing every file whose path starts with prefix
+func (st storage) List(ctx context.Context, prefix string) ([]filesystems.FileInfo, error) {
+	var files []filesystems.FileInfo
+
+	client, err := st.s.client(ctx)
+	if err != nil {
+		return files, err
+	}
+
+	// start from the folder holding the prefix; docs/re lists docs/report.pdf and docs/reports/
+	root := prefix
+	if root == "" {
+		root = "."
+	} else if !strings.HasSuffix(root, "/") {
+		root = path.Dir(root)
+	}
+
+	walker := client.Walk(root)
+	for walker.Step() {
+		if err := ctx.Err(); err != nil {
+			return files, err
+		}
+
+		p := walker.Path()
+		if err := walker.Err(); err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return files, nil
+			}
+			return files, err
+		}
+
+		matches := prefix == "" || strings.HasPrefix(p, prefix)
+
+		if walker.Stat().IsDir() {
+			// skip folders that neither lead to the prefix nor are under it
+			if p != root && !matches && !strings.HasPrefix(prefix, p+"/") {
+				walker.SkipDir()
+			}
+			continue
+		}
+
+		if matches {
+			files = append(files, fileInfo(p, walker.Stat()))
+		}
+	}
+
+	return files, nil
+}
+
+func fileInfo(key string, info os.FileInfo) filesystems.FileInfo {
+	return filesystems.FileInfo{
+		Key: key,
+		Size: info.Size(),
+		LastModified: info.ModTime(),
+		ContentType: mime.TypeByExtension(path.Ext(key)),
+		IsDir: info.IsDir(),
+	}
+}
+
+// notExist wraps err in filesystems.ErrNotExist when it reports a missing file
+func notExist(key string, err error) error {
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", key, filesystems.ErrNotExist)
+	}
+	return err
+}
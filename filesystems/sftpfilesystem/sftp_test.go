@@ -0,0 +1,427 @@
+package sftpfilesystem
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"github.com/shaynemeyer/rasant/filesystems"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	_ filesystems.FS = (*SFTP)(nil)
+	_ filesystems.StorageProvider = SFTP{}
+)
+
+// testServer is an SSH server whose sftp subsystem keeps files in memory
+type testServer struct {
+	listener net.Listener
+	hostKey ssh.Signer
+	handlers sftp.Handlers
+
+	mu sync.Mutex
+	logins int
+}
+
+func newTestServer(t *testing.T, password string, userKey ssh.PublicKey) *testServer {
+	t.Helper()
+
+	server := &testServer{hostKey: newSigner(t), handlers: sftp.InMemHandler()}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == "ada" && string(pass) == password {
+				return nil, nil
+			}
+			return nil, errors.New("wrong password")
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if userKey != nil && conn.User() == "ada" && bytes.Equal(key.Marshal(), userKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(server.hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn, config)
+		}
+	}()
+
+	return server
+}
+
+func (server *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	server.mu.Lock()
+	server.logins++
+	server.mu.Unlock()
+
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			for req := range requests {
+				// the payload of a subsystem request is the length prefixed name
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				_ = req.Reply(ok, nil)
+				if ok {
+					go func() {
+						_ = sftp.NewRequestServer(channel, server.handlers).Serve()
+						channel.Close()
+					}()
+				}
+			}
+		}()
+	}
+}
+
+func (server *testServer) loginCount() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.logins
+}
+
+// knownHosts writes a known_hosts file holding key for the server
+func (server *testServer) knownHosts(t *testing.T, key ssh.PublicKey) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(server.listener.Addr().String())}, key)
+	if err := os.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// client returns an SFTP that logs into server with password
+func (server *testServer) client(t *testing.T, password string) *SFTP {
+	t.Helper()
+
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	s := &SFTP{
+		Host: host,
+		Port: port,
+		User: "ada",
+		Pass: password,
+		KnownHosts: server.knownHosts(t, server.hostKey.PublicKey()),
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key
+}
+
+func newSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+
+	signer, err := ssh.NewSignerFromKey(newKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func TestSFTP_CreateAndOpen(t *testing.T) {
+	server := newTestServer(t, "secret", nil)
+	s := server.client(t, "secret")
+	ctx := context.Background()
+
+	err := s.Storage().Create(ctx, "docs/2023/hello.txt", strings.NewReader("hello"), filesystems.CreateOptions{Size: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Storage().Open(ctx, "docs/2023/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Errorf("wrong content: %q", b)
+	}
+
+	info, err := s.Storage().Stat(ctx, "docs/2023/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != 5 || info.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("wrong info: %+v", info)
+	}
+
+	if _, err = s.Storage().Open(ctx, "docs/missing.txt"); !errors.Is(err, filesystems.ErrNotExist) {
+		t.Errorf("expected ErrNotExist opening a missing file, got %v", err)
+	}
+
+	ok, err := s.Storage().Exists(ctx, "docs/missing.txt")
+	if ok || err != nil {
+		t.Errorf("expected a missing file not to exist, got %v, %v", ok, err)
+	}
+}
+
+func TestSFTP_ConnectionReuse(t *testing.T) {
+	server := newTestServer(t, "secret", nil)
+	s := server.client(t, "secret")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		// a copy of s, as the file systems of an application are stored by value
+		copied := *s
+		if _, err := copied.Storage().Exists(ctx, "a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if logins := server.loginCount(); logins != 1 {
+		t.Errorf("expected 1 login, got %d", logins)
+	}
+
+	// a closed connection is replaced
+	s.Close()
+	if _, err := s.Storage().Exists(ctx, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if logins := server.loginCount(); logins != 2 {
+		t.Errorf("expected 2 logins, got %d", logins)
+	}
+}
+
+func TestSFTP_KeyAuth(t *testing.T) {
+	key := newKey(t)
+	userKey, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := newTestServer(t, "secret", userKey.PublicKey())
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := server.client(t, "")
+	s.KeyFile = filepath.Join(t.TempDir(), "id_ed25519")
+	t.Cleanup(func() { s.Close() })
+
+	if err = os.WriteFile(s.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = s.Storage().Exists(context.Background(), "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSFTP_Authentication(t *testing.T) {
+	server := newTestServer(t, "secret", nil)
+	ctx := context.Background()
+
+	s := server.client(t, "wrong")
+	if _, err := s.Storage().Exists(ctx, "a.txt"); err == nil {
+		t.Error("expected a wrong password to fail")
+	}
+
+	s = server.client(t, "secret")
+	s.KnownHosts = server.knownHosts(t, newSigner(t).PublicKey())
+	t.Cleanup(func() { s.Close() })
+
+	// the handshake does not wrap the knownhosts error, so only its message tells it apart
+	if _, err := s.Storage().Exists(ctx, "a.txt"); err == nil || !strings.Contains(err.Error(), "knownhosts") {
+		t.Errorf("expected a host key that is not known to fail, got %v", err)
+	}
+
+	s = server.client(t, "")
+	if _, err := s.Storage().Exists(ctx, "a.txt"); err == nil {
+		t.Error("expected settings without a password or key to fail")
+	}
+}
+
+func TestSFTP_List(t *testing.T) {
+	server := newTestServer(t, "secret", nil)
+	s := server.client(t, "secret")
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1.txt", "a/b/2.txt", "a/b/c/3.txt", "ab.txt", "c/4.txt"} {
+		if err := s.Storage().Create(ctx, key, strings.NewReader(key), filesystems.CreateOptions{Size: -1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		keys string
+	}{
+		{"a/", "a/1.txt a/b/2.txt a/b/c/3.txt"},
+		{"a", "a/1.txt a/b/2.txt a/b/c/3.txt ab.txt"},
+		{"a/b/", "a/b/2.txt a/b/c/3.txt"},
+		{"", "a/1.txt a/b/2.txt a/b/c/3.txt ab.txt c/4.txt"},
+		{"missing/", ""},
+	}
+
+	for _, tt := range tests {
+		files, err := s.Storage().List(ctx, tt.prefix)
+		if err != nil {
+			t.Errorf("%q: %v", tt.prefix, err)
+			continue
+		}
+
+		var keys []string
+		for _, file := range files {
+			keys = append(keys, file.Key)
+			if file.Size != int64(len(file.Key)) {
+				t.Errorf("wrong size for %s: %d", file.Key, file.Size)
+			}
+		}
+		sort.Strings(keys)
+
+		if strings.Join(keys, " ") != tt.keys {
+			t.Errorf("%q: wrong keys: %v", tt.prefix, keys)
+		}
+	}
+}
+
+func TestSFTP_CopyMoveAndDelete(t *testing.T) {
+	server := newTestServer(t, "secret", nil)
+	s := server.client(t, "secret")
+	ctx := context.Background()
+
+	for _, key := range []string{"a.txt", "b.txt"} {
+		if err := s.Storage().Create(ctx, key, strings.NewReader(key), filesystems.CreateOptions{Size: -1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Storage().Copy(ctx, "a.txt", "copies/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// moving onto an existing file replaces it
+	if err := s.Storage().Move(ctx, "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{"copies/a.txt": "a.txt", "b.txt": "a.txt"} {
+		r, err := s.Storage().Open(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		if string(b) != want {
+			t.Errorf("%s: wrong content %q", key, b)
+		}
+	}
+
+	if err := s.Storage().Move(ctx, "missing.txt", "c.txt"); !errors.Is(err, filesystems.ErrNotExist) {
+		t.Errorf("expected ErrNotExist moving a missing file, got %v", err)
+	}
+
+	if err := s.Storage().Delete(ctx, "b.txt", "copies/a.txt", "missing.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := s.Storage().List(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("expected no files to be left, got %v", files)
+	}
+}
+
+func TestSFTP_PutAndGet(t *testing.T) {
+	server := newTestServer(t, "secret", nil)
+	s := server.client(t, "secret")
+	dir := t.TempDir()
+
+	fileName := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(fileName, []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the folder does not exist yet
+	if err := s.Put(fileName, "reports/2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	downloads := filepath.Join(dir, "downloads")
+	if err := os.Mkdir(downloads, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Get(downloads, "reports/2023/report.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(downloads, "report.txt"))
+	if err != nil || string(b) != "report" {
+		t.Errorf("wrong download: %q, %v", b, err)
+	}
+
+	listing, err := s.List("reports/")
+	if err != nil || len(listing) != 1 || listing[0].Key != "reports/2023/report.txt" {
+		t.Errorf("wrong listing: %+v, %v", listing, err)
+	}
+
+	if !s.Delete([]string{"reports/2023/report.txt"}) {
+		t.Error("expected the delete to succeed")
+	}
+	if ok, _ := s.Storage().Exists(context.Background(), "reports/2023/report.txt"); ok {
+		t.Error("expected the report to be gone")
+	}
+}
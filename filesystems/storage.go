@@ -0,0 +1,76 @@
+package filesystems
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// ErrNotExist is returned, possibly wrapped, for files that do not exist. It is fs.ErrNotExist,
+// so errors.Is(err, fs.ErrNotExist) works too.
+var ErrNotExist = fs.ErrNotExist
+
+// Storage is the interface for file systems that work with streams rather than local files.
+// Keys are slash separated paths such as avatars/ada.png. Every method takes a context, which
+// bounds network calls.
+type Storage interface {
+	Creator
+	// Open opens the file key for reading; the caller must close it
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat describes the file key
+	Stat(ctx context.Context, key string) (FileInfo, error)
+	// Exists reports whether the file key exists
+	Exists(ctx context.Context, key string) (bool, error)
+	// Copy copies the file src to dst, replacing dst if it exists
+	Copy(ctx context.Context, src, dst string) error
+	// Move moves the file src to dst, replacing dst if it exists
+	Move(ctx context.Context, src, dst string) error
+	// Delete deletes the files keys. Keys that do not exist are not an error.
+	Delete(ctx context.Context, keys ...string) error
+	// List describes every file whose key starts with prefix, in all folders below it
+	List(ctx context.Context, prefix string) ([]FileInfo, error)
+}
+
+// StorageProvider is implemented by file systems whose files can be reached as a Storage,
+// alongside the methods of FS
+type StorageProvider interface {
+	Storage() Storage
+}
+
+// FileInfo describes a file in a Storage
+type FileInfo struct {
+	Key string
+	// Size is the size of the file in bytes
+	Size int64
+	LastModified time.Time
+	Etag string
+	ContentType string
+	IsDir bool
+}
+
+// CopyStream copies src to dst by reading it and writing it back, for file systems that
+// cannot copy on the server
+func CopyStream(ctx context.Context, s Storage, src, dst string) error {
+	info, err := s.Stat(ctx, src)
+	if err != nil {
+		return err
+	}
+
+	r, err := s.Open(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return s.Create(ctx, dst, r, CreateOptions{ContentType: info.ContentType, Size: info.Size})
+}
+
+// MoveByCopy moves src to dst by copying it and deleting src, for file systems that cannot
+// rename files
+func MoveByCopy(ctx context.Context, s Storage, src, dst string) error {
+	if err := s.Copy(ctx, src, dst); err != nil {
+		return err
+	}
+	return s.Delete(ctx, src)
+}
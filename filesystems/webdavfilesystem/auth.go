@@ -0,0 +1,185 @@
+package webdavfilesystem
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// challenge is what a server asked for in its WWW-Authenticate header
+type challenge struct {
+	scheme string
+	params map[string]string
+
+	mu sync.Mutex
+	// nc counts the requests made with the nonce, as digest authentication requires
+	nc uint32
+}
+
+// challenges holds the last challenge of each server and user, so that requests carry their
+// credentials from the start rather than being sent twice. WebDAV values are copied freely, so
+// the challenges cannot live in them.
+var challenges = struct {
+	sync.Mutex
+	m map[string]*challenge
+}{m: make(map[string]*challenge)}
+
+func (w *WebDAV) challengeKey() string {
+	return w.Host + "\x00" + w.User
+}
+
+func (w *WebDAV) challenge() *challenge {
+	challenges.Lock()
+	defer challenges.Unlock()
+	return challenges.m[w.challengeKey()]
+}
+
+func (w *WebDAV) setChallenge(c *challenge) {
+	challenges.Lock()
+	defer challenges.Unlock()
+	challenges.m[w.challengeKey()] = c
+}
+
+// parseChallenge returns the strongest challenge of a 401 response: digest, or else basic
+func parseChallenge(resp *http.Response) *challenge {
+	var basic *challenge
+
+	for _, header := range resp.Header.Values("WWW-Authenticate") {
+		scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+
+		switch strings.ToLower(scheme) {
+		case "digest":
+			return &challenge{scheme: "digest", params: parseParams(rest)}
+		case "basic":
+			basic = &challenge{scheme: "basic", params: parseParams(rest)}
+		}
+	}
+
+	return basic
+}
+
+// parseParams parses the comma separated name=value and name="quoted value" pairs of a
+// challenge
+func parseParams(s string) map[string]string {
+	params := make(map[string]string)
+
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimLeft(s, ", ") {
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		rest = strings.TrimSpace(rest)
+
+		var value strings.Builder
+		if strings.HasPrefix(rest, `"`) {
+			i := 1
+			for ; i < len(rest) && rest[i] != '"'; i++ {
+				if rest[i] == '\\' && i+1 < len(rest) {
+					i++
+				}
+				value.WriteByte(rest[i])
+			}
+			if i < len(rest) {
+				i++
+			}
+			s = rest[i:]
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				end = len(rest)
+			}
+			value.WriteString(strings.TrimSpace(rest[:end]))
+			s = rest[end:]
+		}
+
+		params[name] = value.String()
+	}
+
+	return params
+}
+
+// authorize adds the Authorization header that answers c to req
+func (c *challenge) authorize(req *http.Request, user, pass string) error {
+	if c.scheme == "basic" {
+		req.SetBasicAuth(user, pass)
+		return nil
+	}
+
+	algorithm := c.params["algorithm"]
+	var newHash func() hash.Hash
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5", "MD5-SESS":
+		newHash = md5.New
+	case "SHA-256", "SHA-256-SESS":
+		newHash = sha256.New
+	default:
+		return fmt.Errorf("webdav: unsupported digest algorithm %s", algorithm)
+	}
+
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	cnonce := hex.EncodeToString(b)
+
+	c.mu.Lock()
+	c.nc++
+	nc := fmt.Sprintf("%08x", c.nc)
+	c.mu.Unlock()
+
+	realm, nonce := c.params["realm"], c.params["nonce"]
+	uri := req.URL.RequestURI()
+
+	ha1 := h(user + ":" + realm + ":" + pass)
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(c.params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	var response string
+	if qop == "" {
+		response = h(ha1 + ":" + nonce + ":" + ha2)
+	} else {
+		response = h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username=%s, realm=%s, nonce=%s, uri=%s, response=%s`,
+		quote(user), quote(realm), quote(nonce), quote(uri), quote(response))
+	if algorithm != "" {
+		header += ", algorithm=" + algorithm
+	}
+	if qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce=%s`, qop, nc, quote(cnonce))
+	}
+	if opaque, ok := c.params["opaque"]; ok {
+		header += ", opaque=" + quote(opaque)
+	}
+
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// quote returns s as an HTTP quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -1,26 +1,500 @@
 package webdavfilesystem
 
-import "github.com/shaynemeyer/rasant/filesystems"
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
 
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+// WebDAV stores files on a WebDAV server, logging in with basic or digest authentication,
+// whichever the server asks for. Its methods implement filesystems.FS; Storage gives access to
+// the same files as a filesystems.Storage.
 type WebDAV struct {
+	// Host is the URL of the folder that keys are relative to, such as
+	// https://dav.example.com/remote.php/dav/files/ada/
 	Host string
 	User string
 	Pass string
 }
 
+// propfind asks for the properties that describe a file
+var propfind = []byte(`<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop>
+<D:resourcetype/><D:getcontentlength/><D:getlastmodified/><D:getetag/><D:getcontenttype/>
+</D:prop></D:propfind>`)
+
+// multistatus is the body of a PROPFIND response
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+				ContentLength string `xml:"DAV: getcontentlength"`
+				LastModified string `xml:"DAV: getlastmodified"`
+				Etag string `xml:"DAV: getetag"`
+				ContentType string `xml:"DAV: getcontenttype"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+// base returns Host as a URL whose path ends in a slash
+func (w *WebDAV) base() (*url.URL, error) {
+	u, err := url.Parse(w.Host)
+	if err != nil {
+		return nil, fmt.Errorf("webdav: host: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webdav: host %s must be an http or https URL", w.Host)
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	u.RawPath = ""
+
+	return u, nil
+}
+
+// url returns the URL of key, which is a folder when dir is true
+func (w *WebDAV) url(key string, dir bool) (string, error) {
+	u, err := w.base()
+	if err != nil {
+		return "", err
+	}
+
+	key = strings.Trim(path.Clean("/"+key), "/")
+	u.Path += key
+	if dir && key != "" {
+		u.Path += "/"
+	}
+
+	return u.String(), nil
+}
+
+// key returns the key of href, a URL or path in a PROPFIND response
+func (w *WebDAV) key(href string) (string, error) {
+	base, err := w.base()
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", fmt.Errorf("webdav: href %s: %w", href, err)
+	}
+
+	p := u.Path
+	if !strings.HasPrefix(p+"/", base.Path) {
+		return "", fmt.Errorf("webdav: href %s is outside of %s", href, base.Path)
+	}
+
+	return strings.Trim(strings.TrimPrefix(p, strings.TrimSuffix(base.Path, "/")), "/"), nil
+}
+
+// do sends a request to target, answering the server's authentication challenge. A body that
+// cannot be read twice is only sent once the challenge is known, since a request that is
+// turned away cannot be repeated.
+func (w *WebDAV) do(ctx context.Context, method, target string, header http.Header, body io.Reader, size int64) (*http.Response, error) {
+	c := w.challenge()
+
+	replayable := body == nil
+	switch body.(type) {
+	case *bytes.Reader, *bytes.Buffer, *strings.Reader:
+		replayable = true
+	}
+
+	if c == nil && !replayable && w.User != "" {
+		// learn the challenge with a request that has no body
+		resp, err := w.do(ctx, http.MethodOptions, target, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		c = w.challenge()
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if body != nil && size >= 0 {
+			req.ContentLength = size
+		}
+
+		if c != nil {
+			if err = c.authorize(req, w.User, w.Pass); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("webdav: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusUnauthorized || w.User == "" || attempt > 0 {
+			return resp, nil
+		}
+
+		// a first challenge, or a new nonce for an old one
+		next := parseChallenge(resp)
+		if next == nil {
+			return resp, nil
+		}
+		w.setChallenge(next)
+		if !replayable {
+			return resp, nil
+		}
+
+		resp.Body.Close()
+		c = next
+		if req.GetBody != nil {
+			if body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// statusError describes a response that was not a success
+func statusError(method, key string, resp *http.Response) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", key, filesystems.ErrNotExist)
+	}
+	return fmt.Errorf("webdav: %s %s: %s", method, key, resp.Status)
+}
+
+// propfind describes key, and with depth 1 the files in the folder key
+func (w *WebDAV) propfind(ctx context.Context, key string, depth string) ([]filesystems.FileInfo, error) {
+	target, err := w.url(key, depth != "0")
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := w.do(ctx, "PROPFIND", target, header, bytes.NewReader(propfind), int64(len(propfind)))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("PROPFIND", key, resp)
+	}
+
+	var ms multistatus
+	if err = xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("webdav: PROPFIND %s: %w", key, err)
+	}
+
+	var files []filesystems.FileInfo
+	for _, response := range ms.Responses {
+		fileKey, err := w.key(response.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		info := filesystems.FileInfo{Key: fileKey}
+		for _, propstat := range response.Propstats {
+			// properties the server does not have come in a propstat of their own, with a 404
+			if !strings.Contains(propstat.Status, " 200") {
+				continue
+			}
+
+			prop := propstat.Prop
+			info.IsDir = info.IsDir || prop.ResourceType.Collection != nil
+			if prop.ContentLength != "" {
+				info.Size, _ = strconv.ParseInt(prop.ContentLength, 10, 64)
+			}
+			if prop.LastModified != "" {
+				info.LastModified, _ = http.ParseTime(prop.LastModified)
+			}
+			if prop.Etag != "" {
+				info.Etag = strings.Trim(strings.TrimPrefix(prop.Etag, "W/"), `"`)
+			}
+			if prop.ContentType != "" {
+				info.ContentType = prop.ContentType
+			}
+		}
+
+		files = append(files, info)
+	}
+
+	return files, nil
+}
+
+// Put uploads the local file fileName into folder, creating the folder if needed
 func (w *WebDAV) Put(fileName, folder string) error {
-	return nil
+	return filesystems.Legacy(w.Storage()).Put(fileName, folder)
 }
 
+// Get downloads items into the local folder destination
+func (w *WebDAV) Get(destination string, items ...string) error {
+	return filesystems.Legacy(w.Storage()).Get(destination, items...)
+}
+
+// List lists the files and folders under prefix, leaving out hidden files; Size is in megabytes
 func (w *WebDAV) List(prefix string) ([]filesystems.Listing, error) {
-  var listing []filesystems.Listing
-	return listing, nil
+	return filesystems.Legacy(w.Storage()).List(prefix)
 }
 
+// Delete deletes itemsToDelete, reporting failure as false
 func (w *WebDAV) Delete(itemsToDelete []string) bool {
-	return true
+	return filesystems.Legacy(w.Storage()).Delete(itemsToDelete)
 }
 
-func (w *WebDAV) Get(destination string, items ...string) error {
-  return nil
-}
\ No newline at end of file
+// Storage returns the server's files as a filesystems.Storage. It has a value receiver, so
+// that the WebDAV values kept in Rasant.FileSystems provide it too.
+func (w WebDAV) Storage() filesystems.Storage {
+	return storage{w: &w}
+}
+
+// storage implements filesystems.Storage for a WebDAV
+type storage struct {
+	w *WebDAV
+}
+
+// mkdirAll creates the folder dir and the folders above it that do not exist yet
+func (st storage) mkdirAll(ctx context.Context, dir string) error {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return nil
+	}
+
+	if info, err := st.Stat(ctx, dir); err == nil {
+		if !info.IsDir {
+			return fmt.Errorf("webdav: %s is not a folder", dir)
+		}
+		return nil
+	} else if !errors.Is(err, filesystems.ErrNotExist) {
+		return err
+	}
+
+	if err := st.mkdirAll(ctx, path.Dir(dir)); err != nil {
+		return err
+	}
+
+	target, err := st.w.url(dir, true)
+	if err != nil {
+		return err
+	}
+
+	resp, err := st.w.do(ctx, "MKCOL", target, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// 405 means the folder was created in the meantime
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return statusError("MKCOL", dir, resp)
+	}
+	return nil
+}
+
+// Create stores the content of r as key, creating its folders if needed
+func (st storage) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	if err := st.mkdirAll(ctx, path.Dir(key)); err != nil {
+		return err
+	}
+
+	target, err := st.w.url(key, false)
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	if opts.ContentType != "" {
+		header.Set("Content-Type", opts.ContentType)
+	}
+
+	resp, err := st.w.do(ctx, http.MethodPut, target, header, r, opts.Size)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusError("PUT", key, resp)
+	}
+	return nil
+}
+
+func (st storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	target, err := st.w.url(key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := st.w.do(ctx, http.MethodGet, target, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, statusError("GET", key, resp)
+	}
+
+	return resp.Body, nil
+}
+
+func (st storage) Stat(ctx context.Context, key string) (filesystems.FileInfo, error) {
+	files, err := st.w.propfind(ctx, key, "0")
+	if err != nil {
+		return filesystems.FileInfo{}, err
+	}
+	if len(files) == 0 {
+		return filesystems.FileInfo{}, fmt.Errorf("%s: %w", key, filesystems.ErrNotExist)
+	}
+
+	return files[0], nil
+}
+
+func (st storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := st.Stat(ctx, key)
+	if errors.Is(err, filesystems.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Copy copies src to dst on the server
+func (st storage) Copy(ctx context.Context, src, dst string) error {
+	return st.copyOrMove(ctx, "COPY", src, dst)
+}
+
+// Move moves src to dst on the server
+func (st storage) Move(ctx context.Context, src, dst string) error {
+	return st.copyOrMove(ctx, "MOVE", src, dst)
+}
+
+func (st storage) copyOrMove(ctx context.Context, method, src, dst string) error {
+	if err := st.mkdirAll(ctx, path.Dir(dst)); err != nil {
+		return err
+	}
+
+	target, err := st.w.url(src, false)
+	if err != nil {
+		return err
+	}
+	destination, err := st.w.url(dst, false)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{"Destination": {destination}, "Overwrite": {"T"}}
+	resp, err := st.w.do(ctx, method, target, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return statusError(method, src, resp)
+	}
+	return nil
+}
+
+// Delete deletes keys, carrying on past errors and returning the first
+func (st storage) Delete(ctx context.Context, keys ...string) error {
+	var firstErr error
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := st.delete(ctx, key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func (st storage) delete(ctx context.Context, key string) error {
+	target, err := st.w.url(key, false)
+	if err != nil {
+		return err
+	}
+
+	resp, err := st.w.do(ctx, http.MethodDelete, target, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return statusError("DELETE", key, resp)
+	}
+	return nil
+}
+
+// List describes every file and folder whose path starts with prefix, going down the folders
+// one level at a time, as many servers refuse PROPFIND requests of infinite depth
+func (st storage) List(ctx context.Context, prefix string) ([]filesystems.FileInfo, error) {
+	var files []filesystems.FileInfo
+
+	// start from the folder holding the prefix; docs/re lists docs/report.pdf and docs/reports/
+	root := strings.TrimPrefix(prefix, "/")
+	if !strings.HasSuffix(root, "/") {
+		root = path.Dir(root)
+	}
+	root = strings.Trim(path.Clean("/"+root), "/")
+
+	err := st.walk(ctx, root, strings.TrimPrefix(prefix, "/"), &files)
+	if errors.Is(err, filesystems.ErrNotExist) {
+		return files, nil
+	}
+
+	return files, err
+}
+
+func (st storage) walk(ctx context.Context, dir, prefix string, files *[]filesystems.FileInfo) error {
+	entries, err := st.w.propfind(ctx, dir, "1")
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Key == dir {
+			continue
+		}
+
+		matches := strings.HasPrefix(entry.Key, prefix)
+		if matches {
+			*files = append(*files, entry)
+		}
+
+		// go into folders under the prefix, and into those that lead to it
+		if entry.IsDir && (matches || strings.HasPrefix(prefix, entry.Key+"/")) {
+			if err := st.walk(ctx, entry.Key, prefix, files); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
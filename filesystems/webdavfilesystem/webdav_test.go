@@ -0,0 +1,361 @@
+package webdavfilesystem
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shaynemeyer/rasant/filesystems"
+	"golang.org/x/net/webdav"
+)
+
+var (
+	_ filesystems.FS = (*WebDAV)(nil)
+	_ filesystems.StorageProvider = WebDAV{}
+)
+
+// testServer serves an in-memory WebDAV file system under /dav/
+type testServer struct {
+	*httptest.Server
+
+	mu sync.Mutex
+	// challenges counts the requests turned away for want of credentials
+	challenges int
+	// lastNC is the last nonce count of each digest cnonce, to catch reused counts
+	lastNC map[string]string
+}
+
+// newTestServer starts a server that asks for basic or digest authentication
+func newTestServer(t *testing.T, scheme string) *testServer {
+	t.Helper()
+
+	server := &testServer{lastNC: make(map[string]string)}
+
+	var handler http.Handler = &webdav.Handler{
+		Prefix: "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	if scheme == "digest" {
+		handler = server.digestAuth(handler)
+	} else {
+		handler = server.basicAuth(handler)
+	}
+
+	server.Server = httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (server *testServer) challenge(w http.ResponseWriter, header string) {
+	server.mu.Lock()
+	server.challenges++
+	server.mu.Unlock()
+
+	w.Header().Set("WWW-Authenticate", header)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+}
+
+func (server *testServer) basicAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ada" || pass != "secret" {
+			server.challenge(w, `Basic realm="files"`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (server *testServer) digestAuth(next http.Handler) http.Handler {
+	const realm, nonce, opaque = "files", "dcd98b7102dd2f0e8b11d0f600bfb0c093", "5ccc069c403ebaf9f0171e9517f40e41"
+
+	md5Hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, rest, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+		params := parseParams(rest)
+
+		ha1 := md5Hex("ada:" + realm + ":secret")
+		ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+		want := md5Hex(ha1 + ":" + nonce + ":" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+
+		server.mu.Lock()
+		fresh := params["nc"] > server.lastNC[params["cnonce"]]
+		server.lastNC[params["cnonce"]] = params["nc"]
+		server.mu.Unlock()
+
+		if scheme != "Digest" || params["username"] != "ada" || params["uri"] != r.URL.RequestURI() ||
+			params["opaque"] != opaque || params["response"] != want || !fresh {
+			server.challenge(w, `Digest realm="`+realm+`", qop="auth,auth-int", nonce="`+nonce+`", opaque="`+opaque+`"`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (server *testServer) challengeCount() int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.challenges
+}
+
+func (server *testServer) client(pass string) *WebDAV {
+	return &WebDAV{Host: server.URL + "/dav", User: "ada", Pass: pass}
+}
+
+func TestWebDAV_CreateAndOpen(t *testing.T) {
+	server := newTestServer(t, "basic")
+	w := server.client("secret")
+	ctx := context.Background()
+
+	err := w.Storage().Create(ctx, "docs/2023/hello world.txt", strings.NewReader("hello"), filesystems.CreateOptions{ContentType: "text/plain", Size: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := w.Storage().Open(ctx, "docs/2023/hello world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "hello" {
+		t.Errorf("wrong content: %q", b)
+	}
+
+	info, err := w.Storage().Stat(ctx, "docs/2023/hello world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Key != "docs/2023/hello world.txt" || info.Size != 5 || info.IsDir || info.Etag == "" || info.LastModified.IsZero() {
+		t.Errorf("wrong info: %+v", info)
+	}
+
+	info, err = w.Storage().Stat(ctx, "docs/2023")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir {
+		t.Errorf("expected docs/2023 to be a folder: %+v", info)
+	}
+
+	if _, err = w.Storage().Open(ctx, "docs/missing.txt"); !errors.Is(err, filesystems.ErrNotExist) {
+		t.Errorf("expected ErrNotExist opening a missing file, got %v", err)
+	}
+
+	ok, err := w.Storage().Exists(ctx, "docs/missing.txt")
+	if ok || err != nil {
+		t.Errorf("expected a missing file not to exist, got %v, %v", ok, err)
+	}
+}
+
+func TestWebDAV_DigestAuth(t *testing.T) {
+	server := newTestServer(t, "digest")
+	w := server.client("secret")
+	ctx := context.Background()
+
+	// a body that cannot be read twice is held back until the challenge is known
+	err := w.Storage().Create(ctx, "a.txt", io.MultiReader(strings.NewReader("digest")), filesystems.CreateOptions{Size: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := w.Storage().Open(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r)
+	r.Close()
+	if string(b) != "digest" {
+		t.Errorf("wrong content: %q", b)
+	}
+
+	// the challenge is remembered, so only the first request is turned away
+	if n := server.challengeCount(); n != 1 {
+		t.Errorf("expected 1 challenge, got %d", n)
+	}
+}
+
+func TestWebDAV_WrongPassword(t *testing.T) {
+	for _, scheme := range []string{"basic", "digest"} {
+		server := newTestServer(t, scheme)
+		w := server.client("wrong")
+
+		if _, err := w.Storage().Stat(context.Background(), "a.txt"); err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("%s: expected a wrong password to fail, got %v", scheme, err)
+		}
+	}
+}
+
+func TestWebDAV_List(t *testing.T) {
+	server := newTestServer(t, "basic")
+	w := server.client("secret")
+	ctx := context.Background()
+
+	for _, key := range []string{"a/1.txt", "a/b/2.txt", "a/b/c/3.txt", "ab.txt", "c/4.txt"} {
+		if err := w.Storage().Create(ctx, key, strings.NewReader(key), filesystems.CreateOptions{Size: int64(len(key))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		keys string
+	}{
+		{"a/", "a/1.txt a/b/ a/b/2.txt a/b/c/ a/b/c/3.txt"},
+		{"a", "a/ a/1.txt a/b/ a/b/2.txt a/b/c/ a/b/c/3.txt ab.txt"},
+		{"a/b/c", "a/b/c/ a/b/c/3.txt"},
+		{"", "a/ a/1.txt a/b/ a/b/2.txt a/b/c/ a/b/c/3.txt ab.txt c/ c/4.txt"},
+		{"missing/", ""},
+	}
+
+	for _, tt := range tests {
+		files, err := w.Storage().List(ctx, tt.prefix)
+		if err != nil {
+			t.Errorf("%q: %v", tt.prefix, err)
+			continue
+		}
+
+		var keys []string
+		for _, file := range files {
+			if file.IsDir {
+				keys = append(keys, file.Key+"/")
+				continue
+			}
+
+			keys = append(keys, file.Key)
+			if file.Size != int64(len(file.Key)) || file.Etag == "" || file.LastModified.IsZero() {
+				t.Errorf("wrong info for %s: %+v", file.Key, file)
+			}
+		}
+		sort.Strings(keys)
+
+		if strings.Join(keys, " ") != tt.keys {
+			t.Errorf("%q: wrong keys: %v", tt.prefix, keys)
+		}
+	}
+
+	listing, err := w.List("a/b/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range listing {
+		if item.IsDir != (item.Key == "a/b/c") {
+			t.Errorf("wrong IsDir for %s", item.Key)
+		}
+	}
+}
+
+func TestWebDAV_CopyMoveAndDelete(t *testing.T) {
+	server := newTestServer(t, "basic")
+	w := server.client("secret")
+	ctx := context.Background()
+
+	for _, key := range []string{"a.txt", "b.txt"} {
+		if err := w.Storage().Create(ctx, key, strings.NewReader(key), filesystems.CreateOptions{Size: int64(len(key))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Storage().Copy(ctx, "a.txt", "copies/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// moving onto an existing file replaces it
+	if err := w.Storage().Move(ctx, "a.txt", "b.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{"copies/a.txt": "a.txt", "b.txt": "a.txt"} {
+		r, err := w.Storage().Open(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r)
+		r.Close()
+		if string(b) != want {
+			t.Errorf("%s: wrong content %q", key, b)
+		}
+	}
+
+	if err := w.Storage().Copy(ctx, "missing.txt", "c.txt"); !errors.Is(err, filesystems.ErrNotExist) {
+		t.Errorf("expected ErrNotExist copying a missing file, got %v", err)
+	}
+
+	if err := w.Storage().Delete(ctx, "b.txt", "copies/a.txt", "missing.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"a.txt", "b.txt", "copies/a.txt"} {
+		if ok, _ := w.Storage().Exists(ctx, key); ok {
+			t.Errorf("expected %s to be gone", key)
+		}
+	}
+}
+
+func TestWebDAV_PutAndGet(t *testing.T) {
+	server := newTestServer(t, "digest")
+	w := server.client("secret")
+	dir := t.TempDir()
+
+	fileName := filepath.Join(dir, "report.txt")
+	if err := os.WriteFile(fileName, []byte("report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the folder does not exist yet
+	if err := w.Put(fileName, "reports/2023"); err != nil {
+		t.Fatal(err)
+	}
+
+	downloads := filepath.Join(dir, "downloads")
+	if err := os.Mkdir(downloads, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Get(downloads, "reports/2023/report.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(downloads, "report.txt"))
+	if err != nil || string(b) != "report" {
+		t.Errorf("wrong download: %q, %v", b, err)
+	}
+
+	if !w.Delete([]string{"reports/2023/report.txt"}) {
+		t.Error("expected the delete to succeed")
+	}
+	if ok, _ := w.Storage().Exists(context.Background(), "reports/2023/report.txt"); ok {
+		t.Error("expected the report to be gone")
+	}
+}
+
+func TestParseParams(t *testing.T) {
+	params := parseParams(`realm="a \"quoted\", realm", qop="auth,auth-int", algorithm=MD5, stale=true`)
+
+	want := map[string]string{
+		"realm": `a "quoted", realm`,
+		"qop": "auth,auth-int",
+		"algorithm": "MD5",
+		"stale": "true",
+	}
+	for name, value := range want {
+		if params[name] != value {
+			t.Errorf("%s: got %q, want %q", name, params[name], value)
+		}
+	}
+}
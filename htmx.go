@@ -0,0 +1,136 @@
+package rasant
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/shaynemeyer/rasant/render"
+)
+
+// IsHTMX reports whether r was made by HTMX
+func (ras *Rasant) IsHTMX(r *http.Request) bool {
+	return render.IsHTMX(r)
+}
+
+// HXRedirect tells HTMX to load url as a full page. Other clients get an ordinary redirect.
+func (ras *Rasant) HXRedirect(w http.ResponseWriter, r *http.Request, url string) {
+	if !render.IsHTMX(r) {
+		http.Redirect(w, r, url, http.StatusSeeOther)
+		return
+	}
+
+	w.Header().Set("HX-Redirect", url)
+	w.WriteHeader(http.StatusOK)
+}
+
+// HXTrigger makes HTMX fire event on the client once the response is swapped in. When detail
+// is given, it is sent along with the event as JSON. Calls add up: all events go in one
+// HX-Trigger header, which becomes a JSON object once any of them has a detail.
+func (ras *Rasant) HXTrigger(w http.ResponseWriter, event string, detail ...interface{}) error {
+	names, details, err := parseHXTrigger(w.Header().Values("HX-Trigger"))
+	if err != nil {
+		return err
+	}
+
+	if _, ok := details[event]; !ok {
+		names = append(names, event)
+	}
+	details[event] = nil
+
+	if len(detail) > 0 {
+		b, err := json.Marshal(detail[0])
+		if err != nil {
+			return err
+		}
+		details[event] = b
+	}
+
+	w.Header().Set("HX-Trigger", formatHXTrigger(names, details))
+	return nil
+}
+
+// parseHXTrigger reads HX-Trigger headers, which hold either comma separated event names or a
+// JSON object of events and their details. It returns the names in order, and their details,
+// nil for events without one.
+func parseHXTrigger(values []string) ([]string, map[string]json.RawMessage, error) {
+	var names []string
+	details := make(map[string]json.RawMessage)
+	add := func(name string, detail json.RawMessage) {
+		if _, ok := details[name]; !ok {
+			names = append(names, name)
+		}
+		details[name] = detail
+	}
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(value, "{") {
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					add(name, nil)
+				}
+			}
+			continue
+		}
+
+		dec := json.NewDecoder(strings.NewReader(value))
+		if _, err := dec.Token(); err != nil {
+			return nil, nil, err
+		}
+		for dec.More() {
+			token, err := dec.Token()
+			if err != nil {
+				return nil, nil, err
+			}
+			var detail json.RawMessage
+			if err := dec.Decode(&detail); err != nil {
+				return nil, nil, err
+			}
+			add(token.(string), detail)
+		}
+	}
+
+	return names, details, nil
+}
+
+// formatHXTrigger writes events as comma separated names, or as a JSON object when any of them
+// has a detail
+func formatHXTrigger(names []string, details map[string]json.RawMessage) string {
+	withDetail := false
+	for _, detail := range details {
+		withDetail = withDetail || detail != nil
+	}
+	if !withDetail {
+		return strings.Join(names, ", ")
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, _ := json.Marshal(name)
+		b.Write(key)
+		b.WriteString(":")
+		if details[name] == nil {
+			b.WriteString("null")
+		} else {
+			b.Write(details[name])
+		}
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// HXRefresh tells HTMX to reload the whole page
+func (ras *Rasant) HXRefresh(w http.ResponseWriter) {
+	w.Header().Set("HX-Refresh", "true")
+}
+
+// HXRetarget tells HTMX to swap the response into the element matching selector instead of
+// the request's target
+func (ras *Rasant) HXRetarget(w http.ResponseWriter, selector string) {
+	w.Header().Set("HX-Retarget", selector)
+}
@@ -0,0 +1,58 @@
+package rasant
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHXTrigger(t *testing.T) {
+	ras := &Rasant{}
+
+	w := httptest.NewRecorder()
+	_ = ras.HXTrigger(w, "saved")
+	_ = ras.HXTrigger(w, "closeModal")
+	if got := w.Header().Values("HX-Trigger"); len(got) != 1 || got[0] != "saved, closeModal" {
+		t.Errorf("expected the events in one header, got %q", got)
+	}
+
+	// a detail turns the header into an object, keeping the events before it
+	if err := ras.HXTrigger(w, "showMessage", map[string]string{"level": "info"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ras.HXTrigger(w, "count", 3); err != nil {
+		t.Fatal(err)
+	}
+	_ = ras.HXTrigger(w, "saved")
+
+	got := w.Header().Values("HX-Trigger")
+	if len(got) != 1 {
+		t.Fatalf("expected one header, got %q", got)
+	}
+	if got[0] != `{"saved":null,"closeModal":null,"showMessage":{"level":"info"},"count":3}` {
+		t.Errorf("wrong header %s", got[0])
+	}
+
+	var events map[string]interface{}
+	if err := json.Unmarshal([]byte(got[0]), &events); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"saved": nil, "closeModal": nil, "showMessage": map[string]interface{}{"level": "info"}, "count": 3.0}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("expected %v, got %v", want, events)
+	}
+
+	// a header set by hand is merged too
+	w = httptest.NewRecorder()
+	w.Header().Set("HX-Trigger", `{"a":1}`)
+	w.Header().Add("HX-Trigger", "b")
+	_ = ras.HXTrigger(w, "a", 2)
+	if got := w.Header().Get("HX-Trigger"); got != `{"a":2,"b":null}` {
+		t.Errorf("wrong merged header %s", got)
+	}
+
+	if err := ras.HXTrigger(w, "bad", func() {}); err == nil {
+		t.Error("expected a detail that is not JSON to fail")
+	}
+}
@@ -0,0 +1,214 @@
+// Package i18n holds the translations of an application and works out which locale a request
+// wants.
+package i18n
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Catalog holds messages by locale. Keys are dotted paths, so the JSON file
+//
+//	{"auth": {"login": "Log in"}}
+//
+// defines the key auth.login.
+type Catalog struct {
+	// DefaultLocale is used when a request asks for no supported locale, and for keys that are
+	// missing in the locale asked for
+	DefaultLocale string
+
+	mu sync.RWMutex
+	messages map[string]map[string]string
+}
+
+// New returns an empty catalog
+func New(defaultLocale string) *Catalog {
+	return &Catalog{
+		DefaultLocale: normalize(defaultLocale),
+		messages: make(map[string]map[string]string),
+	}
+}
+
+// Load adds every <locale>.json, <locale>.yaml and <locale>.yml file at the root of fsys to
+// the catalog, e.g. lang/en.json and lang/pt-BR.yaml. A missing folder is not an error.
+func (c *Catalog) Load(fsys fs.FS) error {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		ext := path.Ext(name)
+
+		switch ext {
+		case ".json", ".yaml", ".yml":
+		default:
+			continue
+		}
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+
+		var messages map[string]interface{}
+		if ext == ".json" {
+			err = json.Unmarshal(content, &messages)
+		} else {
+			err = yaml.Unmarshal(content, &messages)
+		}
+		if err != nil {
+			return fmt.Errorf("i18n: %s: %w", name, err)
+		}
+
+		c.Add(strings.TrimSuffix(name, ext), messages)
+	}
+
+	return nil
+}
+
+// Add adds messages, which may be nested, to locale
+func (c *Catalog) Add(locale string, messages map[string]interface{}) {
+	locale = normalize(locale)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.messages == nil {
+		c.messages = make(map[string]map[string]string)
+	}
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string)
+	}
+	flatten(c.messages[locale], "", messages)
+}
+
+// flatten copies messages into dst, joining nested keys with dots
+func flatten(dst map[string]string, prefix string, messages interface{}) {
+	switch m := messages.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			flatten(dst, join(prefix, k), v)
+		}
+	case map[interface{}]interface{}:
+		// yaml.v2 decodes nested maps with interface keys
+		for k, v := range m {
+			flatten(dst, join(prefix, fmt.Sprint(k)), v)
+		}
+	case nil:
+	default:
+		dst[prefix] = fmt.Sprint(m)
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// Locales returns the locales that have messages, sorted
+func (c *Catalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	locales := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	return locales
+}
+
+// Supports reports whether the catalog has messages for locale
+func (c *Catalog) Supports(locale string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.messages[normalize(locale)]
+	return ok
+}
+
+// Lookup returns the message for key in locale. When locale does not have it, the language
+// without its region (pt for pt-BR) and then the default locale are tried.
+func (c *Catalog) Lookup(locale, key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, l := range c.fallbacks(normalize(locale)) {
+		if msg, ok := c.messages[l][key]; ok {
+			return msg, true
+		}
+	}
+
+	return "", false
+}
+
+// fallbacks lists the locales tried, in order, for locale
+func (c *Catalog) fallbacks(locale string) []string {
+	locales := []string{locale}
+	if i := strings.Index(locale, "-"); i > 0 {
+		locales = append(locales, locale[:i])
+	}
+	if c.DefaultLocale != "" && c.DefaultLocale != locale {
+		locales = append(locales, c.DefaultLocale)
+	}
+	return locales
+}
+
+// T translates key into locale, filling its placeholders from args (see Format). A key
+// without a message is returned as it is, so missing translations are easy to spot.
+func (c *Catalog) T(locale, key string, args ...interface{}) string {
+	msg, ok := c.Lookup(locale, key)
+	if !ok {
+		msg = key
+	}
+	return Format(msg, args...)
+}
+
+// Format fills the {name} placeholders of msg. args are pairs of names and values:
+//
+//	Format("Hello, {name}", "name", "Ada")
+func Format(msg string, args ...interface{}) string {
+	if len(args) < 2 || !strings.Contains(msg, "{") {
+		return msg
+	}
+
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+
+	return strings.NewReplacer(pairs...).Replace(msg)
+}
+
+// normalize turns locale names such as pt_br into pt-BR
+func normalize(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	parts := strings.SplitN(locale, "-", 2)
+
+	parts[0] = strings.ToLower(parts[0])
+	if len(parts) == 2 {
+		parts[1] = strings.ToUpper(parts[1])
+	}
+
+	return strings.Join(parts, "-")
+}
@@ -0,0 +1,165 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+func testCatalog(t *testing.T) *Catalog {
+	fsys := fstest.MapFS{
+		"en.json": {Data: []byte(`{"greeting": "Hello, {name}", "auth": {"login": "Log in", "logout": "Log out"}}`)},
+		"fr.yaml": {Data: []byte("greeting: Bonjour, {name}\nauth:\n  login: Se connecter\n")},
+		"pt_br.yml": {Data: []byte("auth:\n  login: Entrar\n")},
+		"readme.txt": {Data: []byte("not a translation")},
+	}
+
+	c := New("en")
+	if err := c.Load(fsys); err != nil {
+		t.Fatal(err)
+	}
+
+	return c
+}
+
+func TestCatalog_Load(t *testing.T) {
+	c := testCatalog(t)
+
+	locales := c.Locales()
+	if len(locales) != 3 || locales[0] != "en" || locales[1] != "fr" || locales[2] != "pt-BR" {
+		t.Error("wrong locales:", locales)
+	}
+
+	if err := New("en").Load(fstest.MapFS{"en.json": {Data: []byte(`{`)}}); err == nil {
+		t.Error("expected an error for a broken file")
+	}
+
+	if err := New("en").Load(fstest.MapFS{}); err != nil {
+		t.Error("an empty folder should not be an error:", err)
+	}
+}
+
+func TestCatalog_T(t *testing.T) {
+	c := testCatalog(t)
+
+	var tests = []struct {
+		locale string
+		key string
+		expected string
+	}{
+		{"fr", "auth.login", "Se connecter"},
+		{"fr", "auth.logout", "Log out"},
+		{"fr-CA", "auth.login", "Se connecter"},
+		{"pt-br", "auth.login", "Entrar"},
+		{"de", "auth.login", "Log in"},
+		{"", "auth.login", "Log in"},
+		{"en", "missing.key", "missing.key"},
+	}
+
+	for _, e := range tests {
+		if got := c.T(e.locale, e.key); got != e.expected {
+			t.Errorf("%s %s: expected %q, but got %q", e.locale, e.key, e.expected, got)
+		}
+	}
+
+	if got := c.T("fr", "greeting", "name", "Ada"); got != "Bonjour, Ada" {
+		t.Error("placeholders were not filled:", got)
+	}
+
+	if got := c.TContext(WithLocale(context.Background(), "fr"), "greeting", "name", "Ada"); got != "Bonjour, Ada" {
+		t.Error("context locale was not used:", got)
+	}
+}
+
+func TestCatalog_Match(t *testing.T) {
+	c := testCatalog(t)
+
+	var tests = []struct {
+		header string
+		expected string
+	}{
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr"},
+		{"de, en;q=0.5, fr;q=0.7", "fr"},
+		{"pt-BR", "pt-BR"},
+		{"de", "en"},
+		{"", "en"},
+		{"fr;q=0, en", "en"},
+	}
+
+	for _, e := range tests {
+		if got := c.Match(e.header); got != e.expected {
+			t.Errorf("%q: expected %s, but got %s", e.header, e.expected, got)
+		}
+	}
+}
+
+func TestCatalog_Middleware(t *testing.T) {
+	c := testCatalog(t)
+	sm := scs.New()
+
+	var locale, path string
+	handler := sm.LoadAndSave(c.Middleware(sm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale = Locale(r.Context())
+		path = r.URL.Path
+
+		if r.URL.Query().Get("pick") != "" {
+			sm.Put(r.Context(), SessionKey, r.URL.Query().Get("pick"))
+		}
+	})))
+
+	get := func(target, acceptLanguage string, cookie *http.Cookie) *http.Response {
+		r := httptest.NewRequest("GET", target, nil)
+		r.Header.Set("Accept-Language", acceptLanguage)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		// the middleware must not change the caller's request
+		if r.URL.RequestURI() != target {
+			t.Errorf("%s: the request was changed to %s", target, r.URL.RequestURI())
+		}
+		return w.Result()
+	}
+
+	get("/about", "fr", nil)
+	if locale != "fr" || path != "/about" {
+		t.Errorf("Accept-Language: got %s %s", locale, path)
+	}
+
+	get("/pt-br/about", "fr", nil)
+	if locale != "pt-BR" || path != "/about" {
+		t.Errorf("URL prefix: got %s %s", locale, path)
+	}
+
+	get("/fr", "", nil)
+	if locale != "fr" || path != "/" {
+		t.Errorf("URL prefix alone: got %s %s", locale, path)
+	}
+
+	get("/francais", "", nil)
+	if locale != "en" || path != "/francais" {
+		t.Errorf("unsupported prefix: got %s %s", locale, path)
+	}
+
+	res := get("/?pick=fr", "en", nil)
+	cookies := res.Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie")
+	}
+
+	get("/", "en", cookies[0])
+	if locale != "fr" {
+		t.Error("the session locale should win over Accept-Language, got", locale)
+	}
+
+	get("/en/", "fr", cookies[0])
+	if locale != "en" {
+		t.Error("the URL prefix should win over the session, got", locale)
+	}
+}
@@ -0,0 +1,138 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alexedwards/scs/v2"
+)
+
+// SessionKey is the session key holding the locale a user picked
+const SessionKey = "locale"
+
+type contextKey struct{}
+
+// WithLocale returns a copy of ctx carrying locale
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return context.WithValue(ctx, contextKey{}, normalize(locale))
+}
+
+// Locale returns the locale carried by ctx, or an empty string
+func Locale(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	locale, _ := ctx.Value(contextKey{}).(string)
+	return locale
+}
+
+// TContext translates key into the locale carried by ctx
+func (c *Catalog) TContext(ctx context.Context, key string, args ...interface{}) string {
+	return c.T(Locale(ctx), key, args...)
+}
+
+// Match returns the supported locale that best fits an Accept-Language header, or the default
+// locale
+func (c *Catalog) Match(acceptLanguage string) string {
+	type option struct {
+		locale string
+		q float64
+	}
+
+	var options []option
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" || fields[0] == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range fields[1:] {
+			if v := strings.TrimSpace(param); strings.HasPrefix(v, "q=") {
+				if parsed, err := strconv.ParseFloat(v[2:], 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if q > 0 {
+			options = append(options, option{normalize(fields[0]), q})
+		}
+	}
+
+	// keep the header's order among equal weights
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].q > options[j].q
+	})
+
+	for _, o := range options {
+		if c.Supports(o.locale) {
+			return o.locale
+		}
+		if i := strings.Index(o.locale, "-"); i > 0 && c.Supports(o.locale[:i]) {
+			return o.locale[:i]
+		}
+	}
+
+	return c.DefaultLocale
+}
+
+// Middleware works out the locale of each request and stores it in the request context,
+// where Locale finds it. The first of these wins:
+//
+//   - a supported locale as the first segment of the path, as in /fr/about; it is removed
+//     from the path before routing, so routes need not know about it
+//   - the locale stored in the session under SessionKey, when sm is not nil
+//   - the Accept-Language header
+//   - the default locale
+//
+// The session must be loaded before this middleware runs.
+func (c *Catalog) Middleware(sm *scs.SessionManager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			locale, rest, ok := c.fromPath(r.URL.Path)
+			if !ok {
+				if sm != nil && c.Supports(sm.GetString(r.Context(), SessionKey)) {
+					locale = normalize(sm.GetString(r.Context(), SessionKey))
+				} else {
+					locale = c.Match(r.Header.Get("Accept-Language"))
+				}
+			}
+
+			w.Header().Add("Vary", "Accept-Language")
+
+			ctx := WithLocale(r.Context(), locale)
+			if !ok {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// the request belongs to the caller; change the path on a copy of it
+			r2 := r.Clone(ctx)
+			r2.URL.Path = rest
+			r2.URL.RawPath = ""
+			next.ServeHTTP(w, r2)
+		})
+	}
+}
+
+// fromPath splits a leading supported locale off path
+func (c *Catalog) fromPath(path string) (string, string, bool) {
+	trimmed := strings.TrimPrefix(path, "/")
+
+	segment := trimmed
+	rest := "/"
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		segment = trimmed[:i]
+		rest = trimmed[i:]
+	}
+
+	if segment == "" || !c.Supports(segment) {
+		return "", path, false
+	}
+
+	return normalize(segment), rest, true
+}
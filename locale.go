@@ -0,0 +1,32 @@
+package rasant
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shaynemeyer/rasant/i18n"
+)
+
+// Locale returns the locale of the request that ctx belongs to, or the default locale
+func (ras *Rasant) Locale(ctx context.Context) string {
+	if locale := i18n.Locale(ctx); locale != "" {
+		return locale
+	}
+	return ras.I18n.DefaultLocale
+}
+
+// SetLocale remembers the locale the user picked in their session, so that later requests
+// use it instead of the browser's Accept-Language header
+func (ras *Rasant) SetLocale(ctx context.Context, locale string) error {
+	if !ras.I18n.Supports(locale) {
+		return fmt.Errorf("unsupported locale %s", locale)
+	}
+
+	ras.Session.Put(ctx, i18n.SessionKey, locale)
+	return nil
+}
+
+// T translates key into the locale of ctx
+func (ras *Rasant) T(ctx context.Context, key string, args ...interface{}) string {
+	return ras.I18n.T(ras.Locale(ctx), key, args...)
+}
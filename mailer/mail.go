@@ -2,13 +2,16 @@ package mailer
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"path/filepath"
 	"text/template"
 	"time"
 
 	apimail "github.com/ainsleyclark/go-mail"
+	"github.com/shaynemeyer/rasant/i18n"
 	"github.com/vanng822/go-premailer/premailer"
 	mail "github.com/xhit/go-simple-mail/v2"
 )
@@ -29,6 +32,22 @@ type Mail struct {
 	API string
 	APIKey string
 	APIUrl string
+	// FS, when set, holds the templates instead of the Templates folder
+	FS fs.FS
+	// Renderer, when set, lets mail use the application's views. A message whose template
+	// exists as the view mail/<template>.html (and mail/<template>.plain) is rendered with it;
+	// other messages use the templates in Templates.
+	Renderer Renderer
+	// I18n, when set, holds the translations used by the t function of the mail templates
+	I18n *i18n.Catalog
+}
+
+// Renderer renders application views to strings, translating into the locale carried by ctx.
+// TextToStringContext renders plain text, without HTML escaping.
+type Renderer interface {
+	Exists(view string) bool
+	ToStringContext(ctx context.Context, view string, variables, data interface{}) (string, error)
+	TextToStringContext(ctx context.Context, view string, variables, data interface{}) (string, error)
 }
 
 // Message is the type for an email message
@@ -40,6 +59,8 @@ type Message struct {
 	Template string
 	Attachments []string
 	Data interface{}
+	// Locale is the recipient's locale, used by t in the templates; the default locale when empty
+	Locale string
 }
 
 // Result contains information regarding the status of the sent email message
@@ -220,9 +241,15 @@ func (m *Mail) getEncryption(e string) mail.Encryption {
 
 // buildHTMLMessage creates the html version of the message
 func (m *Mail) buildHTMLMessage(msg Message) (string, error) {
-	templateToRender := fmt.Sprintf("%s/%s.html.tmpl",m.Templates, msg.Template)
+	if view := fmt.Sprintf("mail/%s.html", msg.Template); m.Renderer != nil && m.Renderer.Exists(view) {
+		formattedMessage, err := m.Renderer.ToStringContext(msg.context(), view, nil, msg.Data)
+		if err != nil {
+			return "", err
+		}
+		return m.inlineCSS(formattedMessage)
+	}
 
-	t, err := template.New("email-html").ParseFiles(templateToRender)
+	t, err := m.parseTemplate(fmt.Sprintf("%s.html.tmpl", msg.Template), msg.Locale)
 	if err != nil {
     return "", err
   }
@@ -243,9 +270,11 @@ func (m *Mail) buildHTMLMessage(msg Message) (string, error) {
 
 // buildPlainTextMessage creates the plaintext version of the message
 func (m *Mail) buildPlainTextMessage(msg Message) (string, error) {
-	templateToRender := fmt.Sprintf("%s/%s.plain.tmpl",m.Templates, msg.Template)
+	if view := fmt.Sprintf("mail/%s.plain", msg.Template); m.Renderer != nil && m.Renderer.Exists(view) {
+		return m.Renderer.TextToStringContext(msg.context(), view, nil, msg.Data)
+	}
 
-	t, err := template.New("email-html").ParseFiles(templateToRender)
+	t, err := m.parseTemplate(fmt.Sprintf("%s.plain.tmpl", msg.Template), msg.Locale)
 	if err != nil {
     return "", err
   }
@@ -260,6 +289,33 @@ func (m *Mail) buildPlainTextMessage(msg Message) (string, error) {
 	return plainMessage, nil
 }
 
+// context returns a context carrying the message's locale
+func (msg Message) context() context.Context {
+	ctx := context.Background()
+	if msg.Locale != "" {
+		ctx = i18n.WithLocale(ctx, msg.Locale)
+	}
+	return ctx
+}
+
+// parseTemplate parses the named mail template from FS, or from the Templates folder. Its t
+// function translates into locale.
+func (m *Mail) parseTemplate(name, locale string) (*template.Template, error) {
+	t := template.New("email-html").Funcs(template.FuncMap{
+		"t": func(key string, args ...interface{}) string {
+			if m.I18n == nil {
+				return i18n.Format(key, args...)
+			}
+			return m.I18n.T(locale, key, args...)
+		},
+	})
+
+	if m.FS != nil {
+		return t.ParseFS(m.FS, name)
+	}
+	return t.ParseFiles(fmt.Sprintf("%s/%s", m.Templates, name))
+}
+
 // inlineCSS takes html input as a string, and inlines css where possible
 func (m *Mail) inlineCSS(s string) (string, error) {
 	options := premailer.Options{
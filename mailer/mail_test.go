@@ -1,8 +1,13 @@
 package mailer
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"testing"
+	"testing/fstest"
+
+	"github.com/shaynemeyer/rasant/i18n"
 )
 
 func TestMail_SendSMTPMessage(t *testing.T) {
@@ -141,4 +146,105 @@ func TestMail_ChooseAPI(t *testing.T) {
 	if err == nil {
 		t.Error(err)
 	}
-}
\ No newline at end of file
+}
+// fakeRenderer renders the view mail/welcome.html and mail/welcome.plain
+type fakeRenderer struct{}
+
+func (fakeRenderer) Exists(view string) bool {
+	return view == "mail/welcome.html" || view == "mail/welcome.plain"
+}
+
+func (fakeRenderer) ToStringContext(ctx context.Context, view string, variables, data interface{}) (string, error) {
+	return "<p>Welcome</p>", nil
+}
+
+func (fakeRenderer) TextToStringContext(ctx context.Context, view string, variables, data interface{}) (string, error) {
+	return "Welcome, O'Brien", nil
+}
+
+func TestMail_Renderer(t *testing.T) {
+	m := mailer
+	m.Renderer = fakeRenderer{}
+
+	html, err := m.buildHTMLMessage(Message{Template: "welcome"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(html, "<p>Welcome</p>") {
+		t.Error("html message was not rendered with the renderer:", html)
+	}
+
+	plain, err := m.buildPlainTextMessage(Message{Template: "welcome"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if plain != "Welcome, O'Brien" {
+		t.Error("wrong plain text message:", plain)
+	}
+
+	// templates the renderer does not have come from the mail templates folder
+	_, err = m.buildHTMLMessage(Message{Template: "test"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMail_FS(t *testing.T) {
+	m := mailer
+	m.Templates = ""
+	m.FS = fstest.MapFS{
+		"embedded.html.tmpl": {Data: []byte(`{{ define "body" }}<p>Embedded</p>{{ end }}`)},
+		"embedded.plain.tmpl": {Data: []byte(`{{ define "body" }}Embedded{{ end }}`)},
+	}
+
+	html, err := m.buildHTMLMessage(Message{Template: "embedded"})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(html, "<p>Embedded</p>") {
+		t.Error("html message was not read from the file system:", html)
+	}
+
+	plain, err := m.buildPlainTextMessage(Message{Template: "embedded"})
+	if err != nil || plain != "Embedded" {
+		t.Error("plain text message was not read from the file system:", plain, err)
+	}
+}
+
+func TestMail_Locale(t *testing.T) {
+	catalog := i18n.New("en")
+	catalog.Add("en", map[string]interface{}{"welcome": "Welcome, {name}"})
+	catalog.Add("de", map[string]interface{}{"welcome": "Willkommen, {name}"})
+
+	m := mailer
+	m.Templates = ""
+	m.I18n = catalog
+	m.FS = fstest.MapFS{
+		"greeting.html.tmpl": {Data: []byte(`{{ define "body" }}<p>{{ t "welcome" "name" .Name }}</p>{{ end }}`)},
+		"greeting.plain.tmpl": {Data: []byte(`{{ define "body" }}{{ t "welcome" "name" .Name }}{{ end }}`)},
+	}
+
+	msg := Message{Template: "greeting", Locale: "de", Data: map[string]string{"Name": "Ada"}}
+
+	html, err := m.buildHTMLMessage(msg)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !strings.Contains(html, "Willkommen, Ada") {
+		t.Error("html message was not translated:", html)
+	}
+
+	msg.Locale = ""
+	plain, err := m.buildPlainTextMessage(msg)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if plain != "Welcome, Ada" {
+		t.Error("plain message was not in the default locale:", plain)
+	}
+}
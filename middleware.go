@@ -5,25 +5,55 @@ import (
 	"strconv"
 
 	"github.com/justinas/nosurf"
+	"github.com/shaynemeyer/rasant/session"
 )
 
 func (ras *Rasant) SessionLoad(next http.Handler) http.Handler {
 	ras.InfoLog.Println("SessionLoad called")
-	return ras.Session.LoadAndSave(next)
+
+	handler := ras.Session.LoadAndSave(next)
+
+	// the cookie store reads and writes its own cookie around the session manager
+	cs, isCookieStore := ras.Session.Store.(*session.CookieStore)
+	if isCookieStore {
+		handler = cs.Middleware(handler)
+	}
+
+	if partitioned, _ := strconv.ParseBool(ras.config.cookie.partitioned); partitioned {
+		names := []string{ras.Session.Cookie.Name, nosurf.CookieName}
+		if isCookieStore {
+			names = append(names, cs.Cookie.Name)
+		}
+		handler = session.Partitioned(handler, names...)
+	}
+
+	return handler
+}
+
+// Localize stores the locale of each request in its context, taken from the URL prefix, the
+// session or the Accept-Language header, so that templates, validation and handlers can use it
+func (ras *Rasant) Localize(next http.Handler) http.Handler {
+	return ras.I18n.Middleware(ras.Session)(next)
 }
 
+// NoSurf adds CSRF protection. The CSRF cookie follows the session cookie settings, except
+// that it defaults to SameSite=Strict. It also makes the request available to Login and
+// Logout.
 func (ras *Rasant) NoSurf(next http.Handler) http.Handler {
-	csrfHandler := nosurf.New(next);
-	secure, _ := strconv.ParseBool(ras.config.cookie.secure)
+	var csrfHandler *nosurf.CSRFHandler
+	// Login and Logout rotate the CSRF token through the request context
+	csrfHandler = nosurf.New(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		withRequestContext(csrfHandler, next).ServeHTTP(w, r)
+	}))
 
 	csrfHandler.ExemptGlob("/api/*")
 
 	csrfHandler.SetBaseCookie(http.Cookie{
 		HttpOnly: true,
-		Path: "/",
-		Secure: secure,
-		SameSite: http.SameSiteStrictMode,
-		Domain: ras.config.cookie.domain,
+		Path: ras.Session.Cookie.Path,
+		Secure: ras.Session.Cookie.Secure,
+		SameSite: session.ParseSameSite(ras.config.cookie.sameSite, http.SameSiteStrictMode),
+		Domain: ras.Session.Cookie.Domain,
 	})
 
 	return csrfHandler
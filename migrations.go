@@ -4,6 +4,7 @@ import (
 	"log"
 
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
 
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/golang-migrate/migrate/v4/database/mysql"
@@ -11,8 +12,23 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
+// newMigrate returns a migrate instance for the migrations folder. With ras.Assets set, the
+// migrations are read from it (and, in debug mode, from disk first).
+func (ras *Rasant) newMigrate(dsn string) (*migrate.Migrate, error) {
+	if ras.Assets == nil {
+		return migrate.New("file://" + ras.RootPath + "/migrations", dsn)
+	}
+
+	source, err := iofs.New(ras.assetFS("migrations"), ".")
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewWithSourceInstance("iofs", source, dsn)
+}
+
 func (ras *Rasant) MigrateUp(dsn string) error {
-	m, err := migrate.New("file://" + ras.RootPath + "/migrations", dsn)
+	m, err := ras.newMigrate(dsn)
 	if err!= nil {
     return err
   }
@@ -27,7 +43,7 @@ func (ras *Rasant) MigrateUp(dsn string) error {
 }
 
 func (ras *Rasant) MigrateDownAll(dsn string) error {
-	m, err := migrate.New("file://" + ras.RootPath + "/migrations", dsn)
+	m, err := ras.newMigrate(dsn)
 	if err != nil {
 		return err
 	}
@@ -41,7 +57,7 @@ func (ras *Rasant) MigrateDownAll(dsn string) error {
 }
 
 func (ras *Rasant) Steps(n int, dsn string) error {
-	m, err := migrate.New("file://" + ras.RootPath + "/migrations", dsn)
+	m, err := ras.newMigrate(dsn)
 	if err!= nil {
     return err
   }
@@ -55,7 +71,7 @@ func (ras *Rasant) Steps(n int, dsn string) error {
 }
 
 func (ras *Rasant) MigrateForce(dsn string) error {
-	m, err := migrate.New("file://" + ras.RootPath + "/migrations", dsn)
+	m, err := ras.newMigrate(dsn)
 	if err!= nil {
     return err
   }
@@ -2,6 +2,7 @@ package rasant
 
 import (
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/loaders/httpfs"
 	"github.com/alexedwards/scs/v2"
 	"github.com/dgraph-io/badger/v3"
 	"github.com/go-chi/chi/v5"
@@ -18,6 +20,10 @@ import (
 	"github.com/robfig/cron/v3"
 	"github.com/shaynemeyer/rasant/cache"
 	"github.com/shaynemeyer/rasant/filesystems/miniofilesystem"
+	"github.com/shaynemeyer/rasant/filesystems/s3filesystem"
+	"github.com/shaynemeyer/rasant/filesystems/sftpfilesystem"
+	"github.com/shaynemeyer/rasant/filesystems/webdavfilesystem"
+	"github.com/shaynemeyer/rasant/i18n"
 	"github.com/shaynemeyer/rasant/mailer"
 	"github.com/shaynemeyer/rasant/render"
 	"github.com/shaynemeyer/rasant/session"
@@ -42,15 +48,24 @@ type Rasant struct {
 	Routes *chi.Mux
 	Render *render.Render
 	Session *scs.SessionManager
+	Sessions *session.Registry
 	DB Database
 	JetViews *jet.Set
 	config config
 	EncryptionKey string
 	Cache cache.Cache
+	ContextCache cache.ContextCache
 	Scheduler *cron.Cron
 	Mail mailer.Mail
 	Server Server
 	FileSystems map[string]interface{}
+	// Assets, when set before New is called, holds the views, mail, migrations and public
+	// folders, e.g. from an embed.FS
+	Assets fs.FS
+	// I18n holds the translations found in the lang folder
+	I18n *i18n.Catalog
+	static *staticFiles
+	routeNames map[string]string
 }
 
 type Server struct {
@@ -67,6 +82,8 @@ type config struct {
 	sessionType string
 	database databaseConfig
 	redis redisConfig
+	cachePrefix string
+	reauthURL string
 }
 
 // New reads the .env file, creates our application config, populates the Rasant type with settings
@@ -74,7 +91,7 @@ type config struct {
 func (ras *Rasant) New(rootPath string) error {
 	pathConfig := initPaths{
 		rootPath: rootPath,
-		folderNames: []string{"handlers", "migrations", "views", "mail", "data", "public", "tmp", "logs", "middleware"},
+		folderNames: []string{"handlers", "migrations", "views", "mail", "data", "public", "tmp", "logs", "middleware", "lang"},
 	}
 
 	err := ras.Init(pathConfig)
@@ -109,36 +126,11 @@ func (ras *Rasant) New(rootPath string) error {
 		}
 	}
 
-	scheduler := cron.New()
-	ras.Scheduler = scheduler
-
-	if os.Getenv("CACHE") == "redis" || os.Getenv("SESSION_TYPE") == "redis" {
-		myRedisCache = ras.createClientRedisCache()
-		ras.Cache = myRedisCache
-		redisPool = myRedisCache.Conn
-	}
-
-	if os.Getenv("CACHE") == "badger" {
-		myBadgerCache = ras.createClientBadgerCache()
-		ras.Cache = myBadgerCache
-		badgerConn = myBadgerCache.Conn
-
-		_, err = ras.Scheduler.AddFunc("@daily", func() {
-			_ = myBadgerCache.Conn.RunValueLogGC(0.7)
-		})
-
-		if err != nil {	
-			return err
-		}
-	}
-
 	ras.InfoLog = infoLog
 	ras.ErrorLog = errorLog
 	ras.Debug, _ = strconv.ParseBool(os.Getenv("DEBUG"))
 	ras.Version = version
 	ras.RootPath = rootPath
-	ras.Mail = ras.createMailer()
-	ras.Routes = ras.routes().(*chi.Mux)
 	
 	ras.config = config{
 		port: os.Getenv("PORT"),
@@ -146,9 +138,14 @@ func (ras *Rasant) New(rootPath string) error {
 		cookie: cookieConfig{
 			name: os.Getenv("COOKIE_NAME"),
 			lifetime: os.Getenv("COOKIE_LIFETIME"),
-			persist: os.Getenv("COOKIE_PERSISTS"),
+			persist: os.Getenv("COOKIE_PERSIST"),
 			secure: os.Getenv("COOKIE_SECURE"),
 			domain: os.Getenv("COOKIE_DOMAIN"),
+			sameSite: os.Getenv("COOKIE_SAMESITE"),
+			path: os.Getenv("COOKIE_PATH"),
+			httpOnly: os.Getenv("COOKIE_HTTPONLY"),
+			partitioned: os.Getenv("COOKIE_PARTITIONED"),
+			idleTimeout: os.Getenv("SESSION_IDLE_TIMEOUT"),
 		},
 		sessionType: os.Getenv("SESSION_TYPE"),
 		database: databaseConfig{
@@ -159,9 +156,70 @@ func (ras *Rasant) New(rootPath string) error {
 			host: os.Getenv("REDIS_HOST"),
 			password: os.Getenv("REDIS_PASSWORD"),
 			prefix: os.Getenv("REDIS_PREFIX"),
+			database: os.Getenv("REDIS_DB"),
+			tls: os.Getenv("REDIS_TLS"),
+			tlsSkipVerify: os.Getenv("REDIS_TLS_SKIP_VERIFY"),
+			sentinels: os.Getenv("REDIS_SENTINELS"),
+			sentinelMaster: os.Getenv("REDIS_SENTINEL_MASTER"),
+			sentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+			cluster: os.Getenv("REDIS_CLUSTER"),
 		},
+		cachePrefix: os.Getenv("CACHE_PREFIX"),
+		reauthURL: os.Getenv("REAUTH_URL"),
+	}
+
+	if ras.config.reauthURL == "" {
+		ras.config.reauthURL = "/users/login"
+	}
+
+	// older .env files spell the setting COOKIE_PERSISTS
+	if ras.config.cookie.persist == "" {
+		ras.config.cookie.persist = os.Getenv("COOKIE_PERSISTS")
+	}
+
+	// the cache prefix is shared by every cache backend; older .env files only set REDIS_PREFIX
+	if ras.config.cachePrefix == "" {
+		ras.config.cachePrefix = ras.config.redis.prefix
+	}
+
+	scheduler := cron.New()
+	ras.Scheduler = scheduler
+
+	if os.Getenv("CACHE") == "redis" || os.Getenv("SESSION_TYPE") == "redis" {
+		myRedisCache = ras.createClientRedisCache()
+		ras.Cache = myRedisCache
+		redisPool = myRedisCache.Conn
+	}
+
+	if os.Getenv("CACHE") == "badger" {
+		myBadgerCache = ras.createClientBadgerCache()
+		ras.Cache = myBadgerCache
+		badgerConn = myBadgerCache.Conn
+
+		_, err = ras.Scheduler.AddFunc("@daily", func() {
+			_ = myBadgerCache.Conn.RunValueLogGC(0.7)
+		})
+
+		if err != nil {	
+			return err
+		}
 	}
 
+	if ras.Cache != nil {
+		// guard the cache with timeouts and a circuit breaker, keeping ras.Cache usable as before
+		ras.ContextCache = ras.createContextCache(ras.Cache)
+		ras.Cache = cache.Background(ras.ContextCache)
+	}
+
+	ras.I18n, err = ras.createCatalog()
+	if err != nil {
+		return err
+	}
+
+	ras.Mail = ras.createMailer()
+	ras.static = newStaticFiles(ras.assetFS("public"), ras.Debug)
+	ras.Routes = ras.routes().(*chi.Mux)
+
 	secure := true 
 	if strings.ToLower(os.Getenv("SECURE")) == "false" {
 		secure = false
@@ -174,6 +232,8 @@ func (ras *Rasant) New(rootPath string) error {
     URL: os.Getenv("APP_URL"),
 	}
 
+	ras.EncryptionKey = os.Getenv("KEY")
+
 	// create session
 	sess := session.Session {
 		CookieLifetime: ras.config.cookie.lifetime,
@@ -181,6 +241,13 @@ func (ras *Rasant) New(rootPath string) error {
 		CookieName: ras.config.cookie.name,
 		SessionType: ras.config.sessionType,
 		CookieDomain: ras.config.cookie.domain,
+		CookieSecure: ras.config.cookie.secure,
+		CookieSameSite: ras.config.cookie.sameSite,
+		CookiePath: ras.config.cookie.path,
+		CookieHTTPOnly: ras.config.cookie.httpOnly,
+		CookiePartitioned: ras.config.cookie.partitioned,
+		IdleTimeout: ras.config.cookie.idleTimeout,
+		EncryptionKey: ras.EncryptionKey,
 	}
 
 	switch ras.config.sessionType {
@@ -188,27 +255,51 @@ func (ras *Rasant) New(rootPath string) error {
 			sess.RedisPool = myRedisCache.Conn
 		case "mysql", "postgres", "mariadb", "postgresql":
 			sess.DBPool = ras.DB.Pool
+		case "badger":
+			// share the badger cache's database when there is one
+			if badgerConn == nil {
+				badgerConn = ras.createBadgerConn()
+			}
+			sess.BadgerConn = badgerConn
+		case "cookie":
+			if ras.EncryptionKey == "" {
+				ras.ErrorLog.Println("SESSION_TYPE is cookie, but KEY is not set; sessions are kept in memory")
+			}
 	}
 
 	ras.Session = sess.InitSession()
-	ras.EncryptionKey = os.Getenv("KEY")
+	ras.Sessions = session.NewRegistry(ras.Session, []byte(ras.EncryptionKey))
+
+	loader, err := httpfs.NewLoader(http.FS(ras.assetFS("views")))
+	if err != nil {
+		return err
+	}
 
 	if ras.Debug {
 		var views = jet.NewSet(
-			jet.NewOSFileSystemLoader(fmt.Sprintf("%s/views", rootPath)),
+			loader,
 			jet.InDevelopmentMode(),
 		)
 	
 		ras.JetViews = views
 	} else {
 		var views = jet.NewSet(
-			jet.NewOSFileSystemLoader(fmt.Sprintf("%s/views", rootPath)),
+			loader,
 		)
 	
 		ras.JetViews = views
 	}
 
-	ras.createRenderer()
+	// the same views without HTML escaping, for plain text such as the text part of a mail
+	textViews := jet.NewSet(loader, jet.WithSafeWriter(nil))
+	if ras.Debug {
+		textViews = jet.NewSet(loader, jet.WithSafeWriter(nil), jet.InDevelopmentMode())
+	}
+
+	ras.createRenderer(textViews)
+	ras.registerTemplateFuncs()
+	ras.Mail.Renderer = ras.Render
+	ras.Mail.I18n = ras.I18n
 	ras.FileSystems = ras.createFileSystems()
 
 	go ras.Mail.ListenForMail()
@@ -268,7 +359,7 @@ func (ras *Rasant) checkDotEnv(path string) error {
 func (ras *Rasant) createClientRedisCache() *cache.RedisCache {
 	cacheClient := cache.RedisCache{
 		Conn: ras.createRedisPool(),
-		Prefix: ras.config.redis.prefix,
+		Prefix: ras.config.cachePrefix,
 	}
 
 	return &cacheClient
@@ -277,24 +368,73 @@ func (ras *Rasant) createClientRedisCache() *cache.RedisCache {
 func (ras *Rasant) createClientBadgerCache() *cache.BadgerCache {
 	cacheClient := cache.BadgerCache{
 		Conn: ras.createBadgerConn(),
+		Prefix: ras.config.cachePrefix,
 	}
 
 	return &cacheClient
 }
 
+// createContextCache wraps c so that every call has a deadline (CACHE_TIMEOUT, in
+// milliseconds) and fails fast once CACHE_BREAKER_THRESHOLD calls in a row have failed,
+// until CACHE_BREAKER_COOLDOWN seconds have passed
+func (ras *Rasant) createContextCache(c cache.Cache) cache.ContextCache {
+	timeout, err := strconv.Atoi(os.Getenv("CACHE_TIMEOUT"))
+	if err != nil {
+		timeout = 1000
+	}
+
+	threshold, err := strconv.Atoi(os.Getenv("CACHE_BREAKER_THRESHOLD"))
+	if err != nil {
+		threshold = 5
+	}
+
+	cooldown, err := strconv.Atoi(os.Getenv("CACHE_BREAKER_COOLDOWN"))
+	if err != nil {
+		cooldown = 30
+	}
+
+	breaker := &cache.CircuitBreaker{
+		Threshold: threshold,
+		Cooldown: time.Duration(cooldown) * time.Second,
+	}
+
+	return cache.NewTimeoutCache(c, time.Duration(timeout) * time.Millisecond, breaker)
+}
+
+// createRedisPool creates the redis pool shared by the cache and the session store. It
+// connects to a single server, to the master reported by redis sentinel, or to a redis
+// cluster, depending on the REDIS_* settings.
 func (ras *Rasant) createRedisPool() *redis.Pool {
-	return &redis.Pool{
+	db, _ := strconv.Atoi(ras.config.redis.database)
+	useTLS, _ := strconv.ParseBool(ras.config.redis.tls)
+	skipVerify, _ := strconv.ParseBool(ras.config.redis.tlsSkipVerify)
+
+	return cache.NewRedisPool(cache.RedisOptions{
+		Addr: ras.config.redis.host,
+		Password: ras.config.redis.password,
+		DB: db,
+		TLS: useTLS,
+		TLSSkipVerify: skipVerify,
+		SentinelAddrs: splitList(ras.config.redis.sentinels),
+		SentinelMaster: ras.config.redis.sentinelMaster,
+		SentinelPassword: ras.config.redis.sentinelPassword,
+		ClusterAddrs: splitList(ras.config.redis.cluster),
 		MaxIdle: 50,
 		MaxActive: 10000,
 		IdleTimeout: 240 * time.Second,
-		Dial: func() (redis.Conn, error) {
-			return redis.Dial("tcp", ras.config.redis.host, redis.DialPassword(ras.config.redis.password))
-		},
-		TestOnBorrow: func(conn redis.Conn, t time.Time) error {
-			_, err := conn.Do("PING")
-      return err
-		},
+		ConnectTimeout: 5 * time.Second,
+	})
+}
+
+// splitList splits a comma separated setting, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
 func (ras *Rasant) createBadgerConn() *badger.DB {
@@ -316,23 +456,44 @@ func (ras *Rasant) startLoggers() (*log.Logger, *log.Logger) {
 	return infoLog, errorLog
 }
 
-func (ras *Rasant) createRenderer() {
+func (ras *Rasant) createRenderer(textViews *jet.Set) {
 	myRenderer := render.Render{
 		Renderer: ras.config.renderer,
 		RootPath: ras.RootPath,
 		Port: ras.config.port,
 		JetViews: ras.JetViews,
+		JetText: textViews,
 		Session: ras.Session,
+		Debug: ras.Debug,
+		FS: ras.assetFS("views"),
+		I18n: ras.I18n,
 	}
 
 	ras.Render = &myRenderer
 }
 
+// createCatalog loads the translations in the lang folder; DEFAULT_LOCALE, en unless set, is
+// used when a request asks for no supported locale
+func (ras *Rasant) createCatalog() (*i18n.Catalog, error) {
+	defaultLocale := os.Getenv("DEFAULT_LOCALE")
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+
+	catalog := i18n.New(defaultLocale)
+	if err := catalog.Load(ras.assetFS("lang")); err != nil {
+		return nil, err
+	}
+
+	return catalog, nil
+}
+
 func (ras *Rasant) createMailer() mailer.Mail {
 	port, _ := strconv.Atoi(os.Getenv("SMTP_PORT"))
 	m := mailer.Mail{
 		Domain: os.Getenv("MAIL_DOMAIN"),
 		Templates: ras.RootPath + "/mail",
+		FS: ras.assetFS("mail"),
 		Host: os.Getenv("SMTP_HOST"),
 		Port: port,
 		Username: os.Getenv("SMTP_USERNAME"),
@@ -394,5 +555,38 @@ func (ras *Rasant) createFileSystems() map[string]interface{} {
 		fileSystems["MINIO"] = minio
 	}
 
+	if os.Getenv("S3_SECRET") != "" {
+		s3 := s3filesystem.S3{
+			Key: os.Getenv("S3_KEY"),
+			Secret: os.Getenv("S3_SECRET"),
+			Region: os.Getenv("S3_REGION"),
+			Endpoint: os.Getenv("S3_ENDPOINT"),
+			Bucket: os.Getenv("S3_BUCKET"),
+		}
+		fileSystems["S3"] = s3
+	}
+
+	if os.Getenv("SFTP_HOST") != "" {
+		sftp := sftpfilesystem.SFTP{
+			Host: os.Getenv("SFTP_HOST"),
+			User: os.Getenv("SFTP_USER"),
+			Pass: os.Getenv("SFTP_PASS"),
+			Port: os.Getenv("SFTP_PORT"),
+			KeyFile: os.Getenv("SFTP_KEY_FILE"),
+			KeyPassphrase: os.Getenv("SFTP_KEY_PASSPHRASE"),
+			KnownHosts: os.Getenv("SFTP_KNOWN_HOSTS"),
+		}
+		fileSystems["SFTP"] = sftp
+	}
+
+	if os.Getenv("WEBDAV_HOST") != "" {
+		webDAV := webdavfilesystem.WebDAV{
+			Host: os.Getenv("WEBDAV_HOST"),
+			User: os.Getenv("WEBDAV_USER"),
+			Pass: os.Getenv("WEBDAV_PASS"),
+		}
+		fileSystems["WEBDAV"] = webDAV
+	}
+
 	return fileSystems
 }
\ No newline at end of file
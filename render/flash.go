@@ -0,0 +1,140 @@
+package render
+
+import (
+	"context"
+	"encoding/gob"
+	"net/url"
+	"strings"
+)
+
+// Flash message levels
+const (
+	FlashSuccess = "success"
+	FlashInfo = "info"
+	FlashWarning = "warning"
+	FlashError = "error"
+)
+
+// session keys for the data that is carried across a redirect
+const (
+	flashesKey = "_flashes"
+	oldInputKey = "_oldInput"
+	fieldErrorsKey = "_fieldErrors"
+)
+
+// Flash is a message shown once, on the next page the user sees
+type Flash struct {
+	Level string
+	Message string
+}
+
+func init() {
+	// session data is gob encoded
+	gob.Register([]Flash{})
+	gob.Register(map[string][]string{})
+	gob.Register(map[string]string{})
+}
+
+// AddFlash queues a message with the given level for the next page rendered in this session
+func (ren *Render) AddFlash(ctx context.Context, level, message string) {
+	flashes, _ := ren.Session.Get(ctx, flashesKey).([]Flash)
+	ren.Session.Put(ctx, flashesKey, append(flashes, Flash{Level: level, Message: message}))
+}
+
+// FlashSuccess queues a success message
+func (ren *Render) FlashSuccess(ctx context.Context, message string) {
+	ren.AddFlash(ctx, FlashSuccess, message)
+}
+
+// FlashInfo queues an informational message
+func (ren *Render) FlashInfo(ctx context.Context, message string) {
+	ren.AddFlash(ctx, FlashInfo, message)
+}
+
+// FlashWarning queues a warning
+func (ren *Render) FlashWarning(ctx context.Context, message string) {
+	ren.AddFlash(ctx, FlashWarning, message)
+}
+
+// FlashError queues an error message
+func (ren *Render) FlashError(ctx context.Context, message string) {
+	ren.AddFlash(ctx, FlashError, message)
+}
+
+// FlashInput keeps submitted form values for the next page, so that a form can be filled in
+// again after a redirect. Passwords and the CSRF token are never kept.
+func (ren *Render) FlashInput(ctx context.Context, input url.Values) {
+	old := make(map[string][]string, len(input))
+	for field, values := range input {
+		if field == "csrf_token" || strings.Contains(strings.ToLower(field), "password") {
+			continue
+		}
+		old[field] = values
+	}
+	ren.Session.Put(ctx, oldInputKey, old)
+}
+
+// FlashFieldErrors keeps validation errors, keyed by field name, for the next page
+func (ren *Render) FlashFieldErrors(ctx context.Context, errors map[string]string) {
+	ren.Session.Put(ctx, fieldErrorsKey, errors)
+}
+
+// popFlashData moves the flashed messages, old input and field errors from the session into
+// td. The single error and flash strings used by older handlers stay in td.Error and
+// td.Flash, unless leveled flashes were queued as well: then they join td.Flashes instead, so
+// that a page shows every message once.
+func (ren *Render) popFlashData(ctx context.Context, td *TemplateData) {
+	td.Error = ren.Session.PopString(ctx, "error")
+	td.Flash = ren.Session.PopString(ctx, "flash")
+
+	if flashes, ok := ren.Session.Pop(ctx, flashesKey).([]Flash); ok {
+		if td.Error != "" {
+			td.Flashes = append(td.Flashes, Flash{Level: FlashError, Message: td.Error})
+		}
+		if td.Flash != "" {
+			td.Flashes = append(td.Flashes, Flash{Level: FlashSuccess, Message: td.Flash})
+		}
+		td.Error, td.Flash = "", ""
+
+		td.Flashes = append(td.Flashes, flashes...)
+	}
+
+	if old, ok := ren.Session.Pop(ctx, oldInputKey).(map[string][]string); ok {
+		td.OldInput = old
+	}
+
+	if errors, ok := ren.Session.Pop(ctx, fieldErrorsKey).(map[string]string); ok {
+		td.FieldErrors = errors
+	}
+}
+
+// FlashesFor returns the flash messages with the given level
+func (td *TemplateData) FlashesFor(level string) []Flash {
+	var flashes []Flash
+	for _, f := range td.Flashes {
+		if f.Level == level {
+			flashes = append(flashes, f)
+		}
+	}
+	return flashes
+}
+
+// Old returns the value submitted for field before the last redirect, so that forms can be
+// filled in again
+func (td *TemplateData) Old(field string) string {
+	if values := td.OldInput[field]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// HasError reports whether field failed validation
+func (td *TemplateData) HasError(field string) bool {
+	_, ok := td.FieldErrors[field]
+	return ok
+}
+
+// FieldError returns the validation error for field, if there is one
+func (td *TemplateData) FieldError(field string) string {
+	return td.FieldErrors[field]
+}
@@ -0,0 +1,93 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRender_Flash(t *testing.T) {
+	for _, renderer := range []string{"go", "jet"} {
+		// the request that redirects
+		r, _ := http.NewRequest("POST", "/form", nil)
+		ctx := getCtx(r)
+
+		testRenderer.FlashSuccess(ctx, "Saved")
+		testRenderer.FlashWarning(ctx, "Check your email")
+		testRenderer.Session.Put(ctx, "error", "Old style error")
+		testRenderer.FlashInput(ctx, url.Values{"email": {"me@here.com"}, "password": {"secret"}})
+		testRenderer.FlashFieldErrors(ctx, map[string]string{"email": "Email is taken"})
+
+		token, _, err := testSession.Commit(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the page the user is redirected to
+		r, _ = http.NewRequest("GET", "/form", nil)
+		r.Header.Set("X-Session", token)
+		r = r.WithContext(getCtx(r))
+		w := httptest.NewRecorder()
+
+		testRenderer.Renderer = renderer
+		testRenderer.RootPath = "./testdata"
+
+		err = testRenderer.Page(w, r, "flash", nil, nil)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+
+		body := w.Body.String()
+		if strings.Count(body, "Old style error") != 1 {
+			t.Errorf("%s: expected the old style error once in %q", renderer, body)
+		}
+		for _, expected := range []string{
+			"[error: Old style error]",
+			"[success: Saved]",
+			"[warning: Check your email]",
+			`value="me@here.com"`,
+			"<span>Email is taken</span>",
+		} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("%s: expected %q in %q", renderer, expected, body)
+			}
+		}
+
+		if testRenderer.Session.Exists(r.Context(), flashesKey) {
+			t.Error(renderer, "flashes were not removed from the session")
+		}
+
+		var td TemplateData
+		testRenderer.popFlashData(r.Context(), &td)
+		if len(td.Flashes) != 0 || td.Old("password") != "" {
+			t.Error(renderer, "flash data was shown twice")
+		}
+	}
+}
+
+func TestRender_FlashLegacy(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/", nil)
+	ctx := getCtx(r)
+
+	// handlers that only use the old strings keep them in Error and Flash
+	testRenderer.Session.Put(ctx, "error", "Old style error")
+	testRenderer.Session.Put(ctx, "flash", "Old style flash")
+
+	var td TemplateData
+	testRenderer.popFlashData(ctx, &td)
+	if td.Error != "Old style error" || td.Flash != "Old style flash" || len(td.Flashes) != 0 {
+		t.Errorf("expected the messages only in Error and Flash, got %+v", td)
+	}
+
+	// once leveled flashes are used, they are all in Flashes
+	testRenderer.Session.Put(ctx, "error", "Old style error")
+	testRenderer.FlashInfo(ctx, "New style info")
+
+	td = TemplateData{}
+	testRenderer.popFlashData(ctx, &td)
+	if td.Error != "" || len(td.Flashes) != 2 || td.Flashes[0].Message != "Old style error" || td.Flashes[1].Message != "New style info" {
+		t.Errorf("expected the messages only in Flashes, got %+v", td)
+	}
+}
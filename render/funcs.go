@@ -0,0 +1,48 @@
+package render
+
+import "github.com/CloudyKit/jet/v6"
+
+// AddFunc makes fn available as name in both Jet and Go templates. Functions should be
+// registered at startup, before any page is rendered.
+func (ren *Render) AddFunc(name string, fn interface{}) {
+	if ren.FuncMap == nil {
+		ren.FuncMap = make(map[string]interface{})
+	}
+	ren.FuncMap[name] = fn
+
+	for _, set := range []*jet.Set{ren.JetViews, ren.JetText} {
+		if set != nil {
+			set.AddGlobal(name, fn)
+		}
+	}
+
+	ren.resetCache()
+}
+
+// AddGlobal makes value available as name in both Jet and Go templates. Go templates have no
+// globals, so there it is a function that takes no arguments and returns value.
+func (ren *Render) AddGlobal(name string, value interface{}) {
+	if ren.FuncMap == nil {
+		ren.FuncMap = make(map[string]interface{})
+	}
+	ren.FuncMap[name] = func() interface{} {
+		return value
+	}
+
+	for _, set := range []*jet.Set{ren.JetViews, ren.JetText} {
+		if set != nil {
+			set.AddGlobal(name, value)
+		}
+	}
+
+	ren.resetCache()
+}
+
+// resetCache drops parsed templates, which were parsed with the old functions
+func (ren *Render) resetCache() {
+	ren.mu.Lock()
+	ren.goTemplates = nil
+	ren.goLocalized = nil
+	ren.jetBlocks = nil
+	ren.mu.Unlock()
+}
@@ -0,0 +1,40 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func TestRender_AddFunc(t *testing.T) {
+	ren := Render{
+		RootPath: "./testdata",
+		Session: testSession,
+		JetViews: jet.NewSet(jet.NewOSFileSystemLoader("./testdata/views"), jet.InDevelopmentMode()),
+	}
+
+	ren.AddFunc("greet", func(s string) string {
+		return "hello " + s
+	})
+	ren.AddGlobal("appName", "rasant")
+
+	for _, renderer := range []string{"go", "jet"} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r = r.WithContext(getCtx(r))
+		w := httptest.NewRecorder()
+
+		ren.Renderer = renderer
+		err := ren.Page(w, r, "funcs", nil, nil)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+
+		expected := "hello " + renderer + " rasant"
+		if body := strings.TrimSpace(w.Body.String()); body != expected {
+			t.Errorf("%s: expected %q, but got %q", renderer, expected, body)
+		}
+	}
+}
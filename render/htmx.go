@@ -0,0 +1,70 @@
+package render
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// IsHTMX reports whether r was made by HTMX
+func IsHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+func (ren *Render) fragmentBlock() string {
+	if ren.FragmentBlock == "" {
+		return "fragment"
+	}
+	return ren.FragmentBlock
+}
+
+// hasBlock reports whether view defines block
+func (ren *Render) hasBlock(view, block string) bool {
+	switch strings.ToLower(ren.Renderer) {
+	case "go":
+		tmpl, err := ren.goTemplate(view)
+		return err == nil && tmpl.Lookup(block) != nil
+	case "jet":
+		t, err := ren.JetViews.GetTemplate(fmt.Sprintf("%s.jet", view))
+		return err == nil && definesBlock(t.Root, block)
+	default:
+		return false
+	}
+}
+
+// definesBlock reports whether the parsed Jet template list defines block. Only the view's own
+// tree is searched, as Jet does not expose the blocks of the templates it extends or imports.
+func definesBlock(list *jet.ListNode, block string) bool {
+	if list == nil {
+		return false
+	}
+
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *jet.BlockNode:
+			if n.Name == block || definesBlock(n.List, block) || definesBlock(n.Content, block) {
+				return true
+			}
+		case *jet.IfNode:
+			if definesBlock(n.List, block) || definesBlock(n.ElseList, block) {
+				return true
+			}
+		case *jet.RangeNode:
+			if definesBlock(n.List, block) || definesBlock(n.ElseList, block) {
+				return true
+			}
+		case *jet.TryNode:
+			if definesBlock(n.List, block) {
+				return true
+			}
+		case *jet.ListNode:
+			if definesBlock(n, block) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
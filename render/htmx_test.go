@@ -0,0 +1,81 @@
+package render
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+func TestRender_PageHTMX(t *testing.T) {
+	testRenderer.RootPath = "./testdata"
+
+	for _, renderer := range []string{"go", "jet"} {
+		testRenderer.Renderer = renderer
+
+		r, _ := http.NewRequest("GET", "/items", nil)
+		r = r.WithContext(getCtx(r))
+		w := httptest.NewRecorder()
+
+		err := testRenderer.Page(w, r, "items", nil, nil)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+
+		if body := strings.TrimSpace(w.Body.String()); body != "<html><ul><li>item</li></ul></html>" {
+			t.Error(renderer, "wrong full page:", body)
+		}
+
+		if w.Header().Get("Vary") != "HX-Request" {
+			t.Error(renderer, "Vary header not set")
+		}
+
+		r.Header.Set("HX-Request", "true")
+		w = httptest.NewRecorder()
+
+		err = testRenderer.Page(w, r, "items", nil, nil)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+
+		if body := strings.TrimSpace(w.Body.String()); body != "<li>item</li>" {
+			t.Error(renderer, "wrong fragment:", body)
+		}
+
+		// views without a fragment are rendered in full
+		w = httptest.NewRecorder()
+		err = testRenderer.Page(w, r, "home", nil, nil)
+		if err != nil || w.Body.Len() == 0 {
+			t.Error(renderer, "view without a fragment was not rendered:", err)
+		}
+	}
+}
+
+func TestRender_HasBlockJet(t *testing.T) {
+	loader := jet.NewInMemLoader()
+	loader.Set("/nested.jet", `{{ if .Show }}{{ range _, item := .Items }}{{ block fragment() }}{{ item.Missing() }}{{ end }}{{ end }}{{ end }}`)
+	loader.Set("/yields.jet", `{{ yield fragment() }}`)
+	loader.Set("/other.jet", `{{ block main() }}{{ block sidebar() }}{{ end }}{{ end }}`)
+
+	ren := &Render{Renderer: "jet", JetViews: jet.NewSet(loader)}
+
+	tests := []struct {
+		view string
+		found bool
+	}{
+		// found without running the view, which would fail without data
+		{"nested", true},
+		// a yield is not a definition
+		{"yields", false},
+		{"other", false},
+		{"missing", false},
+	}
+
+	for _, tt := range tests {
+		if found := ren.hasBlock(tt.view, "fragment"); found != tt.found {
+			t.Errorf("%s: expected %v, got %v", tt.view, tt.found, found)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package render
+
+import (
+	"context"
+	"html/template"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/shaynemeyer/rasant/i18n"
+)
+
+// locale returns the locale of ctx, or the catalog's default locale
+func (ren *Render) locale(ctx context.Context) string {
+	if locale := i18n.Locale(ctx); locale != "" {
+		return locale
+	}
+	if ren.I18n != nil {
+		return ren.I18n.DefaultLocale
+	}
+	return ""
+}
+
+// translator returns the t template function for the locale of ctx. Without a catalog, t
+// returns its key.
+func (ren *Render) translator(ctx context.Context) func(key string, args ...interface{}) string {
+	locale := ren.locale(ctx)
+
+	return func(key string, args ...interface{}) string {
+		if ren.I18n == nil {
+			return i18n.Format(key, args...)
+		}
+		return ren.I18n.T(locale, key, args...)
+	}
+}
+
+// localize returns a copy of the template for view whose t function translates into the
+// locale of ctx. The cached template itself is never executed, since html/template cannot
+// clone it afterwards. Copies are cached per locale too, as html/template escapes a copy
+// again the first time it is executed.
+func (ren *Render) localize(ctx context.Context, view string, tmpl *template.Template) (*template.Template, error) {
+	locale := ren.locale(ctx)
+	key := view + "|" + locale
+
+	if !ren.Debug {
+		ren.mu.RLock()
+		clone, ok := ren.goLocalized[key]
+		ren.mu.RUnlock()
+		if ok {
+			return clone, nil
+		}
+	}
+
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	clone = clone.Funcs(template.FuncMap{"t": ren.translator(ctx)})
+
+	if !ren.Debug {
+		ren.mu.Lock()
+		if ren.goLocalized == nil {
+			ren.goLocalized = make(map[string]*template.Template)
+		}
+		ren.goLocalized[key] = clone
+		ren.mu.Unlock()
+	}
+
+	return clone, nil
+}
+
+// jetVars returns a copy of variables holding t for the locale of ctx; variables given by the
+// caller are not changed, as they may be shared between requests
+func (ren *Render) jetVars(ctx context.Context, variables interface{}) jet.VarMap {
+	vars := make(jet.VarMap)
+	if variables != nil {
+		for name, value := range variables.(jet.VarMap) {
+			vars[name] = value
+		}
+	}
+	vars.Set("t", ren.translator(ctx))
+
+	return vars
+}
@@ -0,0 +1,101 @@
+package render
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/shaynemeyer/rasant/i18n"
+)
+
+func TestRender_Translate(t *testing.T) {
+	catalog := i18n.New("en")
+	catalog.Add("en", map[string]interface{}{"greeting": "Hello, {name}"})
+	catalog.Add("fr", map[string]interface{}{"greeting": "Bonjour, {name}"})
+
+	ren := Render{
+		RootPath: "./testdata",
+		Session: testSession,
+		JetViews: jet.NewSet(jet.NewOSFileSystemLoader("./testdata/views"), jet.InDevelopmentMode()),
+		I18n: catalog,
+	}
+
+	for _, renderer := range []string{"go", "jet"} {
+		ren.Renderer = renderer
+
+		for _, locale := range []string{"fr", "en"} {
+			r, _ := http.NewRequest("GET", "/", nil)
+			r = r.WithContext(i18n.WithLocale(getCtx(r), locale))
+			w := httptest.NewRecorder()
+
+			if err := ren.Page(w, r, "greeting", nil, nil); err != nil {
+				t.Fatal(renderer, err)
+			}
+
+			expected := `<html lang="` + locale + `">` + catalog.T(locale, "greeting", "name", "Ada") + "</html>"
+			if body := strings.TrimSpace(w.Body.String()); body != expected {
+				t.Errorf("%s: expected %q, but got %q", renderer, expected, body)
+			}
+		}
+
+		// outside of a request, t uses the default locale unless the context carries one
+		s, err := ren.ToString("greeting", nil, nil)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+		if !strings.Contains(s, "Hello, Ada") {
+			t.Errorf("%s: expected the default locale, but got %q", renderer, s)
+		}
+
+		s, err = ren.ToStringContext(i18n.WithLocale(context.Background(), "fr"), "greeting", nil, nil)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+		if !strings.Contains(s, "Bonjour, Ada") {
+			t.Errorf("%s: expected french, but got %q", renderer, s)
+		}
+	}
+}
+
+func TestRender_LocalizeCache(t *testing.T) {
+	ren := Render{Renderer: "go", RootPath: "./testdata", I18n: i18n.New("en")}
+
+	tmpl, err := ren.goTemplate("greeting")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr := i18n.WithLocale(context.Background(), "fr")
+	first, _ := ren.localize(fr, "greeting", tmpl)
+	if err = first.Execute(&strings.Builder{}, &TemplateData{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the escaped copy is used again, rather than cloned and escaped on every render
+	if again, _ := ren.localize(fr, "greeting", tmpl); again != first {
+		t.Error("expected the copy for a locale to be reused")
+	}
+	if en, _ := ren.localize(context.Background(), "greeting", tmpl); en == first {
+		t.Error("expected another locale to get a copy of its own")
+	}
+
+	ren.Debug = true
+	if again, _ := ren.localize(fr, "greeting", tmpl); again == first {
+		t.Error("expected Debug to skip the cache")
+	}
+}
+
+func BenchmarkRender_GoPage(b *testing.B) {
+	ren := Render{Renderer: "go", RootPath: "./testdata", Session: testSession, I18n: i18n.New("en")}
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(getCtx(r))
+
+	for i := 0; i < b.N; i++ {
+		if err := ren.Page(httptest.NewRecorder(), r, "greeting", nil, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
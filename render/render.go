@@ -1,16 +1,23 @@
 package render
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"path"
 	"strings"
+	"sync"
 
 	"github.com/CloudyKit/jet/v6"
 	"github.com/alexedwards/scs/v2"
 	"github.com/justinas/nosurf"
+	"github.com/shaynemeyer/rasant/i18n"
 )
 
 type Render struct {
@@ -20,7 +27,25 @@ type Render struct {
 	Port string
 	ServerName string
 	JetViews *jet.Set
+	// JetText holds the same views as JetViews, but without HTML escaping; TextToString
+	// renders Jet views with it
+	JetText *jet.Set
 	Session *scs.SessionManager
+	// Debug makes the Go renderer parse templates on every request instead of caching them
+	Debug bool
+	// FuncMap holds extra functions for Go templates
+	FuncMap template.FuncMap
+	// FragmentBlock is the block rendered for HTMX requests, "fragment" if empty
+	FragmentBlock string
+	// FS holds the views for the Go renderer; when nil, they are read from RootPath/views
+	FS fs.FS
+	// I18n, when set, holds the translations used by the t template function
+	I18n *i18n.Catalog
+
+	mu sync.RWMutex
+	goTemplates map[string]*template.Template
+	goLocalized map[string]*template.Template
+	jetBlocks map[string]*jet.Template
 }
 
 type TemplateData struct {
@@ -35,6 +60,10 @@ type TemplateData struct {
 	Secure bool
 	Error string
 	Flash string
+	Flashes []Flash
+	OldInput map[string][]string
+	FieldErrors map[string]string
+	Locale string
 }
 
 func (ren *Render) defaultData(td *TemplateData, r *http.Request) *TemplateData {
@@ -42,18 +71,28 @@ func (ren *Render) defaultData(td *TemplateData, r *http.Request) *TemplateData
 	td.ServerName = ren.ServerName
 	td.CSRFToken = nosurf.Token(r)
 	td.Port = ren.Port
+	td.Locale = ren.locale(r.Context())
 	
 	if ren.Session.Exists(r.Context(), "userID") {
 		td.IsAuthenticated = true
 	}
 
-	td.Error = ren.Session.PopString(r.Context(), "error")
-	td.Flash = ren.Session.PopString(r.Context(), "flash")
+	ren.popFlashData(r.Context(), td)
 
 	return td
 }
 
+// Page renders view as the response to r. When r was made by HTMX and view has a block named
+// FragmentBlock (by default "fragment"), only that block is rendered, so that HTMX can swap it
+// into the page without the layout around it.
 func (ren *Render) Page(w http.ResponseWriter, r *http.Request, view string, variables, data interface{}) error {
+	// the same URL gives a different response to HTMX, so caches must keep them apart
+	w.Header().Add("Vary", "HX-Request")
+
+	if IsHTMX(r) && r.Header.Get("HX-Boosted") != "true" && ren.hasBlock(view, ren.fragmentBlock()) {
+		return ren.Block(w, r, view, ren.fragmentBlock(), variables, data)
+	}
+
 	switch strings.ToLower(ren.Renderer) {
 	case "go":
 		return ren.GoPage(w, r, view, data)
@@ -66,36 +105,94 @@ func (ren *Render) Page(w http.ResponseWriter, r *http.Request, view string, var
 	return errors.New("no rendering engine specified")
 }
 
-// GoPage renders a standard Go template
+// GoPage renders a standard Go template. The page, views/<view>.page.tmpl, is parsed
+// together with every views/*.layout.tmpl and views/*.partial.tmpl file, so it can use the
+// templates they define. Parsed templates are cached unless Debug is set.
 func (ren *Render) GoPage(w http.ResponseWriter, r *http.Request, view string, data interface{}) error {
-	tmpl, err := template.ParseFiles(fmt.Sprintf("%s/views/%s.page.tmpl", ren.RootPath, view))
-	if err!= nil {
-    return err
-  }
+	tmpl, err := ren.goTemplate(view)
+	if err != nil {
+		return err
+	}
 
 	td := &TemplateData{}
 	if data != nil {
 		td = data.(*TemplateData)
 	}
 
-	err = tmpl.Execute(w, &td)
-	if err!= nil {
-    return err
-  }
-	
-	return nil
+	td = ren.defaultData(td, r)
+
+	if tmpl, err = ren.localize(r.Context(), view, tmpl); err != nil {
+		return err
+	}
+
+	// render to a buffer first, so a failing template does not send half a page
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, td); err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(w)
+	return err
 }
 
-// JetPage renders a template using the Jet template engine
-func (ren *Render) JetPage(w http.ResponseWriter, r *http.Request, templateName string, variables, data interface{}) error {
-	var vars jet.VarMap
+// viewsFS returns the file system holding the views
+func (ren *Render) viewsFS() fs.FS {
+	if ren.FS != nil {
+		return ren.FS
+	}
+	return os.DirFS(ren.RootPath + "/views")
+}
+
+// goTemplate returns the parsed template for view, from the cache when possible
+func (ren *Render) goTemplate(view string) (*template.Template, error) {
+	if !ren.Debug {
+		ren.mu.RLock()
+		tmpl, ok := ren.goTemplates[view]
+		ren.mu.RUnlock()
+		if ok {
+			return tmpl, nil
+		}
+	}
+
+	views := ren.viewsFS()
+
+	page := fmt.Sprintf("%s.page.tmpl", view)
+	// t is bound to the request's locale when the template is executed
+	funcs := template.FuncMap{"t": ren.translator(context.Background())}
+	tmpl, err := template.New(path.Base(page)).Funcs(funcs).Funcs(ren.FuncMap).ParseFS(views, page)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pattern := range []string{"*.layout.tmpl", "*.partial.tmpl"} {
+		matches, err := fs.Glob(views, pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(matches) > 0 {
+			if tmpl, err = tmpl.ParseFS(views, matches...); err != nil {
+				return nil, err
+			}
+		}
+	}
 
-	if variables == nil {
-    vars = make(jet.VarMap)
-  } else {
-		vars = variables.(jet.VarMap)
+	if !ren.Debug {
+		ren.mu.Lock()
+		if ren.goTemplates == nil {
+			ren.goTemplates = make(map[string]*template.Template)
+		}
+		ren.goTemplates[view] = tmpl
+		ren.mu.Unlock()
 	}
 
+	return tmpl, nil
+}
+
+// JetPage renders a template using the Jet template engine
+func (ren *Render) JetPage(w http.ResponseWriter, r *http.Request, templateName string, variables, data interface{}) error {
+	vars := ren.jetVars(r.Context(), variables)
+
 	td := &TemplateData{}
 	if data!= nil {
 		td = data.(*TemplateData)
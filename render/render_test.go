@@ -1,9 +1,12 @@
 package render
 
 import (
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 var pageData = []struct {
@@ -27,6 +30,7 @@ func TestRender_Page(t *testing.T) {
 		if err!= nil {
 			t.Error(err)
 		}
+		r = r.WithContext(getCtx(r))
 	
 		w := httptest.NewRecorder()
 		
@@ -53,6 +57,7 @@ func TestRender_GoPage(t *testing.T) {
 	if err!= nil {
     t.Error(err)
   }
+	r = r.WithContext(getCtx(r))
 
 	testRenderer.Renderer = "go"
 	testRenderer.RootPath = "./testdata"
@@ -69,6 +74,7 @@ func TestRender_JetPage(t *testing.T) {
 	if err!= nil {
     t.Error(err)
   }
+	r = r.WithContext(getCtx(r))
 
 	testRenderer.Renderer = "jet"
 	testRenderer.RootPath = "./testdata"
@@ -77,4 +83,85 @@ func TestRender_JetPage(t *testing.T) {
 	if err!= nil {
     t.Error("Error rendering page", err)
   }
-}
\ No newline at end of file
+}
+func TestRender_GoPageLayout(t *testing.T) {
+	ren := Render{
+		Renderer: "go",
+		RootPath: "./testdata",
+		Session: testSession,
+		FuncMap: template.FuncMap{
+			"shout": strings.ToUpper,
+		},
+	}
+
+	r, _ := http.NewRequest("GET", "/about", nil)
+	r = r.WithContext(getCtx(r))
+	w := httptest.NewRecorder()
+
+	err := ren.Page(w, r, "about", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := strings.TrimSpace(w.Body.String()); body != "<main>About US<footer></footer></main>" {
+		t.Error("unexpected output from layout and partial:", body)
+	}
+
+	if _, ok := ren.goTemplates["about"]; !ok {
+		t.Error("template was not cached")
+	}
+
+	ren.Debug = true
+	ren.goTemplates = nil
+
+	w = httptest.NewRecorder()
+	_ = ren.Page(w, r, "about", nil, nil)
+
+	if ren.goTemplates != nil {
+		t.Error("template was cached in debug mode")
+	}
+}
+
+func TestRender_GoPageFuncMissing(t *testing.T) {
+	ren := Render{Renderer: "go", RootPath: "./testdata", Session: testSession}
+
+	r, _ := http.NewRequest("GET", "/about", nil)
+	r = r.WithContext(getCtx(r))
+	w := httptest.NewRecorder()
+
+	if err := ren.Page(w, r, "about", nil, nil); err == nil {
+		t.Error("expected an error for a template using an unknown function")
+	}
+
+	if w.Body.Len() > 0 {
+		t.Error("output was written for a failing template")
+	}
+}
+
+func TestRender_GoPageFS(t *testing.T) {
+	ren := Render{
+		Renderer: "go",
+		Session: testSession,
+		FS: fstest.MapFS{
+			"embedded.page.tmpl": {Data: []byte(`{{ template "base" . }}{{ define "content" }}embedded{{ end }}`)},
+			"base.layout.tmpl": {Data: []byte(`{{ define "base" }}<main>{{ block "content" . }}{{ end }}</main>{{ end }}`)},
+		},
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r = r.WithContext(getCtx(r))
+	w := httptest.NewRecorder()
+
+	err := ren.Page(w, r, "embedded", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body := w.Body.String(); body != "<main>embedded</main>" {
+		t.Error("wrong output rendering from a file system:", body)
+	}
+
+	if !ren.Exists("embedded") || ren.Exists("home") {
+		t.Error("Exists does not use the file system")
+	}
+}
@@ -1,10 +1,13 @@
 package render
 
 import (
+	"context"
+	"net/http"
 	"os"
 	"testing"
 
 	"github.com/CloudyKit/jet/v6"
+	"github.com/alexedwards/scs/v2"
 )
 
 var views = jet.NewSet(
@@ -12,12 +15,30 @@ var views = jet.NewSet(
 	jet.InDevelopmentMode(),
 )
 
+var textViews = jet.NewSet(
+	jet.NewOSFileSystemLoader("./testdata/views"),
+	jet.WithSafeWriter(nil),
+	jet.InDevelopmentMode(),
+)
+
+var testSession *scs.SessionManager
+
 var testRenderer = Render{
 	Renderer: "",
 	RootPath: "",
 	JetViews: views,
+	JetText: textViews,
 }
 
 func TestMain(m *testing.M) {
+	testSession = scs.New()
+	testRenderer.Session = testSession
+
 	os.Exit(m.Run())
+}
+
+// getCtx returns a request context with a loaded session, as the SessionLoad middleware would
+func getCtx(req *http.Request) context.Context {
+	ctx, _ := testSession.Load(req.Context(), req.Header.Get("X-Session"))
+	return ctx
 }
\ No newline at end of file
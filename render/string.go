@@ -0,0 +1,236 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/CloudyKit/jet/v6"
+)
+
+// ToString renders view outside of a request, for mail bodies, background jobs and tests.
+// data is usually a *TemplateData, but any value can be given; it becomes the template's
+// context (the dot) as it is. Request specific data, such as the CSRF token and flash
+// messages, is not available.
+func (ren *Render) ToString(view string, variables, data interface{}) (string, error) {
+	return ren.ToStringContext(context.Background(), view, variables, data)
+}
+
+// ToStringContext is like ToString, but t translates into the locale carried by ctx (see
+// i18n.WithLocale), e.g. that of the recipient of a mail
+func (ren *Render) ToStringContext(ctx context.Context, view string, variables, data interface{}) (string, error) {
+	b, err := ren.toBytes(ctx, view, variables, data)
+	return string(b), err
+}
+
+// TextToString renders view as plain text, such as the text part of a mail: nothing is HTML
+// escaped. Jet views are rendered with JetText, and Go views with text/template.
+func (ren *Render) TextToString(view string, variables, data interface{}) (string, error) {
+	return ren.TextToStringContext(context.Background(), view, variables, data)
+}
+
+// TextToStringContext is like TextToString, but t translates into the locale carried by ctx
+func (ren *Render) TextToStringContext(ctx context.Context, view string, variables, data interface{}) (string, error) {
+	data = ren.staticData(ctx, data)
+
+	var buf bytes.Buffer
+	switch strings.ToLower(ren.Renderer) {
+	case "go":
+		tmpl, err := ren.goTextTemplate(ctx, view)
+		if err != nil {
+			return "", err
+		}
+		if err = tmpl.Execute(&buf, data); err != nil {
+			return "", err
+		}
+	case "jet":
+		if ren.JetText == nil {
+			return "", errors.New("no plain text view set, JetText is nil")
+		}
+
+		t, err := ren.JetText.GetTemplate(fmt.Sprintf("%s.jet", view))
+		if err != nil {
+			return "", err
+		}
+		if err = t.Execute(&buf, ren.jetVars(ctx, variables), data); err != nil {
+			return "", err
+		}
+	default:
+		return "", errors.New("no rendering engine specified")
+	}
+
+	return buf.String(), nil
+}
+
+// goTextTemplate parses view and the partials with text/template, with t translating into
+// the locale of ctx. Plain text views are rare, so they are not cached.
+func (ren *Render) goTextTemplate(ctx context.Context, view string) (*texttemplate.Template, error) {
+	views := ren.viewsFS()
+
+	page := fmt.Sprintf("%s.page.tmpl", view)
+	funcs := texttemplate.FuncMap{"t": ren.translator(ctx)}
+	tmpl, err := texttemplate.New(path.Base(page)).Funcs(funcs).Funcs(texttemplate.FuncMap(ren.FuncMap)).ParseFS(views, page)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := fs.Glob(views, "*.partial.tmpl")
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > 0 {
+		return tmpl.ParseFS(views, matches...)
+	}
+	return tmpl, nil
+}
+
+// ToBytes is like ToString, but returns the rendered view as bytes
+func (ren *Render) ToBytes(view string, variables, data interface{}) ([]byte, error) {
+	return ren.toBytes(context.Background(), view, variables, data)
+}
+
+func (ren *Render) toBytes(ctx context.Context, view string, variables, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := ren.execute(ctx, &buf, view, "", variables, ren.staticData(ctx, data)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// BlockToString renders only the named block of view outside of a request. In Jet this is a
+// block defined with {{ block name() }}; in Go templates it is a template defined with
+// {{ define "name" }} or {{ block "name" . }}.
+func (ren *Render) BlockToString(view, block string, variables, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	ctx := context.Background()
+	if err := ren.execute(ctx, &buf, view, block, variables, ren.staticData(ctx, data)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Block writes only the named block of view as the response to r, with the same default data
+// as Page. It is meant for partial responses, such as those requested by HTMX.
+func (ren *Render) Block(w http.ResponseWriter, r *http.Request, view, block string, variables, data interface{}) error {
+	td := &TemplateData{}
+	if data != nil {
+		td = data.(*TemplateData)
+	}
+
+	td = ren.defaultData(td, r)
+
+	var buf bytes.Buffer
+	if err := ren.execute(r.Context(), &buf, view, block, variables, td); err != nil {
+		return err
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// Exists reports whether view exists for the configured rendering engine
+func (ren *Render) Exists(view string) bool {
+	switch strings.ToLower(ren.Renderer) {
+	case "go":
+		_, err := fs.Stat(ren.viewsFS(), fmt.Sprintf("%s.page.tmpl", view))
+		return err == nil
+	case "jet":
+		_, err := ren.JetViews.GetTemplate(fmt.Sprintf("%s.jet", view))
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// staticData fills in the parts of the default data that do not depend on a request
+func (ren *Render) staticData(ctx context.Context, data interface{}) interface{} {
+	if data == nil {
+		data = &TemplateData{}
+	}
+
+	if td, ok := data.(*TemplateData); ok {
+		td.Secure = ren.Secure
+		td.ServerName = ren.ServerName
+		td.Port = ren.Port
+		td.Locale = ren.locale(ctx)
+	}
+
+	return data
+}
+
+// execute renders view, or only block when it is not empty, to w, translating into the
+// locale of ctx
+func (ren *Render) execute(ctx context.Context, w io.Writer, view, block string, variables, data interface{}) error {
+	switch strings.ToLower(ren.Renderer) {
+	case "go":
+		tmpl, err := ren.goTemplate(view)
+		if err != nil {
+			return err
+		}
+
+		if tmpl, err = ren.localize(ctx, view, tmpl); err != nil {
+			return err
+		}
+
+		if block == "" {
+			return tmpl.Execute(w, data)
+		}
+		return tmpl.ExecuteTemplate(w, block, data)
+	case "jet":
+		vars := ren.jetVars(ctx, variables)
+
+		t, err := ren.jetTemplate(view, block)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, vars, data)
+	default:
+		return errors.New("no rendering engine specified")
+	}
+}
+
+// jetTemplate returns the Jet template for view, or a template that yields only block from it
+func (ren *Render) jetTemplate(view, block string) (*jet.Template, error) {
+	if block == "" {
+		return ren.JetViews.GetTemplate(fmt.Sprintf("%s.jet", view))
+	}
+
+	key := view + "#" + block
+	if !ren.Debug {
+		ren.mu.RLock()
+		t, ok := ren.jetBlocks[key]
+		ren.mu.RUnlock()
+		if ok {
+			return t, nil
+		}
+	}
+
+	// make sure the view exists, so a missing view is reported as such
+	if _, err := ren.JetViews.GetTemplate(fmt.Sprintf("%s.jet", view)); err != nil {
+		return nil, err
+	}
+
+	src := fmt.Sprintf(`{{ import "/%s.jet" }}{{ yield %s() }}`, strings.TrimPrefix(view, "/"), block)
+	t, err := ren.JetViews.Parse(fmt.Sprintf("/%s.%s.block.jet", strings.TrimPrefix(view, "/"), block), src)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ren.Debug {
+		ren.mu.Lock()
+		if ren.jetBlocks == nil {
+			ren.jetBlocks = make(map[string]*jet.Template)
+		}
+		ren.jetBlocks[key] = t
+		ren.mu.Unlock()
+	}
+
+	return t, nil
+}
@@ -0,0 +1,106 @@
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender_ToString(t *testing.T) {
+	testRenderer.RootPath = "./testdata"
+
+	testRenderer.Renderer = "jet"
+	s, err := testRenderer.ToString("page", nil, &TemplateData{Data: map[string]interface{}{"title": "Hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(s) != "<html><h1>Hi</h1></html>" {
+		t.Error("wrong output from ToString:", s)
+	}
+
+	// any data can be the context
+	s, _ = testRenderer.ToString("mail/welcome", nil, struct{ Name string }{"Joe"})
+	if strings.TrimSpace(s) != "Hello Joe" {
+		t.Error("wrong output from ToString with custom data:", s)
+	}
+
+	testRenderer.Renderer = "go"
+	s, err = testRenderer.ToString("home", nil, nil)
+	if err != nil || strings.TrimSpace(s) != "Hello world." {
+		t.Error("wrong output from ToString with go templates:", s, err)
+	}
+
+	_, err = testRenderer.ToString("no-file", nil, nil)
+	if err == nil {
+		t.Error("no error rendering a non-existent template")
+	}
+}
+
+func TestRender_TextToString(t *testing.T) {
+	testRenderer.RootPath = "./testdata"
+	data := struct{ Name string }{"O'Brien <ob@example.com>"}
+
+	for _, renderer := range []string{"jet", "go"} {
+		testRenderer.Renderer = renderer
+
+		s, err := testRenderer.TextToString("mail/welcome", nil, data)
+		if err != nil || strings.TrimSpace(s) != "Hello O'Brien <ob@example.com>" {
+			t.Errorf("%s: expected plain text not to be escaped, got %q %v", renderer, s, err)
+		}
+
+		s, _ = testRenderer.ToString("mail/welcome", nil, data)
+		if strings.Contains(s, "<ob@") {
+			t.Errorf("%s: expected ToString to keep escaping, got %q", renderer, s)
+		}
+	}
+}
+
+func TestRender_BlockToString(t *testing.T) {
+	testRenderer.RootPath = "./testdata"
+
+	testRenderer.Renderer = "jet"
+	s, err := testRenderer.BlockToString("page", "main", nil, &TemplateData{Data: map[string]interface{}{"title": "Hi"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(s) != "<h1>Hi</h1>" {
+		t.Error("wrong output from jet block:", s)
+	}
+
+	_, err = testRenderer.BlockToString("no-file", "content", nil, nil)
+	if err == nil {
+		t.Error("no error rendering a block of a non-existent template")
+	}
+
+	testRenderer.Renderer = "go"
+	testRenderer.FuncMap = map[string]interface{}{"shout": strings.ToUpper}
+	defer func() {
+		testRenderer.FuncMap = nil
+		testRenderer.resetCache()
+	}()
+
+	s, err = testRenderer.BlockToString("about", "content", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(s) != "About US<footer></footer>" {
+		t.Error("wrong output from go block:", s)
+	}
+}
+
+func TestRender_Exists(t *testing.T) {
+	testRenderer.RootPath = "./testdata"
+
+	for _, renderer := range []string{"go", "jet"} {
+		testRenderer.Renderer = renderer
+		if !testRenderer.Exists("home") {
+			t.Error(renderer, "home should exist")
+		}
+
+		if testRenderer.Exists("no-file") {
+			t.Error(renderer, "no-file should not exist")
+		}
+	}
+}
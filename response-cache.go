@@ -0,0 +1,303 @@
+package rasant
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/justinas/nosurf"
+	"github.com/shaynemeyer/rasant/i18n"
+)
+
+// responseCachePrefix is the cache key prefix for every response stored by ResponseCache
+const responseCachePrefix = "response-cache:"
+
+// ResponseCacheConfig holds the settings for the ResponseCache middleware
+type ResponseCacheConfig struct {
+	// Expires is how long a response is kept, in seconds. Zero keeps it until it is purged.
+	Expires int
+	// Vary lists request headers whose values are part of the cache key, e.g. Accept-Language
+	Vary []string
+	// CacheAuthenticated caches responses for logged in users as well. By default, requests
+	// with a userID in the session are passed straight through.
+	CacheAuthenticated bool
+}
+
+// cachedResponse is what ResponseCache stores for each GET response
+type cachedResponse struct {
+	Status int `json:"status"`
+	Header http.Header `json:"header"`
+	Body []byte `json:"body"`
+}
+
+// ResponseCache returns middleware that stores complete GET responses in ras.Cache and serves
+// GET and HEAD requests from it. Responses are keyed on the path, the query string, the
+// locale of the request and the headers listed in cfg.Vary. Only 200 responses are cached,
+// and never responses that belong to one visitor: those the handler marks private or
+// no-store, those that set a cookie, those that contain the visitor's CSRF token (as every
+// page with a form does), and those rendered while the session was changed. Responses that
+// the handler flushes or hijacks go straight to the client and are not cached either.
+// Every response gets an ETag, and requests with a matching If-None-Match get a 304.
+func (ras *Rasant) ResponseCache(cfg ResponseCacheConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ras.Cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !cfg.CacheAuthenticated && ras.Session != nil && ras.Session.Exists(r.Context(), "userID") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, h := range cfg.Vary {
+				w.Header().Add("Vary", h)
+			}
+
+			key := responseCacheKey(r, cfg.Vary)
+
+			if cached, err := ras.Cache.Get(key); err == nil {
+				var resp cachedResponse
+				if b, ok := cached.([]byte); ok && json.Unmarshal(b, &resp) == nil {
+					for k, v := range resp.Header {
+						w.Header()[k] = v
+					}
+					w.Header().Set("X-Cache", "HIT")
+					writeCachedResponse(w, r, resp)
+					return
+				}
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			if rec.passthrough {
+				return
+			}
+
+			resp := cachedResponse{
+				Status: rec.status,
+				Header: w.Header().Clone(),
+				Body: rec.body.Bytes(),
+			}
+			if resp.Status == 0 {
+				resp.Status = http.StatusOK
+			}
+
+			if r.Method == http.MethodGet && ras.cacheable(r, resp) {
+				if resp.Header.Get("ETag") == "" {
+					sum := sha1.Sum(resp.Body)
+					resp.Header.Set("ETag", fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:])))
+					w.Header().Set("ETag", resp.Header.Get("ETag"))
+				}
+
+				resp.Header.Del("X-Cache")
+
+				if b, err := json.Marshal(resp); err == nil {
+					if cfg.Expires > 0 {
+						err = ras.Cache.Set(key, b, cfg.Expires)
+					} else {
+						err = ras.Cache.Set(key, b)
+					}
+					if err != nil {
+						ras.ErrorLog.Println("response cache:", err)
+					}
+				}
+			}
+
+			writeCachedResponse(w, r, resp)
+		})
+	}
+}
+
+// PurgeResponseCache removes every cached response whose path starts with path
+func (ras *Rasant) PurgeResponseCache(path string) error {
+	if ras.Cache == nil {
+		return nil
+	}
+	return ras.Cache.EmptyByMatch(responseCachePrefix + path)
+}
+
+// PurgeAllResponseCache removes every response stored by ResponseCache
+func (ras *Rasant) PurgeAllResponseCache() error {
+	return ras.PurgeResponseCache("")
+}
+
+// cacheable reports whether a freshly rendered response may be stored
+func (ras *Rasant) cacheable(r *http.Request, resp cachedResponse) bool {
+	if resp.Status != http.StatusOK {
+		return false
+	}
+
+	cc := strings.ToLower(resp.Header.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return false
+	}
+
+	// cookies, such as a newly issued CSRF token, belong to the visitor who caused the
+	// response to be rendered
+	if len(resp.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	// a form carries the CSRF token of this visitor, which would fail for everyone else
+	if containsToken(resp.Body, nosurf.Token(r)) {
+		return false
+	}
+
+	// a changed session (e.g. a flash message that was popped into the page) means the
+	// response is specific to this visitor
+	if ras.Session != nil && ras.Session.Status(r.Context()) != scs.Unmodified {
+		return false
+	}
+
+	return true
+}
+
+// containsTokenEscaper escapes a CSRF token the way html/template does in an attribute
+var containsTokenEscaper = strings.NewReplacer("+", "&#43;", "/", "&#47;", "=", "&#61;")
+
+// containsToken reports whether body holds token, as it is or escaped for an HTML attribute
+func containsToken(body []byte, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	return bytes.Contains(body, []byte(token)) || bytes.Contains(body, []byte(containsTokenEscaper.Replace(token)))
+}
+
+// responseCacheKey builds the cache key for r from its path, its query string (with sorted
+// parameters), its locale, the values of the vary headers and whether HTMX made the request
+func responseCacheKey(r *http.Request, vary []string) string {
+	var key strings.Builder
+	key.WriteString(responseCachePrefix)
+	key.WriteString(r.URL.Path)
+
+	if query := r.URL.Query(); len(query) > 0 {
+		key.WriteString("?")
+		key.WriteString(query.Encode())
+	}
+
+	// the same path renders in the language picked by the i18n middleware
+	if locale := i18n.Locale(r.Context()); locale != "" {
+		key.WriteString("|locale=" + locale)
+	}
+
+	for _, h := range vary {
+		key.WriteString(fmt.Sprintf("|%s=%s", strings.ToLower(h), r.Header.Get(h)))
+	}
+
+	// HTMX requests get only a fragment of the page
+	if r.Header.Get("HX-Request") != "" {
+		key.WriteString("|hx-request=" + r.Header.Get("HX-Request"))
+	}
+
+	return key.String()
+}
+
+// writeCachedResponse writes resp to w, or a 304 when the request's If-None-Match matches
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, resp cachedResponse) {
+	if etag := resp.Header.Get("ETag"); etag != "" && etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(resp.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(resp.Body)
+	}
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag, using the weak
+// comparison that If-None-Match calls for
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseRecorder buffers a handler's status code and body so that ResponseCache can store
+// them before anything is sent to the client. A handler that flushes or hijacks the
+// connection turns it into a pass-through to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body bytes.Buffer
+	// passthrough is set once the response goes straight to the client
+	passthrough bool
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	if rec.passthrough {
+		rec.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if rec.status == 0 {
+		rec.status = code
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.passthrough {
+		return rec.ResponseWriter.Write(b)
+	}
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+// Flush sends what has been buffered so far, and the rest as it is written, since a response
+// that is streamed is not cached
+func (rec *responseRecorder) Flush() {
+	if !rec.passthrough {
+		rec.passthrough = true
+		if rec.status != 0 {
+			rec.ResponseWriter.WriteHeader(rec.status)
+		}
+		if rec.body.Len() > 0 {
+			_, _ = rec.ResponseWriter.Write(rec.body.Bytes())
+			rec.body.Reset()
+		}
+	}
+
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack hands the connection over to the handler, as for a websocket
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	rec.passthrough = true
+	return hj.Hijack()
+}
+
+// Unwrap gives http.ResponseController access to the underlying ResponseWriter
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,303 @@
+package rasant
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gomodule/redigo/redis"
+	"github.com/justinas/nosurf"
+	"github.com/shaynemeyer/rasant/cache"
+	"github.com/shaynemeyer/rasant/i18n"
+)
+
+// newResponseCacheTest returns a Rasant with a redis cache and a session manager, and the
+// redis server behind the cache
+func newResponseCacheTest(t *testing.T) (*Rasant, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	pool := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			return redis.Dial("tcp", server.Addr())
+		},
+	}
+	t.Cleanup(func() { pool.Close() })
+
+	ras := &Rasant{
+		Cache: &cache.RedisCache{Conn: pool, Prefix: "test"},
+		Session: scs.New(),
+		ErrorLog: log.New(io.Discard, "", 0),
+	}
+	return ras, server
+}
+
+// countingHandler writes body and counts how often it ran
+type countingHandler struct {
+	calls int
+	handle func(w http.ResponseWriter, r *http.Request)
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls++
+	if h.handle != nil {
+		h.handle(w, r)
+		return
+	}
+	_, _ = w.Write([]byte("hello"))
+}
+
+func serve(handler http.Handler, method, target string, headers ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		r.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestResponseCache_Hit(t *testing.T) {
+	ras, _ := newResponseCacheTest(t)
+	h := &countingHandler{}
+	handler := ras.Session.LoadAndSave(ras.ResponseCache(ResponseCacheConfig{})(h))
+
+	first := serve(handler, "GET", "/page")
+	if first.Header().Get("X-Cache") != "MISS" || first.Body.String() != "hello" {
+		t.Fatalf("expected a miss, got %s %q", first.Header().Get("X-Cache"), first.Body.String())
+	}
+
+	second := serve(handler, "GET", "/page")
+	if second.Header().Get("X-Cache") != "HIT" || second.Body.String() != "hello" || h.calls != 1 {
+		t.Errorf("expected a hit, got %s %q after %d calls", second.Header().Get("X-Cache"), second.Body.String(), h.calls)
+	}
+
+	etag := first.Header().Get("ETag")
+	if etag == "" || second.Header().Get("ETag") != etag {
+		t.Errorf("expected the same ETag on both responses, got %q and %q", etag, second.Header().Get("ETag"))
+	}
+
+	if w := serve(handler, "GET", "/page", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected a 304 for a matching ETag, got %d", w.Code)
+	}
+
+	if w := serve(handler, "HEAD", "/page"); w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("expected HEAD to be served from the cache without a body, got %d %q", w.Code, w.Body.String())
+	}
+
+	if w := serve(handler, "GET", "/page?x=1"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error("a different query should not share the cached response")
+	}
+
+	if err := ras.PurgeResponseCache("/page"); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(handler, "GET", "/page"); w.Header().Get("X-Cache") != "MISS" {
+		t.Error("expected a miss after purging")
+	}
+}
+
+func TestResponseCache_TTL(t *testing.T) {
+	ras, server := newResponseCacheTest(t)
+	h := &countingHandler{}
+	handler := ras.Session.LoadAndSave(ras.ResponseCache(ResponseCacheConfig{Expires: 60})(h))
+
+	serve(handler, "GET", "/page")
+
+	server.FastForward(59 * time.Second)
+	if w := serve(handler, "GET", "/page"); w.Header().Get("X-Cache") != "HIT" {
+		t.Error("expected a hit before the response expires")
+	}
+
+	server.FastForward(2 * time.Second)
+	if w := serve(handler, "GET", "/page"); w.Header().Get("X-Cache") != "MISS" || h.calls != 2 {
+		t.Error("expected a miss once the response expired")
+	}
+}
+
+func TestResponseCache_Bypass(t *testing.T) {
+	tests := []struct {
+		name string
+		method string
+		handle func(ras *Rasant, w http.ResponseWriter, r *http.Request)
+	}{
+		{"POST", "POST", func(ras *Rasant, w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("posted"))
+		}},
+		{"not found", "GET", func(ras *Rasant, w http.ResponseWriter, r *http.Request) {
+			http.NotFound(w, r)
+		}},
+		{"private", "GET", func(ras *Rasant, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "private, max-age=60")
+			_, _ = w.Write([]byte("mine"))
+		}},
+		{"no-store", "GET", func(ras *Rasant, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte("mine"))
+		}},
+		{"Set-Cookie", "GET", func(ras *Rasant, w http.ResponseWriter, r *http.Request) {
+			http.SetCookie(w, &http.Cookie{Name: "visitor", Value: "ada"})
+			_, _ = w.Write([]byte("mine"))
+		}},
+		{"session changed", "GET", func(ras *Rasant, w http.ResponseWriter, r *http.Request) {
+			ras.Session.Put(r.Context(), "flash", "saved")
+			_, _ = w.Write([]byte("mine"))
+		}},
+	}
+
+	for _, tt := range tests {
+		ras, _ := newResponseCacheTest(t)
+		handle := tt.handle
+		h := &countingHandler{handle: func(w http.ResponseWriter, r *http.Request) {
+			handle(ras, w, r)
+		}}
+		handler := ras.Session.LoadAndSave(ras.ResponseCache(ResponseCacheConfig{})(h))
+
+		serve(handler, tt.method, "/page")
+		w := serve(handler, tt.method, "/page")
+		if h.calls != 2 || w.Header().Get("X-Cache") == "HIT" {
+			t.Errorf("%s: expected the response not to be cached", tt.name)
+		}
+	}
+}
+
+func TestResponseCache_Authenticated(t *testing.T) {
+	ras, _ := newResponseCacheTest(t)
+	h := &countingHandler{}
+
+	login := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ras.Session.Put(r.Context(), "userID", 1)
+	})
+	mux := http.NewServeMux()
+	mux.Handle("/login", login)
+	mux.Handle("/page", ras.ResponseCache(ResponseCacheConfig{})(h))
+	handler := ras.Session.LoadAndSave(mux)
+
+	res := serve(handler, "GET", "/login").Result()
+	cookie := res.Cookies()[0]
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/page", nil)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Header().Get("X-Cache") != "" {
+			t.Error("expected requests of logged in users to pass the cache by")
+		}
+	}
+	if h.calls != 2 {
+		t.Errorf("expected the handler to run for every request, got %d calls", h.calls)
+	}
+}
+
+func TestResponseCache_CSRFToken(t *testing.T) {
+	ras, _ := newResponseCacheTest(t)
+
+	// a page with a form carries the visitor's token, escaped for an attribute or not
+	for _, escape := range []bool{false, true} {
+		h := &countingHandler{handle: func(w http.ResponseWriter, r *http.Request) {
+			token := nosurf.Token(r)
+			if escape {
+				token = containsTokenEscaper.Replace(token)
+			}
+			_, _ = w.Write([]byte(`<input type="hidden" name="csrf_token" value="` + token + `">`))
+		}}
+		handler := ras.Session.LoadAndSave(nosurf.New(ras.ResponseCache(ResponseCacheConfig{})(h)))
+
+		first := serve(handler, "GET", "/form").Result()
+		cookies := first.Cookies()
+
+		// even once the visitor has a CSRF cookie, and no new one is issued
+		r := httptest.NewRequest("GET", "/form", nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if h.calls != 2 || w.Header().Get("X-Cache") == "HIT" {
+			t.Errorf("escaped %v: expected a page with a CSRF token not to be cached", escape)
+		}
+		_ = ras.PurgeAllResponseCache()
+	}
+
+	// pages without the token are cached for visitors who already have their CSRF cookie
+	h := &countingHandler{}
+	handler := ras.Session.LoadAndSave(nosurf.New(ras.ResponseCache(ResponseCacheConfig{})(h)))
+	cookies := serve(handler, "GET", "/about").Result().Cookies()
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest("GET", "/about", nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	if h.calls != 2 {
+		t.Errorf("expected the page to be rendered for the new visitor and once more, got %d calls", h.calls)
+	}
+}
+
+func TestResponseCache_Flush(t *testing.T) {
+	ras, _ := newResponseCacheTest(t)
+	h := &countingHandler{handle: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte("data: 2\n\n"))
+	}}
+
+	// the session manager buffers whole responses, so streams are served without it
+	ras.Session = nil
+	handler := ras.ResponseCache(ResponseCacheConfig{})(h)
+
+	w := serve(handler, "GET", "/events")
+	if !w.Flushed || w.Body.String() != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("expected the stream to reach the client, got %q", w.Body.String())
+	}
+
+	serve(handler, "GET", "/events")
+	if h.calls != 2 {
+		t.Error("expected a streamed response not to be cached")
+	}
+
+	if _, ok := interface{}(&responseRecorder{}).(http.Hijacker); !ok {
+		t.Error("expected the recorder to keep http.Hijacker")
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	key := func(target, locale string, headers map[string]string, vary ...string) string {
+		r := httptest.NewRequest("GET", target, nil)
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		if locale != "" {
+			r = r.WithContext(i18n.WithLocale(r.Context(), locale))
+		}
+		return responseCacheKey(r, vary)
+	}
+
+	if key("/a?y=2&x=1", "", nil) != key("/a?x=1&y=2", "", nil) {
+		t.Error("the order of query parameters should not matter")
+	}
+
+	if key("/a", "en", nil) == key("/a", "fr", nil) {
+		t.Error("pages in different locales should not share a key")
+	}
+
+	if key("/a", "", map[string]string{"X-Theme": "dark"}, "X-Theme") == key("/a", "", nil, "X-Theme") {
+		t.Error("vary headers should be part of the key")
+	}
+
+	if key("/a", "", map[string]string{"HX-Request": "true"}) == key("/a", "", nil) {
+		t.Error("HTMX fragments should not share a key with full pages")
+	}
+}
@@ -15,7 +15,9 @@ func (ras *Rasant) routes() http.Handler {
 		mux.Use(middleware.Logger)
 	}
 	mux.Use(middleware.Recoverer)
+	mux.Use(ras.serveStatic)
 	mux.Use(ras.SessionLoad)
+	mux.Use(ras.Localize)
 	mux.Use(ras.NoSurf)
 
 	return mux
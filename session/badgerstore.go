@@ -0,0 +1,95 @@
+package session
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+// BadgerStore is an scs.Store that keeps session data in a Badger database. It can share the
+// database used by the badger cache, since its keys all start with Prefix.
+type BadgerStore struct {
+	DB *badger.DB
+	Prefix string
+}
+
+// NewBadgerStore returns a BadgerStore using db, with the same key prefix as the redis store
+func NewBadgerStore(db *badger.DB) *BadgerStore {
+	return &BadgerStore{
+		DB: db,
+		Prefix: "scs:session:",
+	}
+}
+
+// Find returns the data for a session token. Expired sessions are never found, since Badger
+// drops keys once their TTL has passed.
+func (bs *BadgerStore) Find(token string) ([]byte, bool, error) {
+	var b []byte
+
+	err := bs.DB.View(func(txn *badger.Txn) error {
+		item, err := txn.Get([]byte(bs.Prefix + token))
+		if err != nil {
+			return err
+		}
+
+		b, err = item.ValueCopy(nil)
+		return err
+	})
+
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return b, true, nil
+}
+
+// Commit saves the data for a session token until expiry
+func (bs *BadgerStore) Commit(token string, b []byte, expiry time.Time) error {
+	ttl := time.Until(expiry)
+	if ttl <= 0 {
+		return bs.Delete(token)
+	}
+
+	return bs.DB.Update(func(txn *badger.Txn) error {
+		e := badger.NewEntry([]byte(bs.Prefix+token), b).WithTTL(ttl)
+		return txn.SetEntry(e)
+	})
+}
+
+// Delete removes a session token and its data
+func (bs *BadgerStore) Delete(token string) error {
+	return bs.DB.Update(func(txn *badger.Txn) error {
+		return txn.Delete([]byte(bs.Prefix + token))
+	})
+}
+
+// All returns the data for every active session, keyed by token
+func (bs *BadgerStore) All() (map[string][]byte, error) {
+	sessions := make(map[string][]byte)
+
+	err := bs.DB.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte(bs.Prefix)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			item := it.Item()
+			b, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			sessions[string(item.Key()[len(prefix):])] = b
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,222 @@
+package session
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxCookieSize is the largest cookie browsers are required to accept
+const maxCookieSize = 4096
+
+// ErrCookieTooLarge is returned when the encrypted session data does not fit in a cookie
+var ErrCookieTooLarge = errors.New("session: session data is too large for a cookie")
+
+// errNoCookieJar is returned when the cookie store is used without its middleware
+var errNoCookieJar = errors.New("session: the cookie store requires CookieStore.Middleware")
+
+type cookieJarKey struct{}
+
+// cookieJar carries the session data for one request between the incoming cookie, the
+// session manager and the outgoing cookie
+type cookieJar struct {
+	in []byte
+	out string
+	expiry time.Time
+	changed bool
+}
+
+// CookieStore is an scs.CtxStore that keeps session data in the client's browser instead of
+// on the server. The data is sealed with AES-GCM, so it can be neither read nor changed by the
+// client, and it is bound to the session token, so it cannot be moved to another session.
+// The expiry is sealed with the data and checked on every request, so a cookie that was kept
+// or captured stops working when the session expires, whatever its Expires attribute says.
+//
+// The session manager only hands the store a token, so the store relies on Middleware to read
+// the data cookie from the request and write it to the response. Middleware must wrap the
+// session manager's LoadAndSave.
+type CookieStore struct {
+	Cookie http.Cookie
+	Persist bool
+	// Revoked, when set, is asked about every session token before its data is used
+	Revoked func(token string) bool
+
+	aead cipher.AEAD
+}
+
+// NewCookieStore returns a CookieStore that seals session data with a key derived from key,
+// and writes it to the cookie described by cookie
+func NewCookieStore(key string, cookie http.Cookie, persist bool) (*CookieStore, error) {
+	if key == "" {
+		return nil, errors.New("session: the cookie store needs an encryption key")
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CookieStore{
+		Cookie: cookie,
+		Persist: persist,
+		aead: aead,
+	}, nil
+}
+
+// Middleware reads the session data cookie before next runs, and adds the updated cookie to
+// the response when the session manager commits or destroys the session
+func (cs *CookieStore) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jar := &cookieJar{}
+		if c, err := r.Cookie(cs.Cookie.Name); err == nil {
+			jar.in = []byte(c.Value)
+		}
+
+		ctx := context.WithValue(r.Context(), cookieJarKey{}, jar)
+		next.ServeHTTP(&cookieWriter{ResponseWriter: w, store: cs, jar: jar}, r.WithContext(ctx))
+	})
+}
+
+func (cs *CookieStore) Find(token string) ([]byte, bool, error) {
+	return nil, false, errNoCookieJar
+}
+
+func (cs *CookieStore) Commit(token string, b []byte, expiry time.Time) error {
+	return errNoCookieJar
+}
+
+func (cs *CookieStore) Delete(token string) error {
+	return errNoCookieJar
+}
+
+// FindCtx opens the data cookie of the current request. Data that was tampered with, that
+// belongs to another session or that has expired is treated as not found.
+func (cs *CookieStore) FindCtx(ctx context.Context, token string) ([]byte, bool, error) {
+	jar, ok := ctx.Value(cookieJarKey{}).(*cookieJar)
+	if !ok {
+		return nil, false, errNoCookieJar
+	}
+
+	if len(jar.in) == 0 || (cs.Revoked != nil && cs.Revoked(token)) {
+		return nil, false, nil
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(string(jar.in))
+	if err != nil || len(sealed) < cs.aead.NonceSize() {
+		return nil, false, nil
+	}
+
+	nonce, ciphertext := sealed[:cs.aead.NonceSize()], sealed[cs.aead.NonceSize():]
+	b, err := cs.aead.Open(nil, nonce, ciphertext, []byte(token))
+	if err != nil || len(b) < 8 {
+		return nil, false, nil
+	}
+
+	expiry := time.Unix(0, int64(binary.BigEndian.Uint64(b[:8])))
+	if !time.Now().Before(expiry) {
+		return nil, false, nil
+	}
+
+	return b[8:], true, nil
+}
+
+// CommitCtx seals the session data and its expiry, to be written to the response by
+// Middleware
+func (cs *CookieStore) CommitCtx(ctx context.Context, token string, b []byte, expiry time.Time) error {
+	jar, ok := ctx.Value(cookieJarKey{}).(*cookieJar)
+	if !ok {
+		return errNoCookieJar
+	}
+
+	nonce := make([]byte, cs.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	// the expiry comes first, as nanoseconds since the epoch
+	payload := make([]byte, 8, 8+len(b))
+	binary.BigEndian.PutUint64(payload, uint64(expiry.UnixNano()))
+	payload = append(payload, b...)
+
+	value := base64.RawURLEncoding.EncodeToString(cs.aead.Seal(nonce, nonce, payload, []byte(token)))
+	if len(cs.Cookie.Name)+len(value) > maxCookieSize-256 {
+		return fmt.Errorf("%w (%d bytes)", ErrCookieTooLarge, len(value))
+	}
+
+	jar.out = value
+	jar.expiry = expiry
+	jar.changed = true
+
+	return nil
+}
+
+// DeleteCtx removes the data cookie from the client
+func (cs *CookieStore) DeleteCtx(ctx context.Context, token string) error {
+	jar, ok := ctx.Value(cookieJarKey{}).(*cookieJar)
+	if !ok {
+		return errNoCookieJar
+	}
+
+	jar.out = ""
+	jar.expiry = time.Time{}
+	jar.changed = true
+
+	return nil
+}
+
+// cookieWriter adds the data cookie to the response headers just before they are sent
+type cookieWriter struct {
+	http.ResponseWriter
+	store *CookieStore
+	jar *cookieJar
+	wroteHeader bool
+}
+
+func (cw *cookieWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		cw.writeCookie()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cookieWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *cookieWriter) writeCookie() {
+	if !cw.jar.changed {
+		return
+	}
+
+	cookie := cw.store.Cookie
+	cookie.Value = cw.jar.out
+
+	if cw.jar.out == "" {
+		cookie.Expires = time.Unix(1, 0)
+		cookie.MaxAge = -1
+	} else if cw.store.Persist {
+		cookie.Expires = time.Unix(cw.jar.expiry.Unix()+1, 0)
+		cookie.MaxAge = int(time.Until(cw.jar.expiry).Seconds() + 1)
+	}
+
+	http.SetCookie(cw.ResponseWriter, &cookie)
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Partitioned returns middleware that marks the named cookies as Partitioned (CHIPS), so that
+// browsers keep them when the application is embedded in another site. net/http only learned
+// the attribute in Go 1.23, so it is appended to the Set-Cookie headers just before they are
+// sent.
+func Partitioned(next http.Handler, names ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &partitionedWriter{ResponseWriter: w, names: names}
+		next.ServeHTTP(pw, r)
+
+		// handlers that write nothing leave it to net/http to send the headers
+		if !pw.wroteHeader {
+			pw.partition()
+		}
+	})
+}
+
+type partitionedWriter struct {
+	http.ResponseWriter
+	names []string
+	wroteHeader bool
+}
+
+func (pw *partitionedWriter) WriteHeader(code int) {
+	if !pw.wroteHeader {
+		pw.wroteHeader = true
+		pw.partition()
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *partitionedWriter) Write(b []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	return pw.ResponseWriter.Write(b)
+}
+
+func (pw *partitionedWriter) partition() {
+	cookies := pw.Header()["Set-Cookie"]
+	for i, c := range cookies {
+		name, _, _ := strings.Cut(c, "=")
+		if !pw.matches(name) || strings.Contains(strings.ToLower(c), "; partitioned") {
+			continue
+		}
+		cookies[i] = c + "; Partitioned"
+	}
+}
+
+func (pw *partitionedWriter) matches(name string) bool {
+	for _, n := range pw.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
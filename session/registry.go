@@ -0,0 +1,348 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+)
+
+// SessionInfo describes one of a user's sessions. The session token itself is not part of it,
+// so that it can be shown to the user; ID identifies the session instead.
+type SessionInfo struct {
+	ID string
+	UserID int
+	IP string
+	UserAgent string
+	Device string
+	CreatedAt time.Time
+}
+
+// tracked is an entry of a user's index: the description of a session, and its token
+type tracked struct {
+	Info SessionInfo
+	Token string
+}
+
+// Registry keeps track of which sessions belong to which user, so that a user's sessions can
+// be listed and revoked. Its index is kept in the session store itself, under keys that look
+// like ordinary session tokens, so it works with every store.
+//
+// A user's index is read, changed and written back under a lock that only this process
+// holds, because the stores have no atomic update. Several instances of an application can
+// share a store, but when two of them track sessions of the same user at the same moment, one
+// of the sessions may be left out of the index, and so out of ListSessions and RevokeAll.
+// Applications that need those to be exact should track sessions on a single instance.
+//
+// The cookie store keeps no session data on the server, so with it the index, and the tokens
+// that were revoked, live in a memory store of this process: a revoked cookie session is only
+// refused by the instance that revoked it, and nothing is remembered across restarts. Set
+// Store to a store that the instances share, such as a redis store, to revoke cookie sessions
+// everywhere.
+type Registry struct {
+	Session *scs.SessionManager
+	Store scs.Store
+
+	key []byte
+	mu sync.Mutex
+}
+
+// NewRegistry returns a Registry for the sessions managed by sm. key is the secret session IDs
+// and the registry's own keys are derived from; instances that share a store should share it
+// too. Without a key, a random one is used, which only suits a single instance.
+func NewRegistry(sm *scs.SessionManager, key []byte) *Registry {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+
+	r := &Registry{
+		Session: sm,
+		Store: sm.Store,
+		key: key,
+	}
+
+	if cs, ok := sm.Store.(*CookieStore); ok {
+		r.Store = memstore.New()
+		cs.Revoked = r.revoked
+	}
+
+	return r
+}
+
+// Track records the session in ctx as belonging to userID, along with the IP address and user
+// agent of r. A session that has not been saved yet is given its token now.
+func (reg *Registry) Track(ctx context.Context, r *http.Request, userID int) error {
+	token := reg.Session.Token(ctx)
+	if token == "" {
+		if err := reg.Session.RenewToken(ctx); err != nil {
+			return err
+		}
+		token = reg.Session.Token(ctx)
+	}
+
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	id := reg.ID(token)
+	info := SessionInfo{
+		ID: id,
+		UserID: userID,
+		IP: ip,
+		UserAgent: r.UserAgent(),
+		Device: describeDevice(r.UserAgent()),
+		CreatedAt: time.Now(),
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	sessions, err := reg.load(reg.userKey(userID))
+	if err != nil {
+		return err
+	}
+	sessions[id] = tracked{Info: info, Token: token}
+
+	if err := reg.save(reg.userKey(userID), sessions); err != nil {
+		return err
+	}
+
+	return reg.Store.Commit(reg.idKey(id), []byte(strconv.Itoa(userID)), reg.expiry())
+}
+
+// ID returns the ID of the session with the given token, as found in SessionInfo. It can be
+// compared to the ID of the current session, reg.ID(sm.Token(ctx)), to mark it in a list.
+func (reg *Registry) ID(token string) string {
+	mac := hmac.New(sha256.New, reg.key)
+	mac.Write([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ListSessions returns the active sessions of userID, oldest first. Sessions that have expired
+// since they were tracked are dropped from the index.
+func (reg *Registry) ListSessions(userID int) ([]SessionInfo, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	sessions, err := reg.load(reg.userKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []SessionInfo
+	pruned := false
+	for id, t := range sessions {
+		active, err := reg.active(id, t.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		if !active {
+			delete(sessions, id)
+			pruned = true
+			continue
+		}
+
+		list = append(list, t.Info)
+	}
+
+	if pruned {
+		if err := reg.save(reg.userKey(userID), sessions); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	return list, nil
+}
+
+// RevokeSession ends the session with the given ID. Sessions the registry does not know are
+// left alone.
+func (reg *Registry) RevokeSession(id string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	b, found, err := reg.Store.Find(reg.idKey(id))
+	if err != nil || !found {
+		return err
+	}
+
+	userID, _ := strconv.Atoi(string(b))
+	sessions, err := reg.load(reg.userKey(userID))
+	if err != nil {
+		return err
+	}
+
+	t, ok := sessions[id]
+	if !ok {
+		return reg.Store.Delete(reg.idKey(id))
+	}
+
+	delete(sessions, id)
+	if err := reg.save(reg.userKey(userID), sessions); err != nil {
+		return err
+	}
+
+	return reg.revoke(id, t.Token)
+}
+
+// RevokeAll ends every session of userID, on every device
+func (reg *Registry) RevokeAll(userID int) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	sessions, err := reg.load(reg.userKey(userID))
+	if err != nil {
+		return err
+	}
+
+	for id, t := range sessions {
+		if err := reg.revoke(id, t.Token); err != nil {
+			return err
+		}
+	}
+
+	return reg.Store.Delete(reg.userKey(userID))
+}
+
+// revoke deletes a session from the store, or remembers that it was revoked when the store
+// cannot delete it
+func (reg *Registry) revoke(id, token string) error {
+	if err := reg.Store.Delete(reg.idKey(id)); err != nil {
+		return err
+	}
+
+	if _, ok := reg.Session.Store.(*CookieStore); ok {
+		return reg.Store.Commit(reg.revokedKey(token), []byte{1}, reg.expiry())
+	}
+
+	return reg.Session.Store.Delete(token)
+}
+
+// revoked reports whether a cookie store session was revoked
+func (reg *Registry) revoked(token string) bool {
+	_, found, _ := reg.Store.Find(reg.revokedKey(token))
+	return found
+}
+
+// active reports whether a tracked session still exists
+func (reg *Registry) active(id, token string) (bool, error) {
+	if _, ok := reg.Session.Store.(*CookieStore); ok {
+		// the data is on the client; the ID entry expires along with the session
+		_, found, err := reg.Store.Find(reg.idKey(id))
+		return found, err
+	}
+
+	_, found, err := reg.Session.Store.Find(token)
+	return found, err
+}
+
+func (reg *Registry) load(key string) (map[string]tracked, error) {
+	sessions := make(map[string]tracked)
+
+	b, found, err := reg.Store.Find(key)
+	if err != nil || !found {
+		return sessions, err
+	}
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (reg *Registry) save(key string, sessions map[string]tracked) error {
+	if len(sessions) == 0 {
+		return reg.Store.Delete(key)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sessions); err != nil {
+		return err
+	}
+
+	return reg.Store.Commit(key, buf.Bytes(), reg.expiry())
+}
+
+// expiry is how long registry entries are kept: as long as the longest possible session
+func (reg *Registry) expiry() time.Time {
+	return time.Now().Add(reg.Session.Lifetime)
+}
+
+// registryKey turns a registry key into something shaped like a session token, so that it
+// fits the token column of the SQL stores. The registry shares the store with the sessions,
+// so its keys are derived with the secret key: a client that could compute them could send
+// one as its session token.
+func (reg *Registry) registryKey(key string) string {
+	mac := hmac.New(sha256.New, reg.key)
+	mac.Write([]byte("rasant-session-registry:" + key))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (reg *Registry) userKey(userID int) string {
+	return reg.registryKey(fmt.Sprintf("user:%d", userID))
+}
+
+func (reg *Registry) idKey(id string) string {
+	return reg.registryKey("id:" + id)
+}
+
+func (reg *Registry) revokedKey(token string) string {
+	return reg.registryKey("revoked:" + token)
+}
+
+// describeDevice gives a short, human readable description of a user agent, such as
+// "Firefox on Windows"
+func describeDevice(ua string) string {
+	browser := "Unknown browser"
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := "unknown device"
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	return browser + " on " + os
+}
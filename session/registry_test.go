@@ -0,0 +1,169 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	r := &Session{
+		CookieLifetime: "100",
+		CookieName: "rasant",
+		SessionType: "memory",
+	}
+	sm := r.InitSession()
+	reg := NewRegistry(sm, []byte("secret"))
+
+	login := func(userAgent string) *http.Cookie {
+		handler := sm.LoadAndSave(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sm.Put(r.Context(), "userID", 1)
+			if err := reg.Track(r.Context(), r, 1); err != nil {
+				t.Error(err)
+			}
+		}))
+
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.Header.Set("User-Agent", userAgent)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr.Result().Cookies()[0]
+	}
+
+	firefox := login("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:109.0) Gecko/20100101 Firefox/115.0")
+	safari := login("Mozilla/5.0 (iPhone; CPU iPhone OS 16_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.5 Mobile/15E148 Safari/604.1")
+
+	sessions, err := reg.ListSessions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions) != 2 {
+		t.Fatal("expected 2 sessions, but got", len(sessions))
+	}
+
+	if sessions[0].ID != reg.ID(firefox.Value) || sessions[0].Device != "Firefox on Windows" {
+		t.Error("wrong first session:", sessions[0])
+	}
+
+	// the list can be shown to the user, so it must not give the tokens away
+	for _, info := range sessions {
+		if info.ID == firefox.Value || info.ID == safari.Value || strings.Contains(fmt.Sprint(info), firefox.Value) {
+			t.Error("session info contains the token:", info)
+		}
+	}
+
+	if NewRegistry(sm, []byte("other")).ID(firefox.Value) == sessions[0].ID {
+		t.Error("expected the ID to depend on the key")
+	}
+
+	// the index shares the store with the sessions, so its key must not be predictable:
+	// sent as a session token, it would be decoded as session data
+	sum := sha256.Sum256([]byte("rasant-session-registry:user:1"))
+	if _, found, _ := sm.Store.Find(base64.RawURLEncoding.EncodeToString(sum[:])); found {
+		t.Error("expected the index not to be stored under a key anyone can compute")
+	}
+	if _, found, _ := sm.Store.Find(reg.userKey(1)); !found {
+		t.Error("expected the index under its derived key")
+	}
+	if NewRegistry(sm, []byte("other")).userKey(1) == reg.userKey(1) {
+		t.Error("expected the index key to depend on the key")
+	}
+	if NewRegistry(sm, nil).userKey(1) == NewRegistry(sm, nil).userKey(1) {
+		t.Error("expected a registry without a key to get a random one")
+	}
+
+	if sessions[1].Device != "Safari on iPhone" || sessions[1].IP != "192.0.2.1" {
+		t.Error("wrong second session:", sessions[1])
+	}
+
+	// a token is not an ID
+	err = reg.RevokeSession(firefox.Value)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, found, _ := sm.Store.Find(firefox.Value); !found {
+		t.Error("expected a session not to be revoked by its token")
+	}
+
+	err = reg.RevokeSession(sessions[0].ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, found, _ := sm.Store.Find(firefox.Value); found {
+		t.Error("revoked session is still in the store")
+	}
+
+	sessions, _ = reg.ListSessions(1)
+	if len(sessions) != 1 || sessions[0].ID != reg.ID(safari.Value) {
+		t.Error("expected only the safari session to remain:", sessions)
+	}
+
+	err = reg.RevokeAll(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, found, _ := sm.Store.Find(safari.Value); found {
+		t.Error("session is still in the store after RevokeAll")
+	}
+
+	sessions, _ = reg.ListSessions(1)
+	if len(sessions) != 0 {
+		t.Error("expected no sessions after RevokeAll, but got", len(sessions))
+	}
+}
+
+func TestRegistry_CookieStore(t *testing.T) {
+	r := &Session{
+		CookieLifetime: "100",
+		CookieName: "rasant",
+		SessionType: "cookie",
+		EncryptionKey: "01234567890123456789012345678901",
+	}
+	sm := r.InitSession()
+	cs := sm.Store.(*CookieStore)
+	reg := NewRegistry(sm, []byte("secret"))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "userID", 7)
+		_ = reg.Track(r.Context(), r, 7)
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if sm.Exists(r.Context(), "userID") {
+			_, _ = w.Write([]byte("logged in"))
+		}
+	})
+	handler := cs.Middleware(sm.LoadAndSave(mux))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("POST", "/login", nil))
+	cookies := rr.Result().Cookies()
+
+	user := func() string {
+		req := httptest.NewRequest("GET", "/user", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+
+	if user() != "logged in" {
+		t.Fatal("session was not loaded from the cookie")
+	}
+
+	_ = reg.RevokeAll(7)
+
+	if user() != "" {
+		t.Error("revoked cookie session was still accepted")
+	}
+}
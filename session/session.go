@@ -11,6 +11,8 @@ import (
 	"github.com/alexedwards/scs/postgresstore"
 	"github.com/alexedwards/scs/redisstore"
 	"github.com/alexedwards/scs/v2"
+	"github.com/alexedwards/scs/v2/memstore"
+	"github.com/dgraph-io/badger/v3"
 	"github.com/gomodule/redigo/redis"
 )
 
@@ -21,8 +23,15 @@ type Session struct {
 	CookieDomain string
 	SessionType string
 	CookieSecure string
+	CookieSameSite string
+	CookiePath string
+	CookieHTTPOnly string
+	CookiePartitioned string
+	IdleTimeout string
 	DBPool *sql.DB
 	RedisPool *redis.Pool
+	BadgerConn *badger.DB
+	EncryptionKey string
 }
 
 func (c *Session) InitSession() *scs.SessionManager {
@@ -44,14 +53,36 @@ func (c *Session) InitSession() *scs.SessionManager {
 		secure = true
 	} 
 
+	// which sites may send the cookie?
+	sameSite := ParseSameSite(c.CookieSameSite, http.SameSiteLaxMode)
+
+	// browsers reject SameSite=None and Partitioned cookies that are not secure
+	if sameSite == http.SameSiteNoneMode || strings.ToLower(c.CookiePartitioned) == "true" {
+		secure = true
+	}
+
+	path := c.CookiePath
+	if path == "" {
+		path = "/"
+	}
+
+	// how long may a session go unused? zero means only the lifetime applies
+	idleMinutes, err := strconv.Atoi(c.IdleTimeout)
+	if err != nil {
+		idleMinutes = 0
+	}
+
 	// create session
 	session := scs.New()
 	session.Lifetime = time.Duration(minutes) * time.Minute
+	session.IdleTimeout = time.Duration(idleMinutes) * time.Minute
 	session.Cookie.Persist = persist	
 	session.Cookie.Name = c.CookieName
 	session.Cookie.Secure = secure
 	session.Cookie.Domain = c.CookieDomain
-	session.Cookie.SameSite = http.SameSiteLaxMode
+	session.Cookie.SameSite = sameSite
+	session.Cookie.Path = path
+	session.Cookie.HttpOnly = strings.ToLower(c.CookieHTTPOnly) != "false"
 
 	// which session store?
 	switch strings.ToLower(c.SessionType) {
@@ -61,9 +92,45 @@ func (c *Session) InitSession() *scs.SessionManager {
 		session.Store = mysqlstore.New(c.DBPool)
 	case "postgres", "postgresql":
 		session.Store = postgresstore.New(c.DBPool)
+	case "badger":
+		session.Store = NewBadgerStore(c.BadgerConn)
+	case "cookie":
+		cookie := http.Cookie{
+			Name: session.Cookie.Name + "_data",
+			Domain: session.Cookie.Domain,
+			Path: session.Cookie.Path,
+			Secure: session.Cookie.Secure,
+			HttpOnly: session.Cookie.HttpOnly,
+			SameSite: session.Cookie.SameSite,
+		}
+		store, err := NewCookieStore(c.EncryptionKey, cookie, persist)
+		if err != nil {
+			// without a key there is nothing to seal the cookie with, so keep sessions in memory
+			session.Store = memstore.New()
+		} else {
+			session.Store = store
+		}
 	default:
-		// cookie
+		// memory
+		session.Store = memstore.New()
 	}
 
 	return session
-}
\ No newline at end of file
+}
+
+// ParseSameSite converts a SameSite setting (strict, lax, none or default) to its
+// http.SameSite value, returning fallback for empty or unknown settings
+func ParseSameSite(s string, fallback http.SameSite) http.SameSite {
+	switch strings.ToLower(s) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	case "default":
+		return http.SameSiteDefaultMode
+	default:
+		return fallback
+	}
+}
@@ -0,0 +1,257 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexedwards/scs/v2"
+	"github.com/dgraph-io/badger/v3"
+)
+
+func TestBadgerStore(t *testing.T) {
+	db, err := badger.Open(badger.DefaultOptions("").WithInMemory(true).WithLogger(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	bs := NewBadgerStore(db)
+
+	err = bs.Commit("token", []byte("data"), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Error(err)
+	}
+
+	b, found, err := bs.Find("token")
+	if err != nil || !found || string(b) != "data" {
+		t.Error("did not find committed session; found:", found, "err:", err)
+	}
+
+	all, err := bs.All()
+	if err != nil || len(all) != 1 {
+		t.Error("expected one session from All, but got", len(all), err)
+	}
+
+	_ = bs.Delete("token")
+
+	_, found, _ = bs.Find("token")
+	if found {
+		t.Error("session found after delete")
+	}
+}
+
+func TestSession_InitSessionStores(t *testing.T) {
+	r := &Session{
+		CookieLifetime: "100",
+		CookieName: "rasant",
+		SessionType: "cookie",
+		EncryptionKey: "01234567890123456789012345678901",
+	}
+
+	if _, ok := r.InitSession().Store.(*CookieStore); !ok {
+		t.Error("expected a cookie store")
+	}
+
+	r.EncryptionKey = ""
+	if _, ok := r.InitSession().Store.(*CookieStore); ok {
+		t.Error("a cookie store was created without an encryption key")
+	}
+}
+
+func TestCookieStore(t *testing.T) {
+	r := &Session{
+		CookieLifetime: "100",
+		CookieName: "rasant",
+		SessionType: "cookie",
+		EncryptionKey: "01234567890123456789012345678901",
+	}
+	sm := r.InitSession()
+	cs := sm.Store.(*CookieStore)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/put", func(w http.ResponseWriter, r *http.Request) {
+		sm.Put(r.Context(), "name", "rasant")
+	})
+	mux.HandleFunc("/get", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(sm.GetString(r.Context(), "name")))
+	})
+	handler := cs.Middleware(sm.LoadAndSave(mux))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/put", nil))
+	cookies := rr.Result().Cookies()
+
+	if len(cookies) != 2 {
+		t.Fatal("expected a token and a data cookie, but got", len(cookies))
+	}
+
+	for _, c := range cookies {
+		if c.Name == "rasant_data" && strings.Contains(c.Value, "rasant") {
+			t.Error("session data is readable in the cookie")
+		}
+	}
+
+	get := func(cookies []*http.Cookie) string {
+		req := httptest.NewRequest("GET", "/get", nil)
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Body.String()
+	}
+
+	if body := get(cookies); body != "rasant" {
+		t.Error("expected session value rasant, but got", body)
+	}
+
+	// a changed data cookie must not be accepted
+	tampered := make([]*http.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		c := *c
+		if c.Name == "rasant_data" {
+			b := []byte(c.Value)
+			i := len(b) / 2
+			if b[i] == 'A' {
+				b[i] = 'B'
+			} else {
+				b[i] = 'A'
+			}
+			c.Value = string(b)
+		}
+		tampered = append(tampered, &c)
+	}
+
+	if body := get(tampered); body != "" {
+		t.Error("tampered cookie was accepted")
+	}
+
+	// nor may the data be moved to another session token
+	moved := make([]*http.Cookie, 0, len(cookies))
+	for _, c := range cookies {
+		c := *c
+		if c.Name == "rasant" {
+			c.Value = "another-token"
+		}
+		moved = append(moved, &c)
+	}
+
+	if body := get(moved); body != "" {
+		t.Error("data cookie was accepted for another session token")
+	}
+}
+
+func TestCookieStore_Expiry(t *testing.T) {
+	cs, err := NewCookieStore("secret", http.Cookie{Name: "data"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seal data the way a request would, and keep the cookie
+	commit := func(expiry time.Time) *http.Cookie {
+		var cookie *http.Cookie
+		handler := cs.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := cs.CommitCtx(r.Context(), "token", []byte("data"), expiry); err != nil {
+				t.Fatal(err)
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		for _, c := range rr.Result().Cookies() {
+			cookie = c
+		}
+		if cookie == nil {
+			t.Fatal("expected a data cookie")
+		}
+		return cookie
+	}
+
+	// and replay it later, whatever its Expires attribute said
+	find := func(cookie *http.Cookie) ([]byte, bool) {
+		var b []byte
+		var found bool
+		handler := cs.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, found, err = cs.FindCtx(r.Context(), "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}))
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return b, found
+	}
+
+	if b, found := find(commit(time.Now().Add(time.Minute))); !found || string(b) != "data" {
+		t.Errorf("expected the session data, got %q %v", b, found)
+	}
+
+	if _, found := find(commit(time.Now().Add(-time.Second))); found {
+		t.Error("an expired cookie was accepted")
+	}
+}
+
+func TestCookieStore_WithoutMiddleware(t *testing.T) {
+	cs, err := NewCookieStore("secret", http.Cookie{Name: "data"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var store scs.Store = cs
+	if err := store.Commit("token", []byte("data"), time.Now().Add(time.Minute)); err == nil {
+		t.Error("expected an error when the middleware is not used")
+	}
+}
+
+func TestSession_InitSessionCookie(t *testing.T) {
+	r := &Session{
+		CookieLifetime: "100",
+		CookieName: "rasant",
+		SessionType: "memory",
+		CookieSameSite: "none",
+		CookiePath: "/app",
+		CookieHTTPOnly: "false",
+		IdleTimeout: "20",
+	}
+
+	sm := r.InitSession()
+
+	if sm.Cookie.SameSite != http.SameSiteNoneMode {
+		t.Error("wrong SameSite mode:", sm.Cookie.SameSite)
+	}
+
+	if !sm.Cookie.Secure {
+		t.Error("SameSite=None cookie is not secure")
+	}
+
+	if sm.Cookie.Path != "/app" || sm.Cookie.HttpOnly {
+		t.Error("cookie path and HttpOnly settings were not applied")
+	}
+
+	if sm.IdleTimeout != 20*time.Minute || sm.Lifetime != 100*time.Minute {
+		t.Error("wrong idle timeout or lifetime:", sm.IdleTimeout, sm.Lifetime)
+	}
+}
+
+func TestPartitioned(t *testing.T) {
+	handler := Partitioned(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "rasant", Value: "token", Secure: true})
+		http.SetCookie(w, &http.Cookie{Name: "other", Value: "value"})
+	}), "rasant")
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+
+	cookies := rr.Header()["Set-Cookie"]
+	if !strings.HasSuffix(cookies[0], "; Partitioned") {
+		t.Error("session cookie is not partitioned:", cookies[0])
+	}
+
+	if strings.Contains(cookies[1], "Partitioned") {
+		t.Error("unrelated cookie was partitioned:", cookies[1])
+	}
+}
@@ -0,0 +1,274 @@
+package rasant
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fingerprintPattern matches file names with a content hash, like app.3f2a9c1d07.css
+var fingerprintPattern = regexp.MustCompile(`^(.+)\.([0-9a-f]{10})(\.[^./]+)$`)
+
+// staticFiles serves the public folder. Every file can be requested by its own name, which is
+// revalidated with an ETag, or by a fingerprinted name that includes a hash of its contents,
+// which browsers may cache forever. Precompressed .br and .gz variants are served to clients
+// that accept them.
+type staticFiles struct {
+	fsys fs.FS
+	debug bool
+
+	mu sync.RWMutex
+	hashes map[string]string
+}
+
+// newStaticFiles returns a staticFiles for fsys, hashing every file up front unless debug is
+// set, in which case files are hashed as they are requested, since they keep changing
+func newStaticFiles(fsys fs.FS, debug bool) *staticFiles {
+	s := &staticFiles{
+		fsys: fsys,
+		debug: debug,
+		hashes: make(map[string]string),
+	}
+
+	if !debug {
+		s.buildManifest()
+	}
+
+	return s
+}
+
+// buildManifest hashes every file in the public folder
+func (s *staticFiles) buildManifest() {
+	_ = fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || isCompressedVariant(name) {
+			return nil
+		}
+		_, _ = s.hash(name)
+		return nil
+	})
+}
+
+// Manifest maps every file in the public folder to its fingerprinted name
+func (s *staticFiles) Manifest() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	manifest := make(map[string]string, len(s.hashes))
+	for name, hash := range s.hashes {
+		manifest[name] = fingerprinted(name, hash)
+	}
+	return manifest
+}
+
+// hash returns the content hash of a file, from the manifest unless in debug mode
+func (s *staticFiles) hash(name string) (string, error) {
+	if !s.debug {
+		s.mu.RLock()
+		hash, ok := s.hashes[name]
+		s.mu.RUnlock()
+		if ok {
+			return hash, nil
+		}
+	}
+
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(h.Sum(nil))[:10]
+
+	s.mu.Lock()
+	s.hashes[name] = hash
+	s.mu.Unlock()
+
+	return hash, nil
+}
+
+// URL returns the fingerprinted URL of a file in the public folder, or its plain URL if it
+// does not exist
+func (s *staticFiles) URL(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+
+	hash, err := s.hash(name)
+	if err != nil {
+		return "/public/" + name
+	}
+
+	return "/public/" + fingerprinted(name, hash)
+}
+
+func (s *staticFiles) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, "/public")), "/")
+	immutable := false
+
+	if _, err := fs.Stat(s.fsys, name); err != nil {
+		m := fingerprintPattern.FindStringSubmatch(name)
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		name = m[1] + m[3]
+		hash, err := s.hash(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		// an old fingerprint still gets the current file, but it must not be cached for good
+		immutable = hash == m[2]
+	}
+
+	hash, err := s.hash(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	file, encoding := name, ""
+	best := 0.0
+	for _, v := range []struct{ encoding, ext string }{{"br", ".br"}, {"gzip", ".gz"}} {
+		if q := acceptedEncoding(r.Header, v.encoding); q > best && s.exists(name+v.ext) {
+			file, encoding, best = name+v.ext, v.encoding, q
+		}
+	}
+
+	f, err := s.fsys.Open(file)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		// file systems whose files cannot seek are read into memory
+		b, err := io.ReadAll(f)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		content = bytes.NewReader(b)
+	}
+
+	etag := `"` + hash
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
+		etag += "-" + encoding
+	}
+	w.Header().Set("ETag", etag+`"`)
+
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// acceptedEncoding returns the quality, from 0 to 1, that the Accept-Encoding header of a
+// request gives to encoding. Encodings that are not listed are only accepted through *.
+func acceptedEncoding(header http.Header, encoding string) float64 {
+	wildcard := 0.0
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			params := strings.Split(part, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+
+			q := 1.0
+			for _, param := range params[1:] {
+				key, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.ToLower(strings.TrimSpace(key)) != "q" {
+					continue
+				}
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				} else {
+					q = 0
+				}
+			}
+
+			switch name {
+			case encoding:
+				return q
+			case "*":
+				wildcard = q
+			}
+		}
+	}
+	return wildcard
+}
+
+func (s *staticFiles) exists(name string) bool {
+	info, err := fs.Stat(s.fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// fingerprinted adds hash to a file name, before its extension
+func fingerprinted(name, hash string) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+func isCompressedVariant(name string) bool {
+	return strings.HasSuffix(name, ".br") || strings.HasSuffix(name, ".gz")
+}
+
+// AssetURL returns the fingerprinted URL of a file in the public folder, for use in pages and
+// mail
+func (ras *Rasant) AssetURL(name string) string {
+	return ras.static.URL(name)
+}
+
+// AssetManifest maps every file in the public folder to its fingerprinted name, e.g. for
+// scripts that load assets themselves
+func (ras *Rasant) AssetManifest() map[string]string {
+	return ras.static.Manifest()
+}
+
+// serveStatic is middleware that answers requests under /public/ from the public folder. It is
+// middleware rather than a route so that applications can still add their own middleware
+// after New has set up the router.
+func (ras *Rasant) serveStatic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/public/") {
+			ras.static.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
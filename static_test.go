@@ -0,0 +1,150 @@
+package rasant
+
+import (
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func newStaticTest() *staticFiles {
+	modTime := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	return newStaticFiles(fstest.MapFS{
+		"css/app.css": {Data: []byte("body { color: red }"), ModTime: modTime},
+		"css/app.css.br": {Data: []byte("brotli"), ModTime: modTime},
+		"css/app.css.gz": {Data: []byte("gzipped"), ModTime: modTime},
+		"js/app.js": {Data: []byte("alert(1)"), ModTime: modTime},
+		"js/app.js.gz": {Data: []byte("gzipped js"), ModTime: modTime},
+	}, false)
+}
+
+func TestStaticFiles_ETag(t *testing.T) {
+	s := newStaticTest()
+
+	w := serve(s, "GET", "/public/css/app.css")
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || w.Body.String() != "body { color: red }" || etag == "" {
+		t.Fatalf("expected the file with an ETag, got %d %q %q", w.Code, w.Body.String(), etag)
+	}
+	if w.Header().Get("Content-Type") != "text/css; charset=utf-8" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("wrong headers: %v", w.Header())
+	}
+
+	if w := serve(s, "GET", "/public/css/app.css", "If-None-Match", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("expected a 304 for a matching ETag, got %d", w.Code)
+	}
+	if w := serve(s, "GET", "/public/css/app.css", "If-None-Match", `"other"`); w.Code != http.StatusOK {
+		t.Errorf("expected a 200 for another ETag, got %d", w.Code)
+	}
+
+	// every encoding has an ETag of its own
+	gz := serve(s, "GET", "/public/css/app.css", "Accept-Encoding", "gzip")
+	if gz.Header().Get("ETag") == etag {
+		t.Error("expected the gzipped file to have another ETag")
+	}
+	if w := serve(s, "GET", "/public/css/app.css", "If-None-Match", gz.Header().Get("ETag")); w.Code != http.StatusOK {
+		t.Errorf("expected the ETag of the gzipped file not to match the plain one, got %d", w.Code)
+	}
+
+	if w := serve(s, "HEAD", "/public/css/app.css"); w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("expected HEAD without a body, got %d", w.Code)
+	}
+	if w := serve(s, "POST", "/public/css/app.css"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected a 405 for POST, got %d", w.Code)
+	}
+}
+
+func TestStaticFiles_Fingerprint(t *testing.T) {
+	s := newStaticTest()
+
+	url := s.URL("css/app.css")
+	if url == "/public/css/app.css" || !strings.HasSuffix(url, ".css") || s.Manifest()["css/app.css"] != strings.TrimPrefix(url, "/public/") {
+		t.Fatalf("wrong fingerprinted url %s, manifest %v", url, s.Manifest())
+	}
+	if _, ok := s.Manifest()["css/app.css.br"]; ok {
+		t.Error("compressed variants should not be in the manifest")
+	}
+
+	w := serve(s, "GET", url)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("expected the fingerprinted file to be cached for good, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+
+	w = serve(s, "GET", "/public/css/app.0123456789.css")
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("expected an old fingerprint to get the current file without caching, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+
+	if url := s.URL("missing.css"); url != "/public/missing.css" {
+		t.Errorf("expected a missing file to keep its name, got %s", url)
+	}
+}
+
+func TestStaticFiles_Precompressed(t *testing.T) {
+	s := newStaticTest()
+
+	tests := []struct {
+		path string
+		accept string
+		body string
+		encoding string
+	}{
+		{"/public/css/app.css", "", "body { color: red }", ""},
+		{"/public/css/app.css", "gzip, deflate, br", "brotli", "br"},
+		{"/public/css/app.css", "gzip", "gzipped", "gzip"},
+		{"/public/css/app.css", "GZIP", "gzipped", "gzip"},
+		{"/public/css/app.css", "br;q=0, gzip", "gzipped", "gzip"},
+		{"/public/css/app.css", "br;q=0.5, gzip;q=0.8", "gzipped", "gzip"},
+		{"/public/css/app.css", "br;q=0.8, gzip;q=0.8", "brotli", "br"},
+		{"/public/css/app.css", "br;q=0, gzip;q=0", "body { color: red }", ""},
+		{"/public/css/app.css", "*", "brotli", "br"},
+		{"/public/css/app.css", "*;q=0", "body { color: red }", ""},
+		{"/public/css/app.css", "gzip;q=0, *", "brotli", "br"},
+		// no substring matches
+		{"/public/css/app.css", "x-gzip, brotli", "body { color: red }", ""},
+		{"/public/css/app.css", "identity", "body { color: red }", ""},
+		// only the variants that exist are served
+		{"/public/js/app.js", "br, gzip", "gzipped js", "gzip"},
+		{"/public/js/app.js", "br", "alert(1)", ""},
+	}
+
+	for _, tt := range tests {
+		w := serve(s, "GET", tt.path, "Accept-Encoding", tt.accept)
+		if w.Body.String() != tt.body || w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("%s with %q: expected %q %q, got %q %q", tt.path, tt.accept, tt.body, tt.encoding, w.Body.String(), w.Header().Get("Content-Encoding"))
+		}
+		if w.Header().Get("Content-Type") == "" || w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s with %q: wrong headers %v", tt.path, tt.accept, w.Header())
+		}
+	}
+}
+
+func TestStaticFiles_Traversal(t *testing.T) {
+	// the public folder is a folder of the application, next to files that must stay private
+	app := fstest.MapFS{
+		"go.mod": {Data: []byte("module app")},
+		"static.go": {Data: []byte("package app")},
+		"public/css/app.css": {Data: []byte("body { color: red }")},
+	}
+	public, err := fs.Sub(app, "public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStaticFiles(public, false)
+
+	for _, path := range []string{
+		"/public/../go.mod",
+		"/public/../../etc/passwd",
+		"/public/css/../../static.go",
+		"/public/%2e%2e/go.mod",
+		"/public/css",
+		"/public/",
+		"/public/missing.css",
+	} {
+		if w := serve(s, "GET", path); w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected a 404, got %d", path, w.Code)
+		}
+	}
+}
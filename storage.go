@@ -0,0 +1,19 @@
+package rasant
+
+import (
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+// Storage returns the entry of FileSystems called name, such as MINIO, as a
+// filesystems.Storage. Entries are either a filesystems.Storage themselves, or a
+// filesystems.StorageProvider such as the file system drivers.
+func (ras *Rasant) Storage(name string) (filesystems.Storage, bool) {
+	switch fsys := ras.FileSystems[name].(type) {
+	case filesystems.Storage:
+		return fsys, true
+	case filesystems.StorageProvider:
+		return fsys.Storage(), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,146 @@
+package rasant
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gertd/go-pluralize"
+	"github.com/justinas/nosurf"
+	"github.com/shaynemeyer/rasant/render"
+	"github.com/shaynemeyer/rasant/urlsigner"
+)
+
+// NameRoute gives pattern (a chi route pattern such as /users/{id}) a name, so templates can
+// build its URL with route
+func (ras *Rasant) NameRoute(name, pattern string) {
+	if ras.routeNames == nil {
+		ras.routeNames = make(map[string]string)
+	}
+	ras.routeNames[name] = pattern
+}
+
+// Route returns the path of the route called name, filling its {placeholders} with params in
+// order. The values are escaped, so they always stay within their path segment.
+func (ras *Rasant) Route(name string, params ...interface{}) (string, error) {
+	pattern, ok := ras.routeNames[name]
+	if !ok {
+		return "", fmt.Errorf("no route named %s", name)
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.Index(pattern, "{")
+		if start < 0 {
+			break
+		}
+
+		end := strings.Index(pattern[start:], "}")
+		if end < 0 {
+			break
+		}
+
+		if len(params) == 0 {
+			return "", fmt.Errorf("route %s: missing value for %s", name, pattern[start:start+end+1])
+		}
+
+		b.WriteString(pattern[:start])
+		b.WriteString(url.PathEscape(fmt.Sprint(params[0])))
+		params = params[1:]
+		pattern = pattern[start+end+1:]
+	}
+	b.WriteString(pattern)
+
+	return b.String(), nil
+}
+
+// URL returns the absolute URL of path on this application
+func (ras *Rasant) URL(p string) string {
+	return strings.TrimSuffix(ras.Server.URL, "/") + "/" + strings.TrimPrefix(p, "/")
+}
+
+// registerTemplateFuncs adds the built in template functions to both renderers:
+//
+//	url         absolute URL of a path
+//	asset       fingerprinted path of a file in public/, which browsers may cache forever
+//	asset_manifest  every file in public/, mapped to its fingerprinted name
+//	csrf_field  hidden input holding the CSRF token (use with raw in Jet)
+//	hx_headers  hx-headers attribute that sends the CSRF token with HTMX requests (raw in Jet)
+//	signed_url  absolute URL of a path, signed with the application key
+//	route       path of a named route
+//	date        format a time, by default as Jan 2, 2006
+//	pluralize   word, pluralized unless count is 1
+func (ras *Rasant) registerTemplateFuncs() {
+	ras.Render.AddFunc("url", ras.URL)
+	ras.Render.AddFunc("asset", ras.AssetURL)
+	ras.Render.AddFunc("asset_manifest", ras.AssetManifest)
+	ras.Render.AddFunc("csrf_field", csrfField)
+	ras.Render.AddFunc("hx_headers", hxHeaders)
+	ras.Render.AddFunc("signed_url", func(p string) string {
+		signer := urlsigner.Signer{
+			Secret: []byte(ras.EncryptionKey),
+		}
+		return signer.GenerateTokenFromString(ras.URL(p))
+	})
+	ras.Render.AddFunc("route", func(name string, params ...interface{}) string {
+		url, err := ras.Route(name, params...)
+		if err != nil {
+			ras.ErrorLog.Println(err)
+		}
+		return url
+	})
+	ras.Render.AddFunc("date", formatDate)
+
+	plural := pluralize.NewClient()
+	ras.Render.AddFunc("pluralize", func(count int, word string) string {
+		if count == 1 {
+			return plural.Singular(word)
+		}
+		return plural.Plural(word)
+	})
+}
+
+// csrfField returns a hidden form field holding the CSRF token. It takes the template data, or
+// the token itself.
+func csrfField(data interface{}) template.HTML {
+	var token string
+	switch d := data.(type) {
+	case *render.TemplateData:
+		token = d.CSRFToken
+	case string:
+		token = d
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="csrf_token" value="%s">`, template.HTMLEscapeString(token)))
+}
+
+// hxHeaders returns an hx-headers attribute that makes HTMX send the CSRF token in the header
+// NoSurf checks, for use on the body tag. It takes the template data, or the token itself.
+func hxHeaders(data interface{}) template.HTMLAttr {
+	var token string
+	switch d := data.(type) {
+	case *render.TemplateData:
+		token = d.CSRFToken
+	case string:
+		token = d
+	}
+
+	b, _ := json.Marshal(map[string]string{nosurf.HeaderName: token})
+	return template.HTMLAttr(fmt.Sprintf(`hx-headers='%s'`, template.HTMLEscapeString(string(b))))
+}
+
+// formatDate formats t with layout, or as Jan 2, 2006 when no layout is given
+func formatDate(t time.Time, layout ...string) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	if len(layout) > 0 {
+		return t.Format(layout[0])
+	}
+
+	return t.Format("Jan 2, 2006")
+}
@@ -0,0 +1,88 @@
+package rasant
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/CloudyKit/jet/v6"
+	"github.com/CloudyKit/jet/v6/loaders/httpfs"
+	"github.com/shaynemeyer/rasant/render"
+)
+
+func TestRoute(t *testing.T) {
+	ras := &Rasant{}
+	ras.NameRoute("user", "/users/{id}")
+	ras.NameRoute("post", "/users/{user}/posts/{slug:[a-z-]+}")
+	ras.NameRoute("home", "/")
+
+	tests := []struct {
+		name string
+		params []interface{}
+		path string
+		err string
+	}{
+		{"user", []interface{}{7}, "/users/7", ""},
+		{"post", []interface{}{"ada", "first-post"}, "/users/ada/posts/first-post", ""},
+		{"home", nil, "/", ""},
+		// values cannot leave their path segment
+		{"user", []interface{}{"../admin?x=1"}, "/users/..%2Fadmin%3Fx=1", ""},
+		{"user", []interface{}{"Ada Lovelace"}, "/users/Ada%20Lovelace", ""},
+		{"post", []interface{}{"ada"}, "", "missing value for {slug:[a-z-]+}"},
+		{"missing", nil, "", "no route named missing"},
+	}
+
+	for _, tt := range tests {
+		path, err := ras.Route(tt.name, tt.params...)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s %v: expected an error containing %q, got %v", tt.name, tt.params, tt.err, err)
+			}
+			continue
+		}
+		if err != nil || path != tt.path {
+			t.Errorf("%s %v: expected %s, got %s %v", tt.name, tt.params, tt.path, path, err)
+		}
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	views := fstest.MapFS{
+		"funcs.jet": {Data: []byte(`<body {{ hx_headers(.) | raw }}><form action="{{ route("user", .Data["id"]) }}">{{ csrf_field(.) | raw }}</form></body>`)},
+		"funcs.page.tmpl": {Data: []byte(`<body {{ hx_headers . }}><form action="{{ route "user" (index .Data "id") }}">{{ csrf_field . }}</form></body>`)},
+	}
+
+	loader, err := httpfs.NewLoader(http.FS(views))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ras := &Rasant{ErrorLog: log.New(io.Discard, "", 0)}
+	ras.Render = &render.Render{JetViews: jet.NewSet(loader), FS: views}
+	ras.registerTemplateFuncs()
+	ras.NameRoute("user", "/users/{id}")
+
+	td := &render.TemplateData{
+		CSRFToken: `a"b<c>'d`,
+		Data: map[string]interface{}{"id": "a b"},
+	}
+
+	want := `<body hx-headers='{&#34;X-CSRF-Token&#34;:&#34;a\&#34;b\u003cc\u003e&#39;d&#34;}'>` +
+		`<form action="/users/a%20b">` +
+		`<input type="hidden" name="csrf_token" value="a&#34;b&lt;c&gt;&#39;d"></form></body>`
+
+	for _, renderer := range []string{"jet", "go"} {
+		ras.Render.Renderer = renderer
+
+		s, err := ras.Render.ToString("funcs", nil, td)
+		if err != nil {
+			t.Fatal(renderer, err)
+		}
+		if s != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", renderer, want, s)
+		}
+	}
+}
@@ -17,6 +17,11 @@ type cookieConfig struct {
 	persist string
 	secure string
 	domain string
+	sameSite string
+	path string
+	httpOnly string
+	partitioned string
+	idleTimeout string
 }
 
 type databaseConfig struct {
@@ -29,8 +34,17 @@ type Database struct {
 	Pool *sql.DB
 }
 
+// redisConfig holds redis connection settings. sentinels and cluster are comma separated
+// lists of host:port addresses; when either is set, host is not used.
 type redisConfig struct {
 	host string
 	password string
 	prefix string
+	database string
+	tls string
+	tlsSkipVerify string
+	sentinels string
+	sentinelMaster string
+	sentinelPassword string
+	cluster string
 }
\ No newline at end of file
@@ -0,0 +1,309 @@
+package rasant
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+// defaultMaxUpload is the size limit of uploads whose options do not set one
+const defaultMaxUpload = 10 << 20
+
+// maxUploadValues limits the size of the other form values read along with an upload
+const maxUploadValues = 1 << 20
+
+var (
+	// ErrNoUpload means the request has no file in the field
+	ErrNoUpload = errors.New("upload: no file uploaded")
+	// ErrUploadTooLarge means the file is larger than UploadOptions.MaxSize
+	ErrUploadTooLarge = errors.New("upload: file is too large")
+	// ErrUploadType means the file's content is not one of UploadOptions.AllowedTypes
+	ErrUploadType = errors.New("upload: file type not allowed")
+)
+
+// UploadOptions configure UploadFile
+type UploadOptions struct {
+	// MaxSize is the largest file accepted, in bytes; 10MB when 0
+	MaxSize int64
+	// AllowedTypes are the MIME types accepted, such as image/png, or image/* for any image.
+	// Any type is accepted when it is empty.
+	AllowedTypes []string
+	// FileSystem is the name of the entry in FileSystems that stores the file, such as MINIO.
+	// The file is stored on local disk when it is empty.
+	FileSystem string
+}
+
+// UploadedFile describes a file stored by UploadFile
+type UploadedFile struct {
+	// Name is the random name the file was stored under
+	Name string
+	// OriginalName is the name the file had on the user's computer; never use it as a path
+	OriginalName string
+	// Path is the path of the file on local disk, or its key on the file system
+	Path string
+	Size int64
+	// ContentType is the MIME type detected from the file's content
+	ContentType string
+}
+
+// UploadFile stores the file uploaded in field of the multipart request r in the folder
+// destination, under a random name. The file is streamed to its destination as it arrives,
+// without a temporary copy, and its type is detected from its first bytes rather than taken
+// from the browser. Files that are too large or not of an allowed type are rejected with
+// ErrUploadTooLarge or ErrUploadType, and nothing is left behind.
+//
+// UploadFile reads the request body itself, so r must not have been parsed with ParseForm or
+// ParseMultipartForm. The other values of the form are available in r.Form afterwards.
+func (ras *Rasant) UploadFile(r *http.Request, field, destination string, opts UploadOptions) (*UploadedFile, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxUpload
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("upload: %w", err)
+	}
+
+	values := make(url.Values)
+	var uploaded *UploadedFile
+	var valuesSize int64
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ras.removeUpload(uploaded, opts)
+			return nil, fmt.Errorf("upload: %w", err)
+		}
+
+		switch {
+		case part.FileName() == "":
+			// keep the other values of the form, within reason
+			value, err := io.ReadAll(io.LimitReader(part, maxUploadValues-valuesSize+1))
+			valuesSize += int64(len(value))
+			if err == nil && valuesSize > maxUploadValues {
+				err = errors.New("too many form values")
+			}
+			if err != nil {
+				ras.removeUpload(uploaded, opts)
+				return nil, fmt.Errorf("upload: %w", err)
+			}
+			values.Add(part.FormName(), string(value))
+		case part.FormName() == field && uploaded == nil:
+			uploaded, err = ras.storeUpload(r, part.FileName(), part, destination, opts)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		part.Close()
+	}
+
+	r.Form = values
+	r.PostForm = values
+
+	if uploaded == nil {
+		return nil, ErrNoUpload
+	}
+
+	return uploaded, nil
+}
+
+// storeUpload checks the type of the file read from src, and streams it to destination
+func (ras *Rasant) storeUpload(r *http.Request, fileName string, src io.Reader, destination string, opts UploadOptions) (*UploadedFile, error) {
+	limited := &limitReader{r: src, remaining: opts.MaxSize}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(limited, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, uploadError(err)
+	}
+	head = head[:n]
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if len(opts.AllowedTypes) > 0 && !typeAllowed(contentType, opts.AllowedTypes) {
+		return nil, ErrUploadType
+	}
+
+	name, err := randomFileName(fileName, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	uploaded := &UploadedFile{
+		Name: name,
+		OriginalName: filepath.Base(fileName),
+		ContentType: contentType,
+	}
+
+	body := io.MultiReader(bytes.NewReader(head), limited)
+
+	if opts.FileSystem == "" {
+		uploaded.Path = filepath.Join(destination, name)
+		err = writeLocalFile(uploaded.Path, body)
+	} else {
+		uploaded.Path = path.Join(destination, name)
+		err = ras.createRemoteFile(r, opts.FileSystem, uploaded.Path, contentType, opts.MaxSize, body)
+	}
+
+	if err != nil {
+		return nil, uploadError(err)
+	}
+
+	uploaded.Size = opts.MaxSize - limited.remaining
+	return uploaded, nil
+}
+
+func writeLocalFile(name string, src io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	// O_EXCL, so that an upload never replaces an existing file
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(f, src); err != nil {
+		f.Close()
+		_ = os.Remove(name)
+		return err
+	}
+
+	return f.Close()
+}
+
+// createRemoteFile streams src to key on fileSystem. Its size is not known until it has all
+// been read, so maxSize is passed on as an upper bound.
+func (ras *Rasant) createRemoteFile(r *http.Request, fileSystem, key, contentType string, maxSize int64, src io.Reader) error {
+	var creator filesystems.Creator
+	creator, ok := ras.Storage(fileSystem)
+	if !ok {
+		creator, ok = ras.FileSystems[fileSystem].(filesystems.Creator)
+	}
+	if !ok {
+		return fmt.Errorf("file system %s cannot store streamed files", fileSystem)
+	}
+
+	// an upload that is stored before the rest of the request fails must be removed again
+	if _, ok := ras.Storage(fileSystem); !ok {
+		if _, ok := ras.FileSystems[fileSystem].(filesystems.FS); !ok {
+			return fmt.Errorf("file system %s cannot delete files", fileSystem)
+		}
+	}
+
+	return creator.Create(r.Context(), key, src, filesystems.CreateOptions{
+		ContentType: contentType,
+		Size: -1,
+		MaxSize: maxSize,
+	})
+}
+
+// removeUpload deletes an upload that was stored before the rest of the request failed
+func (ras *Rasant) removeUpload(uploaded *UploadedFile, opts UploadOptions) {
+	if uploaded == nil || uploaded.Path == "" {
+		return
+	}
+
+	if opts.FileSystem == "" {
+		_ = os.Remove(uploaded.Path)
+		return
+	}
+
+	if storage, ok := ras.Storage(opts.FileSystem); ok {
+		_ = storage.Delete(context.Background(), uploaded.Path)
+		return
+	}
+
+	if fsys, ok := ras.FileSystems[opts.FileSystem].(filesystems.FS); ok {
+		fsys.Delete([]string{uploaded.Path})
+	}
+}
+
+// uploadError turns the error of a reader that went over the size limit into
+// ErrUploadTooLarge
+func uploadError(err error) error {
+	if errors.Is(err, ErrUploadTooLarge) {
+		return ErrUploadTooLarge
+	}
+	return fmt.Errorf("upload: %w", err)
+}
+
+// limitReader reads from r until remaining bytes have been read, and fails with
+// ErrUploadTooLarge if there is more
+type limitReader struct {
+	r io.Reader
+	remaining int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrUploadTooLarge
+	}
+
+	// read one byte more than allowed, to tell a file of exactly the limit from a larger one
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrUploadTooLarge
+	}
+	return n, err
+}
+
+// safeExtension matches the extensions kept from the names of uploaded files
+var safeExtension = regexp.MustCompile(`^\.[a-z0-9]{1,10}$`)
+
+// preferredExtensions are the extensions given to common types; for other types the first
+// extension known to the mime package is used
+var preferredExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png": ".png",
+	"image/gif": ".gif",
+	"image/webp": ".webp",
+	"application/pdf": ".pdf",
+	"application/zip": ".zip",
+	"text/plain": ".txt",
+}
+
+// randomFileName returns a random name for an upload of contentType. The extension of the
+// original name is kept only if it fits the content, so that an upload cannot choose how it
+// is served later.
+func randomFileName(original, contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	ext := strings.ToLower(filepath.Ext(original))
+	if extType, _, _ := mime.ParseMediaType(mime.TypeByExtension(ext)); !safeExtension.MatchString(ext) || extType != contentType {
+		ext = preferredExtensions[contentType]
+		if ext == "" {
+			if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+				ext = exts[0]
+			}
+		}
+	}
+
+	return hex.EncodeToString(b) + ext, nil
+}
@@ -0,0 +1,323 @@
+package rasant
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shaynemeyer/rasant/filesystems"
+)
+
+// pngHeader is enough of a PNG file for its type to be detected
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// pngFile returns a PNG file of size bytes
+func pngFile(size int) []byte {
+	b := make([]byte, size)
+	copy(b, pngHeader)
+	return b
+}
+
+// memStorage keeps files in memory, and remembers the options of the last Create
+type memStorage struct {
+	files map[string][]byte
+	opts filesystems.CreateOptions
+}
+
+func (m *memStorage) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	m.opts = opts
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m.files[key] = b
+	return nil
+}
+
+func (m *memStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	b, ok := m.files[key]
+	if !ok {
+		return nil, filesystems.ErrNotExist
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memStorage) Stat(ctx context.Context, key string) (filesystems.FileInfo, error) {
+	b, ok := m.files[key]
+	if !ok {
+		return filesystems.FileInfo{}, filesystems.ErrNotExist
+	}
+	return filesystems.FileInfo{Key: key, Size: int64(len(b))}, nil
+}
+
+func (m *memStorage) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := m.files[key]
+	return ok, nil
+}
+
+func (m *memStorage) Copy(ctx context.Context, src, dst string) error {
+	return filesystems.CopyStream(ctx, m, src, dst)
+}
+
+func (m *memStorage) Move(ctx context.Context, src, dst string) error {
+	return filesystems.MoveByCopy(ctx, m, src, dst)
+}
+
+func (m *memStorage) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		delete(m.files, key)
+	}
+	return nil
+}
+
+func (m *memStorage) List(ctx context.Context, prefix string) ([]filesystems.FileInfo, error) {
+	var files []filesystems.FileInfo
+	for key, b := range m.files {
+		if strings.HasPrefix(key, prefix) {
+			files = append(files, filesystems.FileInfo{Key: key, Size: int64(len(b))})
+		}
+	}
+	return files, nil
+}
+
+// memProvider is kept in FileSystems the way the drivers are, as a value providing a Storage
+type memProvider struct {
+	storage *memStorage
+}
+
+func (p memProvider) Storage() filesystems.Storage {
+	return p.storage
+}
+
+// uploadRequest returns a multipart request with a title value and content in the file field
+func uploadRequest(t *testing.T, fileName string, content []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("title", "holiday"); err != nil {
+		t.Fatal(err)
+	}
+	part, err := w.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	w.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+	return r
+}
+
+func TestUploadFile_Local(t *testing.T) {
+	ras := &Rasant{}
+	dir := t.TempDir()
+	content := pngFile(1000)
+
+	uploaded, err := ras.UploadFile(uploadRequest(t, "../../photo.PNG", content), "file", dir, UploadOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded.OriginalName != "photo.PNG" || uploaded.ContentType != "image/png" || uploaded.Size != int64(len(content)) {
+		t.Errorf("wrong upload: %+v", uploaded)
+	}
+	if filepath.Dir(uploaded.Path) != dir || filepath.Ext(uploaded.Name) != ".png" {
+		t.Errorf("wrong path %s", uploaded.Path)
+	}
+
+	b, err := os.ReadFile(uploaded.Path)
+	if err != nil || !bytes.Equal(b, content) {
+		t.Errorf("wrong content stored, %v", err)
+	}
+}
+
+func TestUploadFile_Storage(t *testing.T) {
+	storage := &memStorage{files: make(map[string][]byte)}
+	ras := &Rasant{FileSystems: map[string]interface{}{"MEM": memProvider{storage}}}
+	content := pngFile(1000)
+
+	r := uploadRequest(t, "photo.png", content)
+	uploaded, err := ras.UploadFile(r, "file", "avatars", UploadOptions{MaxSize: 2000, FileSystem: "MEM"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(uploaded.Path, "avatars/") || uploaded.Size != int64(len(content)) {
+		t.Errorf("wrong upload: %+v", uploaded)
+	}
+	if !bytes.Equal(storage.files[uploaded.Path], content) {
+		t.Error("wrong content stored")
+	}
+
+	// the size is not known while streaming, so the limit is passed on as an upper bound
+	if storage.opts.Size != -1 || storage.opts.MaxSize != 2000 || storage.opts.ContentType != "image/png" {
+		t.Errorf("wrong create options: %+v", storage.opts)
+	}
+
+	if r.Form.Get("title") != "holiday" {
+		t.Errorf("expected the other form values to be kept, got %v", r.Form)
+	}
+
+	if _, err = ras.UploadFile(uploadRequest(t, "a.png", content), "file", "avatars", UploadOptions{FileSystem: "MISSING"}); err == nil {
+		t.Error("expected an unknown file system to fail")
+	}
+}
+
+func TestUploadFile_MaxSize(t *testing.T) {
+	storage := &memStorage{files: make(map[string][]byte)}
+	ras := &Rasant{FileSystems: map[string]interface{}{"MEM": memProvider{storage}}}
+	dir := t.TempDir()
+
+	tests := []struct {
+		size int
+		fileSystem string
+		err error
+	}{
+		{100, "", nil},
+		{101, "", ErrUploadTooLarge},
+		{100, "MEM", nil},
+		{101, "MEM", ErrUploadTooLarge},
+		// larger than the bytes read to detect the type
+		{1000, "", ErrUploadTooLarge},
+		{1000, "MEM", ErrUploadTooLarge},
+	}
+
+	for _, tt := range tests {
+		content := pngFile(tt.size)
+		r := uploadRequest(t, "photo.png", content)
+
+		_, err := ras.UploadFile(r, "file", dir, UploadOptions{MaxSize: 100, FileSystem: tt.fileSystem})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%d bytes to %q: expected %v, got %v", tt.size, tt.fileSystem, tt.err, err)
+		}
+	}
+
+	// nothing is left of the files that were too large
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || len(storage.files) != 1 {
+		t.Errorf("expected only the files within the limit to be stored, got %d and %d", len(entries), len(storage.files))
+	}
+}
+
+func TestUploadFile_AllowedTypes(t *testing.T) {
+	ras := &Rasant{}
+	dir := t.TempDir()
+
+	tests := []struct {
+		content []byte
+		allowed []string
+		err error
+	}{
+		{pngHeader, []string{"image/png"}, nil},
+		{pngHeader, []string{"image/*"}, nil},
+		{pngHeader, []string{"image/jpeg", "application/pdf"}, ErrUploadType},
+		// the name does not decide the type, the content does
+		{[]byte("<html><script>alert(1)</script>"), []string{"image/*"}, ErrUploadType},
+		{[]byte("plain text"), nil, nil},
+	}
+
+	for _, tt := range tests {
+		uploaded, err := ras.UploadFile(uploadRequest(t, "photo.png", tt.content), "file", dir, UploadOptions{AllowedTypes: tt.allowed})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v: expected %v, got %v", tt.allowed, tt.err, err)
+		}
+		if err == nil && uploaded.ContentType == "text/plain" && filepath.Ext(uploaded.Name) != ".txt" {
+			t.Errorf("expected a text file not to keep the .png extension, got %s", uploaded.Name)
+		}
+	}
+
+	if _, err := ras.UploadFile(uploadRequest(t, "photo.png", pngHeader), "other", dir, UploadOptions{}); !errors.Is(err, ErrNoUpload) {
+		t.Errorf("expected ErrNoUpload for a missing field, got %v", err)
+	}
+}
+
+// legacyFS is a file system that streams files but only has the older FS interface
+type legacyFS struct {
+	files map[string][]byte
+}
+
+func (l *legacyFS) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	l.files[key] = b
+	return nil
+}
+
+func (l *legacyFS) Put(fileName, folder string) error { return nil }
+
+func (l *legacyFS) Get(destination string, items ...string) error { return nil }
+
+func (l *legacyFS) List(prefix string) ([]filesystems.Listing, error) { return nil, nil }
+
+func (l *legacyFS) Delete(itemsToDelete []string) bool {
+	for _, key := range itemsToDelete {
+		delete(l.files, key)
+	}
+	return true
+}
+
+// createOnly can store files, but not delete them
+type createOnly struct {
+	files map[string][]byte
+}
+
+func (c *createOnly) Create(ctx context.Context, key string, r io.Reader, opts filesystems.CreateOptions) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	c.files[key] = b
+	return nil
+}
+
+func TestUploadFile_RemovedOnFailure(t *testing.T) {
+	// the file comes first, then more form values than are kept
+	request := func() *http.Request {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		part, _ := w.CreateFormFile("file", "photo.png")
+		part.Write(pngHeader)
+		_ = w.WriteField("notes", strings.Repeat("x", maxUploadValues+1))
+		w.Close()
+
+		r := httptest.NewRequest(http.MethodPost, "/upload", &body)
+		r.Header.Set("Content-Type", w.FormDataContentType())
+		return r
+	}
+
+	storage := &memStorage{files: make(map[string][]byte)}
+	legacy := &legacyFS{files: make(map[string][]byte)}
+	ras := &Rasant{FileSystems: map[string]interface{}{
+		"MEM": memProvider{storage},
+		"LEGACY": legacy,
+		"CREATE": &createOnly{files: make(map[string][]byte)},
+	}}
+
+	for _, fileSystem := range []string{"MEM", "LEGACY"} {
+		if _, err := ras.UploadFile(request(), "file", "uploads", UploadOptions{FileSystem: fileSystem}); err == nil {
+			t.Errorf("%s: expected too many form values to fail", fileSystem)
+		}
+	}
+	if len(storage.files) != 0 || len(legacy.files) != 0 {
+		t.Errorf("expected the stored files to be removed, got %v %v", storage.files, legacy.files)
+	}
+
+	// a file system that could not remove the file is refused before anything is stored
+	create := ras.FileSystems["CREATE"].(*createOnly)
+	_, err := ras.UploadFile(uploadRequest(t, "photo.png", pngHeader), "file", "uploads", UploadOptions{FileSystem: "CREATE"})
+	if err == nil || !strings.Contains(err.Error(), "cannot delete files") || len(create.files) != 0 {
+		t.Errorf("expected a file system that cannot delete to be refused, got %v %v", err, create.files)
+	}
+}
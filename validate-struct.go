@@ -0,0 +1,605 @@
+package rasant
+
+import (
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// ruleField is the field a rule checks
+type ruleField struct {
+	// value is the field's value; pointers are followed, except for required
+	value reflect.Value
+	// param is the text after = in the tag
+	param string
+	// parent is the struct holding the field, and name the field's name in it
+	parent reflect.Value
+	name string
+}
+
+// fieldRule checks a field. It returns the error message for an invalid value, or an empty
+// string. An error means the tag itself is wrong.
+type fieldRule func(v *Validation, f ruleField) (string, error)
+
+// structRules are the rules ValidateStruct understands, by tag name
+var structRules map[string]fieldRule
+
+func init() {
+	structRules = map[string]fieldRule{
+		"required": ruleRequired,
+		"email": ruleEmail,
+		"min": ruleMin,
+		"max": ruleMax,
+		"len": ruleLen,
+		"oneof": ruleOneOf,
+		"url": ruleURL,
+		"uuid": ruleUUID,
+		"phone": rulePhone,
+		"password": rulePassword,
+		"regexp": ruleRegexp,
+		"confirmed": ruleConfirmed,
+		"after": ruleAfter,
+		"before": ruleBefore,
+		"filesize": ruleFileSize,
+		"filetype": ruleFileType,
+		"unique": ruleUnique,
+		"exists": ruleExists,
+	}
+}
+
+// ValidateStruct checks the fields of s, a struct or a pointer to one, against their validate
+// tags, adding an error to v for every invalid field:
+//
+//	type Signup struct {
+//		Email string   `json:"email" validate:"required,email"`
+//		Name  string   `json:"name" validate:"required,min=3,max=64"`
+//		Plan  string   `json:"plan" validate:"oneof=free pro"`
+//		Tags  []string `json:"tags" validate:"max=5"`
+//	}
+//
+// The rules are
+//
+//	required          not empty, zero or nil
+//	omitempty         skips the other rules when the field is empty, zero or nil
+//	email, url, uuid, phone
+//	min=n, max=n, len=n  the length of strings, the number of items of slices and maps, or
+//	                  the value of numbers
+//	oneof=a b         one of the space separated values
+//	regexp=pattern    matches pattern, which cannot contain commas
+//	password          a strong password (see IsStrongPassword)
+//	confirmed         equal to the field named <name>_confirmation, or <Name>Confirmation
+//	after=YYYY-MM-DD, before=YYYY-MM-DD  a time.Time or YYYY-MM-DD string in the range
+//	filesize=2MB      a *multipart.FileHeader no larger than the size
+//	filetype=image/*  a *multipart.FileHeader with content of one of the space separated types
+//	unique=table.column, exists=table.column  see Unique and Exists
+//
+// Errors are keyed by the form tag of the field, or its json tag, or else its name, the same
+// names Bind reads form values by. Fields of nested structs, and of structs in slices, are
+// validated too, and keyed by their path, such as address.city or items.0.name. Rules other
+// than required pass empty strings and nil pointers, so optional fields can have rules.
+//
+// The error is not a validation failure, but a tag ValidateStruct does not understand.
+func (v *Validation) ValidateStruct(s interface{}) error {
+	value := reflect.ValueOf(s)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return fmt.Errorf("validate: nil %s", value.Type())
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %s is not a struct", value.Type())
+	}
+
+	return v.validateStruct(value, "")
+}
+
+func (v *Validation) validateStruct(value reflect.Value, prefix string) error {
+	t := value.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// unexported
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+
+		fieldValue := value.Field(i)
+
+		// the fields of embedded structs belong to the outer struct
+		if field.Anonymous && tag == "" {
+			if embedded, ok := structValue(fieldValue); ok {
+				if err := v.validateStruct(embedded, prefix); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		name := prefix + fieldName(field)
+
+		if tag != "" {
+			if err := v.validateField(name, fieldValue, tag, value, fieldName(field)); err != nil {
+				return fmt.Errorf("validate: field %s: %w", field.Name, err)
+			}
+		}
+
+		if err := v.validateNested(fieldValue, name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateNested validates the structs held by value, which is named name
+func (v *Validation) validateNested(value reflect.Value, name string) error {
+	if nested, ok := structValue(value); ok {
+		return v.validateStruct(nested, name+".")
+	}
+
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	if value.Kind() == reflect.Slice || value.Kind() == reflect.Array {
+		for i := 0; i < value.Len(); i++ {
+			if err := v.validateNested(value.Index(i), fmt.Sprintf("%s.%d", name, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateField applies the comma separated rules in tag to value, which is the field called
+// fieldName of parent, reporting errors under name
+func (v *Validation) validateField(name string, value reflect.Value, tag string, parent reflect.Value, fieldName string) error {
+	for _, r := range strings.Split(tag, ",") {
+		ruleName, param := r, ""
+		if i := strings.Index(r, "="); i >= 0 {
+			ruleName, param = r[:i], r[i+1:]
+		}
+		ruleName = strings.TrimSpace(ruleName)
+
+		if ruleName == "" {
+			continue
+		}
+
+		if ruleName == "omitempty" {
+			if blank, _ := ruleRequired(v, ruleField{value: value}); blank != "" {
+				return nil
+			}
+			continue
+		}
+
+		rule, ok := structRules[ruleName]
+		if !ok {
+			return fmt.Errorf("unknown rule %s", ruleName)
+		}
+
+		if ruleName != "required" && isBlank(value) {
+			continue
+		}
+
+		// required needs to see pointers; the other rules look at what they point to
+		target := indirect(value)
+		if ruleName == "required" {
+			target = value
+		}
+
+		message, err := rule(v, ruleField{value: target, param: param, parent: parent, name: fieldName})
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", ruleName, err)
+		}
+
+		if message != "" {
+			v.AddError(name, message)
+			// one message per field is enough
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// fieldName is the name of a field in a form, and the name its errors are reported under:
+// its form tag, or else its json tag, or else its Go name
+func fieldName(field reflect.StructField) string {
+	for _, key := range []string{"form", "json"} {
+		name := strings.Split(field.Tag.Get(key), ",")[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// structValue returns the struct that value holds, following pointers
+func structValue(value reflect.Value) (reflect.Value, bool) {
+	value = indirect(value)
+	// time.Time and other structs without exported fields are values, not forms
+	if value.Kind() != reflect.Struct || !hasExportedField(value.Type()) {
+		return value, false
+	}
+	return value, true
+}
+
+func hasExportedField(t reflect.Type) bool {
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// indirect follows pointers and interfaces, stopping at nil
+func indirect(value reflect.Value) reflect.Value {
+	for (value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface) && !value.IsNil() {
+		value = value.Elem()
+	}
+	return value
+}
+
+// isBlank reports whether value is an empty string or nil
+func isBlank(value reflect.Value) bool {
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return value.IsNil()
+	case reflect.String:
+		return value.String() == ""
+	case reflect.Invalid:
+		return true
+	}
+	return false
+}
+
+// measure kinds tell apart what a size rule compared
+const (
+	measureNumber = iota
+	measureLength
+	measureItems
+)
+
+// size returns the number a size rule compares: the length of strings (in characters), the
+// number of items in slices and maps, or the value of numbers
+func size(value reflect.Value) (float64, int, error) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), measureLength, nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), measureItems, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), measureNumber, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), measureNumber, nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), measureNumber, nil
+	}
+	return 0, 0, fmt.Errorf("cannot measure a %s", value.Kind())
+}
+
+// valueString formats a string, number or bool. Unlike fmt.Sprint(value.Interface()), it
+// works for fields promoted from unexported embedded structs.
+func valueString(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return value.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(value.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(value.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(value.Float(), 'f', -1, 64)
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	}
+	return ""
+}
+
+func ruleRequired(v *Validation, f ruleField) (string, error) {
+	value := f.value
+	var blank bool
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		// a pointer tells a zero value that was given apart from one that was left out
+		blank = value.IsNil() || (value.Elem().Kind() == reflect.String && strings.TrimSpace(value.Elem().String()) == "")
+	case reflect.String:
+		blank = strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		blank = value.Len() == 0
+	case reflect.Invalid:
+		blank = true
+	default:
+		blank = value.IsZero()
+	}
+
+	if blank {
+		return v.message("required", "This field cannot be blank"), nil
+	}
+	return "", nil
+}
+
+// stringRule returns a rule for strings that checks them with ok
+func stringRule(key, fallback string, ok func(string) bool) fieldRule {
+	return func(v *Validation, f ruleField) (string, error) {
+		if f.value.Kind() != reflect.String {
+			return "", fmt.Errorf("cannot check a %s", f.value.Kind())
+		}
+		if !ok(f.value.String()) {
+			return v.message(key, fallback), nil
+		}
+		return "", nil
+	}
+}
+
+var (
+	ruleEmail = stringRule("email", "Invalid email address", govalidator.IsEmail)
+	ruleURL = stringRule("url", "Invalid URL", isURL)
+	ruleUUID = stringRule("uuid", "Invalid UUID", govalidator.IsUUID)
+	rulePhone = stringRule("phone", "Invalid phone number", isPhone)
+)
+
+func rulePassword(v *Validation, f ruleField) (string, error) {
+	if f.value.Kind() != reflect.String {
+		return "", fmt.Errorf("cannot check a %s", f.value.Kind())
+	}
+	if !isStrongPassword(f.value.String()) {
+		return v.passwordMessage(), nil
+	}
+	return "", nil
+}
+
+func ruleRegexp(v *Validation, f ruleField) (string, error) {
+	re, err := compileRule(f.param)
+	if err != nil {
+		return "", err
+	}
+	if !re.MatchString(valueString(f.value)) {
+		return v.message("regexp", "This field is not in the right format"), nil
+	}
+	return "", nil
+}
+
+// ruleRegexps caches the patterns of regexp rules, which are compiled once
+var ruleRegexps sync.Map
+
+func compileRule(pattern string) (*regexp.Regexp, error) {
+	if re, ok := ruleRegexps.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	ruleRegexps.Store(pattern, re)
+	return re, nil
+}
+
+func ruleConfirmed(v *Validation, f ruleField) (string, error) {
+	confirmation, ok := siblingField(f.parent, f.name+"_confirmation", f.name+"Confirmation")
+	if !ok {
+		return "", fmt.Errorf("no %s_confirmation field", f.name)
+	}
+
+	if valueString(f.value) != valueString(indirect(confirmation)) {
+		return v.message("confirmed", "The confirmation does not match"), nil
+	}
+	return "", nil
+}
+
+// siblingField finds the field of parent whose name (see fieldName), or Go name, is one of
+// names
+func siblingField(parent reflect.Value, names ...string) (reflect.Value, bool) {
+	t := parent.Type()
+	for i := 0; i < t.NumField(); i++ {
+		for _, name := range names {
+			if fieldName(t.Field(i)) == name || strings.EqualFold(t.Field(i).Name, name) {
+				return parent.Field(i), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+func ruleAfter(v *Validation, f ruleField) (string, error) {
+	return compareDate(v, f, true)
+}
+
+func ruleBefore(v *Validation, f ruleField) (string, error) {
+	return compareDate(v, f, false)
+}
+
+// compareDate checks that a time.Time or YYYY-MM-DD string is on or after (or before) the
+// date in the rule's parameter
+func compareDate(v *Validation, f ruleField, after bool) (string, error) {
+	limit, err := time.Parse("2006-01-02", f.param)
+	if err != nil {
+		return "", err
+	}
+
+	var date time.Time
+	switch value := f.value; {
+	case value.Type() == reflect.TypeOf(time.Time{}) && value.CanInterface():
+		date = value.Interface().(time.Time)
+	case value.Kind() == reflect.String:
+		if date, err = time.Parse("2006-01-02", value.String()); err != nil {
+			return v.message("date_iso", "This field must be a date in the form of YYYY-MM-DD"), nil
+		}
+	default:
+		return "", fmt.Errorf("cannot check a %s", value.Type())
+	}
+
+	if after {
+		return v.dateRange(date, limit, time.Time{}), nil
+	}
+	return v.dateRange(date, time.Time{}, limit), nil
+}
+
+// fileHeader returns the upload that value holds
+func fileHeader(value reflect.Value) (*multipart.FileHeader, error) {
+	if value.Kind() == reflect.Struct && value.CanAddr() {
+		value = value.Addr()
+	}
+	if !value.CanInterface() {
+		return nil, fmt.Errorf("cannot check a %s", value.Type())
+	}
+
+	file, ok := value.Interface().(*multipart.FileHeader)
+	if !ok {
+		return nil, fmt.Errorf("cannot check a %s", value.Type())
+	}
+	return file, nil
+}
+
+func ruleFileSize(v *Validation, f ruleField) (string, error) {
+	max, err := parseSize(f.param)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := fileHeader(f.value)
+	if err != nil {
+		return "", err
+	}
+
+	if file.Size > max {
+		return v.fileSizeMessage(max), nil
+	}
+	return "", nil
+}
+
+func ruleFileType(v *Validation, f ruleField) (string, error) {
+	file, err := fileHeader(f.value)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType, err := fileType(file)
+	if err != nil {
+		return "", err
+	}
+
+	if types := strings.Fields(f.param); !typeAllowed(mimeType, types) {
+		return v.fileTypeMessage(types), nil
+	}
+	return "", nil
+}
+
+func ruleUnique(v *Validation, f ruleField) (string, error) {
+	count, err := countParam(v, f)
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return v.uniqueMessage(), nil
+}
+
+func ruleExists(v *Validation, f ruleField) (string, error) {
+	count, err := countParam(v, f)
+	if err != nil || count > 0 {
+		return "", err
+	}
+	return v.existsMessage(), nil
+}
+
+// countParam counts the rows holding the field's value in the table.column of the rule's
+// parameter
+func countParam(v *Validation, f ruleField) (int, error) {
+	i := strings.LastIndex(f.param, ".")
+	if i < 0 {
+		return 0, fmt.Errorf("%q is not table.column", f.param)
+	}
+	return v.countRows(f.param[:i], f.param[i+1:], valueString(f.value))
+}
+
+func ruleMin(v *Validation, f ruleField) (string, error) {
+	return compareSize(v, f.value, f.param, "min", func(n, limit float64) bool { return n >= limit })
+}
+
+func ruleMax(v *Validation, f ruleField) (string, error) {
+	return compareSize(v, f.value, f.param, "max", func(n, limit float64) bool { return n <= limit })
+}
+
+func ruleLen(v *Validation, f ruleField) (string, error) {
+	return compareSize(v, f.value, f.param, "len", func(n, limit float64) bool { return n == limit })
+}
+
+// sizeMessages are the messages of the size rules, by rule and by what was measured
+var sizeMessages = map[string][3]string{
+	"min": {
+		"This field must be at least {min}",
+		"This field must be at least {min} characters long",
+		"This field must have at least {min} items",
+	},
+	"max": {
+		"This field must be at most {max}",
+		"This field must be at most {max} characters long",
+		"This field must have at most {max} items",
+	},
+	"len": {
+		"This field must be {len}",
+		"This field must be exactly {len} characters long",
+		"This field must have exactly {len} items",
+	},
+}
+
+// sizeKeys are the translation keys of sizeMessages, after the rule's name
+var sizeKeys = [3]string{"", "_length", "_items"}
+
+// compareSize checks the size of value against param with ok
+func compareSize(v *Validation, value reflect.Value, param, rule string, ok func(n, limit float64) bool) (string, error) {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a number", param)
+	}
+
+	n, measure, err := size(value)
+	if err != nil {
+		return "", err
+	}
+
+	if ok(n, limit) {
+		return "", nil
+	}
+
+	return v.message(rule+sizeKeys[measure], sizeMessages[rule][measure], rule, param), nil
+}
+
+func ruleOneOf(v *Validation, f ruleField) (string, error) {
+	value := f.value
+	options := strings.Fields(f.param)
+	if len(options) == 0 {
+		return "", fmt.Errorf("no options")
+	}
+
+	s := valueString(value)
+	for _, option := range options {
+		if s == option {
+			return "", nil
+		}
+	}
+
+	return v.message("oneof", "This field must be one of {options}", "options", strings.Join(options, ", ")), nil
+}
@@ -0,0 +1,222 @@
+package rasant
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func validateStruct(t *testing.T, s interface{}) map[string]string {
+	t.Helper()
+
+	v := (&Rasant{}).Validator(url.Values{})
+	if err := v.ValidateStruct(s); err != nil {
+		t.Fatal(err)
+	}
+	return v.Errors
+}
+
+func TestValidateStruct_Rules(t *testing.T) {
+	type rules struct {
+		Name string `validate:"required,min=3,max=8"`
+		Code string `validate:"len=4"`
+		Age int `validate:"min=18"`
+		Tags []string `validate:"max=2"`
+		Plan string `validate:"oneof=free pro"`
+		Email string `validate:"email"`
+		Site string `validate:"url"`
+		Slug string `validate:"regexp=^[a-z]+$"`
+		// the zero time is not blank, but omitempty skips it
+		Start time.Time `validate:"omitempty,after=2020-01-01"`
+		End string `validate:"before=2020-01-01"`
+	}
+
+	tests := []struct {
+		name string
+		s rules
+		errors map[string]string
+	}{
+		{"valid", rules{Name: "Ada", Age: 18, Plan: "pro", Start: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}, nil},
+		{"required", rules{Name: "  "}, map[string]string{"Name": "This field cannot be blank"}},
+		{"min length", rules{Name: "Al"}, map[string]string{"Name": "This field must be at least 3 characters long"}},
+		// the length is counted in characters, not bytes
+		{"max length", rules{Name: "Ådåøüéî"}, nil},
+		{"len", rules{Name: "Ada", Code: "12345"}, map[string]string{"Code": "This field must be exactly 4 characters long"}},
+		{"min number", rules{Name: "Ada", Age: 17}, map[string]string{"Age": "This field must be at least 18"}},
+		{"max items", rules{Name: "Ada", Tags: []string{"a", "b", "c"}}, map[string]string{"Tags": "This field must have at most 2 items"}},
+		{"oneof", rules{Name: "Ada", Plan: "gold"}, map[string]string{"Plan": "This field must be one of free, pro"}},
+		{"email", rules{Name: "Ada", Email: "ada"}, map[string]string{"Email": "Invalid email address"}},
+		{"url", rules{Name: "Ada", Site: "not a url"}, map[string]string{"Site": "Invalid URL"}},
+		{"regexp", rules{Name: "Ada", Slug: "Ada"}, map[string]string{"Slug": "This field is not in the right format"}},
+		{"after", rules{Name: "Ada", Start: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)}, map[string]string{"Start": "This field must be a date on or after 2020-01-01"}},
+		{"before", rules{Name: "Ada", End: "2021-01-01"}, map[string]string{"End": "This field must be a date on or before 2020-01-01"}},
+		{"not a date", rules{Name: "Ada", End: "soon"}, map[string]string{"End": "This field must be a date in the form of YYYY-MM-DD"}},
+	}
+
+	for _, tt := range tests {
+		s := tt.s
+		if s.Age == 0 {
+			s.Age = 18
+		}
+
+		errors := validateStruct(t, &s)
+		if len(errors) != len(tt.errors) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.errors, errors)
+			continue
+		}
+		for key, message := range tt.errors {
+			if errors[key] != message {
+				t.Errorf("%s: %s: expected %q, got %q", tt.name, key, message, errors[key])
+			}
+		}
+	}
+}
+
+func TestValidateStruct_Optional(t *testing.T) {
+	var s struct {
+		Email string `validate:"email"`
+		Age *int `validate:"min=18"`
+		Nickname *string `validate:"required"`
+		Site *string `validate:"omitempty,url"`
+	}
+
+	// rules other than required pass empty strings and nil pointers
+	errors := validateStruct(t, &s)
+	if len(errors) != 1 || errors["Nickname"] != "This field cannot be blank" {
+		t.Errorf("expected only the required pointer to fail, got %v", errors)
+	}
+
+	// and look at what pointers point to
+	age, empty, site := 17, "", "nope"
+	s.Age, s.Nickname, s.Site = &age, &empty, &site
+	errors = validateStruct(t, &s)
+	want := map[string]string{
+		"Age": "This field must be at least 18",
+		"Nickname": "This field cannot be blank",
+		"Site": "Invalid URL",
+	}
+	if !reflect.DeepEqual(errors, want) {
+		t.Errorf("expected %v, got %v", want, errors)
+	}
+}
+
+func TestValidateStruct_Tags(t *testing.T) {
+	tests := []struct {
+		tag string
+		err string
+	}{
+		{"required,unknown", "unknown rule unknown"},
+		{"min=three", `"three" is not a number`},
+		{"oneof=", "no options"},
+		{"after=yesterday", "cannot parse"},
+		{"regexp=[", "missing closing ]"},
+	}
+
+	for _, tt := range tests {
+		typ := reflect.StructOf([]reflect.StructField{{
+			Name: "Field",
+			Type: reflect.TypeOf(""),
+			Tag: reflect.StructTag(`validate:"` + tt.tag + `"`),
+		}})
+		s := reflect.New(typ)
+		s.Elem().Field(0).SetString("2021-01-01")
+
+		v := (&Rasant{}).Validator(url.Values{})
+		err := v.ValidateStruct(s.Interface())
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.tag, tt.err, err)
+		}
+	}
+
+	// spaces around rules and empty rules are allowed
+	var s struct {
+		Name string `validate:" required , ,min=2"`
+		Skipped string `validate:"-"`
+	}
+	if errors := validateStruct(t, &s); errors["Name"] != "This field cannot be blank" || len(errors) != 1 {
+		t.Errorf("expected the rules to be trimmed, got %v", errors)
+	}
+
+	v := (&Rasant{}).Validator(url.Values{})
+	for _, s := range []interface{}{"a string", (*struct{})(nil)} {
+		if err := v.ValidateStruct(s); err == nil {
+			t.Errorf("expected %T to be refused", s)
+		}
+	}
+}
+
+func TestValidateStruct_Nested(t *testing.T) {
+	type item struct {
+		Name string `json:"name" validate:"required"`
+		Qty int `json:"qty" validate:"min=1"`
+	}
+	type address struct {
+		City string `form:"city" json:"town" validate:"required"`
+	}
+	type Audit struct {
+		Source string `json:"source" validate:"required"`
+	}
+	type order struct {
+		Audit
+		Ref string `json:"ref,omitempty" validate:"required"`
+		Address address `json:"address"`
+		Billing *address `json:"billing"`
+		Items []item `json:"items" validate:"required"`
+		Extras []*item `json:"extras"`
+		Notes string `json:"-" validate:"required"`
+		When time.Time `json:"when"`
+	}
+
+	s := order{
+		Items: []item{{Name: "tea", Qty: 1}, {Qty: 0}},
+		Extras: []*item{nil, {Name: "cake"}},
+	}
+
+	want := map[string]string{
+		// embedded fields belong to the outer struct
+		"source": "This field cannot be blank",
+		// json options are not part of the name
+		"ref": "This field cannot be blank",
+		// the form tag wins over the json tag
+		"address.city": "This field cannot be blank",
+		"items.1.name": "This field cannot be blank",
+		"items.1.qty": "This field must be at least 1",
+		"extras.1.qty": "This field must be at least 1",
+		// json:"-" leaves the Go name
+		"Notes": "This field cannot be blank",
+	}
+
+	errors := validateStruct(t, &s)
+	if !reflect.DeepEqual(errors, want) {
+		t.Errorf("expected %v, got %v", want, errors)
+	}
+
+	s.Billing = &address{}
+	if errors = validateStruct(t, s); errors["billing.city"] != "This field cannot be blank" {
+		t.Errorf("expected a struct pointer to be validated when set, got %v", errors)
+	}
+}
+
+func TestValidateStruct_Confirmed(t *testing.T) {
+	type signup struct {
+		Password string `json:"password" validate:"confirmed"`
+		PasswordConfirmation string `json:"password_confirmation"`
+	}
+
+	if errors := validateStruct(t, &signup{"secret", "secret"}); len(errors) != 0 {
+		t.Errorf("expected matching passwords to pass, got %v", errors)
+	}
+	if errors := validateStruct(t, &signup{"secret", "other"}); errors["password"] != "The confirmation does not match" {
+		t.Errorf("expected different passwords to fail, got %v", errors)
+	}
+
+	var missing struct {
+		Password string `validate:"confirmed"`
+	}
+	missing.Password = "secret"
+	if err := (&Rasant{}).Validator(url.Values{}).ValidateStruct(&missing); err == nil {
+		t.Error("expected a missing confirmation field to be an error")
+	}
+}
@@ -1,27 +1,68 @@
 package rasant
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/asaskevich/govalidator"
+	"github.com/shaynemeyer/rasant/i18n"
 )
 
 type Validation struct {
 	Data url.Values
 	Errors map[string]string
+	// Locale is the locale of the error messages; the default locale when empty
+	Locale string
+	i18n *i18n.Catalog
+	db Database
 }
 
 func (ras *Rasant) Validator(data url.Values) *Validation {
 	return &Validation{
 		Errors: make(map[string]string),
 		Data: data,
+		i18n: ras.I18n,
+		db: ras.DB,
 	}
 }
 
+// ValidatorFor returns a validator whose error messages are in the locale of r
+func (ras *Rasant) ValidatorFor(r *http.Request, data url.Values) *Validation {
+	v := ras.Validator(data)
+	v.Locale = i18n.Locale(r.Context())
+	return v
+}
+
+// message returns the translation of validation.<key>, or fallback when there is none. args
+// fill the {placeholders} of either (see i18n.Format).
+func (v *Validation) message(key, fallback string, args ...interface{}) string {
+	if v.i18n != nil {
+		if msg, ok := v.i18n.Lookup(v.Locale, "validation."+key); ok {
+			return i18n.Format(msg, args...)
+		}
+	}
+	return i18n.Format(fallback, args...)
+}
+
+// FlashValidation keeps v's errors and the submitted values for the page the user is
+// redirected to, where templates can show them with .FieldError and .Old
+func (ras *Rasant) FlashValidation(ctx context.Context, v *Validation) {
+	ras.Render.FlashFieldErrors(ctx, v.Errors)
+	ras.Render.FlashInput(ctx, v.Data)
+}
+
 func (v *Validation) Valid() bool {
 	return len(v.Errors) == 0
 }
@@ -44,7 +85,7 @@ func (v *Validation) Required(r *http.Request, fields ...string) {
 	for _, field := range fields {
 		value := r.Form.Get(field)
 		if strings.TrimSpace(value) == "" {
-			v.AddError(field, "This field cannot be blank")
+			v.AddError(field, v.message("required", "This field cannot be blank"))
 		}
 	}
 }
@@ -57,33 +98,327 @@ func (v *Validation) Check(ok bool, key, message string) {
 
 func (v *Validation) IsEmail(field, value string) {
 	if !govalidator.IsEmail(value) {
-		v.AddError(field, "Invalid email address")
+		v.AddError(field, v.message("email", "Invalid email address"))
 	}
 }
 
 func (v *Validation) IsInt(field, value string) {
 	_, err := strconv.Atoi(value)
 	if err != nil {
-		v.AddError(field, "This field must be an integer")
+		v.AddError(field, v.message("int", "This field must be an integer"))
 	}
 }
 
 func (v *Validation) IsFloat(field, value string) {
 	_, err := strconv.ParseFloat(value, 64)
 	if err != nil {
-		v.AddError(field, "This field must be a floating point number")
+		v.AddError(field, v.message("float", "This field must be a floating point number"))
 	}
 }
 
 func (v *Validation) IsDateISO(field, value string) {
 	_, err := time.Parse("2006-01-02", value)
 	if err != nil {
-		v.AddError(field, "This field must be a date in the form of YYYY-MM-DD")
+		v.AddError(field, v.message("date_iso", "This field must be a date in the form of YYYY-MM-DD"))
 	}
 }
 
 func (v *Validation) NoSpaces(field, value string) {
 	if govalidator.HasWhitespace(value) {
-		v.AddError(field, "Spaces are not permitted")
+		v.AddError(field, v.message("no_spaces", "Spaces are not permitted"))
+	}
+}
+
+func (v *Validation) MinLength(field, value string, n int) {
+	if utf8.RuneCountInString(value) < n {
+		v.AddError(field, v.message("min_length", sizeMessages["min"][measureLength], "min", n))
+	}
+}
+
+func (v *Validation) MaxLength(field, value string, n int) {
+	if utf8.RuneCountInString(value) > n {
+		v.AddError(field, v.message("max_length", sizeMessages["max"][measureLength], "max", n))
+	}
+}
+
+// Between checks that value is a number from min to max
+func (v *Validation) Between(field, value string, min, max float64) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < min || n > max {
+		v.AddError(field, v.message("between", "This field must be a number from {min} to {max}",
+			"min", strconv.FormatFloat(min, 'f', -1, 64), "max", strconv.FormatFloat(max, 'f', -1, 64)))
+	}
+}
+
+func (v *Validation) Matches(field, value string, re *regexp.Regexp) {
+	if !re.MatchString(value) {
+		v.AddError(field, v.message("regexp", "This field is not in the right format"))
+	}
+}
+
+// IsURL checks that value is an absolute http or https URL
+func (v *Validation) IsURL(field, value string) {
+	if !isURL(value) {
+		v.AddError(field, v.message("url", "Invalid URL"))
+	}
+}
+
+func (v *Validation) IsUUID(field, value string) {
+	if !govalidator.IsUUID(value) {
+		v.AddError(field, v.message("uuid", "Invalid UUID"))
+	}
+}
+
+// IsPhone checks that value looks like a phone number: 7 to 15 digits, optionally starting
+// with +, and separated by spaces, dots, dashes or parentheses
+func (v *Validation) IsPhone(field, value string) {
+	if !isPhone(value) {
+		v.AddError(field, v.message("phone", "Invalid phone number"))
+	}
+}
+
+// IsStrongPassword checks that value has at least minPasswordLength characters, among them
+// upper and lower case letters and a digit
+func (v *Validation) IsStrongPassword(field, value string) {
+	if !isStrongPassword(value) {
+		v.AddError(field, v.passwordMessage())
+	}
+}
+
+func (v *Validation) passwordMessage() string {
+	return v.message("password",
+		"The password must be at least {min} characters long and contain upper and lower case letters and a number",
+		"min", minPasswordLength)
+}
+
+// Confirmed checks that field has the same value as field_confirmation, e.g. password and
+// password_confirmation
+func (v *Validation) Confirmed(field string) {
+	if v.Data.Get(field) != v.Data.Get(field+"_confirmation") {
+		v.AddError(field, v.message("confirmed", "The confirmation does not match"))
+	}
+}
+
+// DateBetween checks that value is a date in the form YYYY-MM-DD from one date to another. A
+// zero time leaves that end of the range open.
+func (v *Validation) DateBetween(field, value string, from, to time.Time) {
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		v.AddError(field, v.message("date_iso", "This field must be a date in the form of YYYY-MM-DD"))
+		return
+	}
+
+	if message := v.dateRange(date, from, to); message != "" {
+		v.AddError(field, message)
+	}
+}
+
+// dateRange returns the message for a date outside from and to, or an empty string
+func (v *Validation) dateRange(date, from, to time.Time) string {
+	if !from.IsZero() && date.Before(from) {
+		return v.message("after", "This field must be a date on or after {date}", "date", from.Format("2006-01-02"))
+	}
+	if !to.IsZero() && date.After(to) {
+		return v.message("before", "This field must be a date on or before {date}", "date", to.Format("2006-01-02"))
+	}
+	return ""
+}
+
+// FileSize checks that the uploaded file is no larger than max bytes
+func (v *Validation) FileSize(field string, file *multipart.FileHeader, max int64) {
+	if file != nil && file.Size > max {
+		v.AddError(field, v.fileSizeMessage(max))
+	}
+}
+
+func (v *Validation) fileSizeMessage(max int64) string {
+	return v.message("file_size", "The file must not be larger than {size}", "size", formatSize(max))
+}
+
+// FileType checks that the uploaded file's content is of one of types, which are MIME types
+// such as image/png or, for any subtype, image/*. The type is detected from the content, not
+// from the file name or the type the browser claims. The error is for a file that cannot be
+// read.
+func (v *Validation) FileType(field string, file *multipart.FileHeader, types ...string) error {
+	if file == nil {
+		return nil
+	}
+
+	mimeType, err := fileType(file)
+	if err != nil {
+		return err
+	}
+
+	if !typeAllowed(mimeType, types) {
+		v.AddError(field, v.fileTypeMessage(types))
+	}
+
+	return nil
+}
+
+func (v *Validation) fileTypeMessage(types []string) string {
+	return v.message("file_type", "The file must be one of {types}", "types", strings.Join(types, ", "))
+}
+
+// fileType detects the MIME type of an uploaded file from its content
+func fileType(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return sniffType(f)
+}
+
+// Unique checks that no row of table has value in column, e.g. that an email address is not
+// taken. The error is for a failed query, or a table or column that is not a plain SQL
+// identifier.
+func (v *Validation) Unique(field, value, table, column string) error {
+	count, err := v.countRows(table, column, value)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		v.AddError(field, v.uniqueMessage())
+	}
+	return nil
+}
+
+func (v *Validation) uniqueMessage() string {
+	return v.message("unique", "This value is already taken")
+}
+
+// Exists checks that some row of table has value in column, e.g. that a chosen category id
+// refers to a category. The error is as for Unique.
+func (v *Validation) Exists(field, value, table, column string) error {
+	count, err := v.countRows(table, column, value)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		v.AddError(field, v.existsMessage())
+	}
+	return nil
+}
+
+func (v *Validation) existsMessage() string {
+	return v.message("exists", "The selected value does not exist")
+}
+
+// sqlIdentifier matches table and column names, optionally qualified by a schema
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// countRows counts the rows of table whose column holds value. Identifiers cannot be query
+// parameters, so they are checked instead.
+func (v *Validation) countRows(table, column string, value interface{}) (int, error) {
+	if v.db.Pool == nil {
+		return 0, errors.New("validation: no database connection")
+	}
+
+	if !sqlIdentifier.MatchString(table) || !sqlIdentifier.MatchString(column) {
+		return 0, fmt.Errorf("validation: invalid table or column name %q.%q", table, column)
+	}
+
+	placeholder := "?"
+	switch v.db.DataType {
+	case "postgres", "postgresql", "pgx":
+		placeholder = "$1"
+	}
+
+	query := fmt.Sprintf("select count(*) from %s where %s = %s", table, column, placeholder)
+
+	var count int
+	if err := v.db.Pool.QueryRow(query, value).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+const minPasswordLength = 8
+
+func isStrongPassword(s string) bool {
+	var upper, lower, digit bool
+	for _, c := range s {
+		switch {
+		case unicode.IsUpper(c):
+			upper = true
+		case unicode.IsLower(c):
+			lower = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	return utf8.RuneCountInString(s) >= minPasswordLength && upper && lower && digit
+}
+
+func isURL(s string) bool {
+	u, err := url.ParseRequestURI(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
+var phoneDigits = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
+func isPhone(s string) bool {
+	return phoneDigits.MatchString(phoneSeparators.Replace(s))
+}
+
+// sniffType detects the MIME type of the content of r, without parameters such as charset
+func sniffType(r io.Reader) (string, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	mimeType, _, _ := mime.ParseMediaType(http.DetectContentType(head[:n]))
+	return mimeType, nil
+}
+
+// typeAllowed reports whether mimeType is one of types, which may end in /* for any subtype
+func typeAllowed(mimeType string, types []string) bool {
+	for _, t := range types {
+		if t == mimeType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSize formats a number of bytes for people, e.g. 2MB
+func formatSize(n int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if n >= unit.size && n%unit.size == 0 {
+			return fmt.Sprintf("%d%s", n/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// parseSize parses a number of bytes with an optional KB, MB or GB suffix
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := int64(1)
+	for suffix, size := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(s, suffix) {
+			multiplier = size
+			s = strings.TrimSpace(strings.TrimSuffix(s, suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a size", s)
 	}
+	return n * multiplier, nil
 }
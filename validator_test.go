@@ -0,0 +1,234 @@
+package rasant
+
+import (
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// uploadedFile returns the header of an uploaded file holding content
+func uploadedFile(t *testing.T, content []byte) *multipart.FileHeader {
+	t.Helper()
+
+	r := uploadRequest(t, "upload", content)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	return r.MultipartForm.File["file"][0]
+}
+
+func TestValidation_Rules(t *testing.T) {
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+
+	tests := []struct {
+		name string
+		check func(v *Validation)
+		message string
+	}{
+		{"min length", func(v *Validation) { v.MinLength("f", "abc", 3) }, ""},
+		{"min length short", func(v *Validation) { v.MinLength("f", "ab", 3) }, "This field must be at least 3 characters long"},
+		// characters are counted, not bytes
+		{"max length multibyte", func(v *Validation) { v.MaxLength("f", "ééé", 3) }, ""},
+		{"max length long", func(v *Validation) { v.MaxLength("f", "abcd", 3) }, "This field must be at most 3 characters long"},
+		{"between", func(v *Validation) { v.Between("f", "2.5", 1, 5) }, ""},
+		{"between low", func(v *Validation) { v.Between("f", "0.5", 1, 5) }, "This field must be a number from 1 to 5"},
+		{"between not a number", func(v *Validation) { v.Between("f", "two", 1, 5) }, "This field must be a number from 1 to 5"},
+		{"matches", func(v *Validation) { v.Matches("f", "abc", regexp.MustCompile(`^[a-z]+$`)) }, ""},
+		{"matches not", func(v *Validation) { v.Matches("f", "ABC", regexp.MustCompile(`^[a-z]+$`)) }, "This field is not in the right format"},
+		{"url", func(v *Validation) { v.IsURL("f", "https://example.com/a?b=c") }, ""},
+		{"url relative", func(v *Validation) { v.IsURL("f", "/a/b") }, "Invalid URL"},
+		{"url scheme", func(v *Validation) { v.IsURL("f", "javascript://alert(1)") }, "Invalid URL"},
+		{"uuid", func(v *Validation) { v.IsUUID("f", "5e8c6e43-8a1b-4c3f-9a7e-2f1d1a1b2c3d") }, ""},
+		{"uuid not", func(v *Validation) { v.IsUUID("f", "5e8c6e43") }, "Invalid UUID"},
+		{"phone", func(v *Validation) { v.IsPhone("f", "+44 (20) 7946-0958") }, ""},
+		{"phone short", func(v *Validation) { v.IsPhone("f", "12345") }, "Invalid phone number"},
+		{"phone letters", func(v *Validation) { v.IsPhone("f", "555-CALL-NOW") }, "Invalid phone number"},
+		{"password", func(v *Validation) { v.IsStrongPassword("f", "Secret123") }, ""},
+		{"password weak", func(v *Validation) { v.IsStrongPassword("f", "secret123") },
+			"The password must be at least 8 characters long and contain upper and lower case letters and a number"},
+		{"password short", func(v *Validation) { v.IsStrongPassword("f", "Sec123") },
+			"The password must be at least 8 characters long and contain upper and lower case letters and a number"},
+		{"date between", func(v *Validation) { v.DateBetween("f", "2020-06-01", day("2020-01-01"), day("2020-12-31")) }, ""},
+		{"date between open", func(v *Validation) { v.DateBetween("f", "1999-06-01", time.Time{}, day("2020-12-31")) }, ""},
+		{"date before", func(v *Validation) { v.DateBetween("f", "2019-06-01", day("2020-01-01"), time.Time{}) },
+			"This field must be a date on or after 2020-01-01"},
+		{"date after", func(v *Validation) { v.DateBetween("f", "2021-06-01", time.Time{}, day("2020-12-31")) },
+			"This field must be a date on or before 2020-12-31"},
+		{"date invalid", func(v *Validation) { v.DateBetween("f", "01/06/2020", time.Time{}, time.Time{}) },
+			"This field must be a date in the form of YYYY-MM-DD"},
+		{"file size", func(v *Validation) { v.FileSize("f", uploadedFile(t, pngFile(2048)), 2<<10) }, ""},
+		{"file size large", func(v *Validation) { v.FileSize("f", uploadedFile(t, pngFile(2049)), 2<<10) }, "The file must not be larger than 2KB"},
+		{"file size none", func(v *Validation) { v.FileSize("f", nil, 1) }, ""},
+		{"file type", func(v *Validation) { _ = v.FileType("f", uploadedFile(t, pngHeader), "image/*") }, ""},
+		{"file type other", func(v *Validation) { _ = v.FileType("f", uploadedFile(t, []byte("%PDF-1.4")), "image/png", "image/jpeg") },
+			"The file must be one of image/png, image/jpeg"},
+	}
+
+	for _, tt := range tests {
+		v := (&Rasant{}).Validator(url.Values{})
+		tt.check(v)
+		if v.Errors["f"] != tt.message {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.message, v.Errors["f"])
+		}
+	}
+}
+
+func TestValidation_Confirmed(t *testing.T) {
+	tests := []struct {
+		data url.Values
+		valid bool
+	}{
+		{url.Values{"password": {"Secret123"}, "password_confirmation": {"Secret123"}}, true},
+		{url.Values{"password": {"Secret123"}, "password_confirmation": {"Secret124"}}, false},
+		{url.Values{"password": {"Secret123"}}, false},
+	}
+
+	for _, tt := range tests {
+		v := (&Rasant{}).Validator(tt.data)
+		v.Confirmed("password")
+		if v.Valid() != tt.valid {
+			t.Errorf("%v: expected valid to be %v", tt.data, tt.valid)
+		}
+	}
+}
+
+func TestSQLIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		ok bool
+	}{
+		{"users", true},
+		{"_users2", true},
+		{"public.users", true},
+		{"email_address", true},
+		{"", false},
+		{"2users", false},
+		{"users;drop table users", false},
+		{"users where 1=1", false},
+		{"a.b.c", false},
+		{"users.", false},
+		{`"users"`, false},
+		{"users--", false},
+	}
+
+	for _, tt := range tests {
+		if sqlIdentifier.MatchString(tt.name) != tt.ok {
+			t.Errorf("%q: expected %v", tt.name, tt.ok)
+		}
+	}
+}
+
+func TestValidation_UniqueExists(t *testing.T) {
+	tests := []struct {
+		dataType string
+		query string
+	}{
+		{"postgres", "select count(*) from users where email = $1"},
+		{"pgx", "select count(*) from users where email = $1"},
+		{"mysql", "select count(*) from users where email = ?"},
+		{"mariadb", "select count(*) from users where email = ?"},
+	}
+
+	for _, tt := range tests {
+		db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ras := &Rasant{DB: Database{DataType: tt.dataType, Pool: db}}
+
+		mock.ExpectQuery(tt.query).WithArgs("ada@example.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(tt.query).WithArgs("bob@example.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectQuery(tt.query).WithArgs("ada@example.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(tt.query).WithArgs("bob@example.com").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+		v := ras.Validator(url.Values{})
+		if err = v.Unique("taken", "ada@example.com", "users", "email"); err != nil {
+			t.Fatal(err)
+		}
+		if err = v.Unique("free", "bob@example.com", "users", "email"); err != nil {
+			t.Fatal(err)
+		}
+		if err = v.Exists("found", "ada@example.com", "users", "email"); err != nil {
+			t.Fatal(err)
+		}
+		if err = v.Exists("missing", "bob@example.com", "users", "email"); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[string]string{
+			"taken": "This value is already taken",
+			"missing": "The selected value does not exist",
+		}
+		if len(v.Errors) != len(want) || v.Errors["taken"] != want["taken"] || v.Errors["missing"] != want["missing"] {
+			t.Errorf("%s: expected %v, got %v", tt.dataType, want, v.Errors)
+		}
+
+		if err = mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("%s: %v", tt.dataType, err)
+		}
+		db.Close()
+	}
+}
+
+func TestValidation_UniqueIdentifiers(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	v := (&Rasant{DB: Database{DataType: "postgres", Pool: db}}).Validator(url.Values{})
+
+	// nothing reaches the database when a name is not a plain identifier
+	if err = v.Unique("email", "ada@example.com", "users; drop table users", "email"); err == nil {
+		t.Error("expected an invalid table name to be refused")
+	}
+	if err = v.Exists("email", "ada@example.com", "users", "email or 1=1"); err == nil {
+		t.Error("expected an invalid column name to be refused")
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	if err = (&Rasant{}).Validator(url.Values{}).Unique("email", "ada@example.com", "users", "email"); err == nil {
+		t.Error("expected an error without a database")
+	}
+}
+
+func TestValidateStruct_Database(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("select count(*) from users where email = $1").WithArgs("ada@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("select count(*) from public.plans where id = $1").WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+
+	s := struct {
+		Email string `json:"email" validate:"unique=users.email"`
+		Plan int `json:"plan" validate:"exists=public.plans.id"`
+	}{"ada@example.com", 7}
+
+	v := (&Rasant{DB: Database{DataType: "postgres", Pool: db}}).Validator(url.Values{})
+	if err = v.ValidateStruct(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	if v.Errors["email"] != "This value is already taken" || v.Errors["plan"] != "The selected value does not exist" {
+		t.Errorf("wrong errors: %v", v.Errors)
+	}
+	if err = mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}